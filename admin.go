@@ -0,0 +1,217 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// reconcileTolerancePct is the largest difference between the two data
+// sources that is still considered a match.
+const reconcileTolerancePct = 0.1
+
+// yahooSymbols maps the EOD tickers that can be reconciled to their Yahoo
+// Finance equivalents.
+var yahooSymbols = map[string]string{
+	"VOO.US":     "VOO",
+	"BTC-USD.CC": "BTC-USD",
+}
+
+// ReconcileResult is the outcome of a spot check between the cached EODHD
+// price and Yahoo Finance.
+type ReconcileResult struct {
+	Status     string  `json:"status"`
+	EODHDClose float64 `json:"eodhd_close"`
+	YahooClose float64 `json:"yahoo_close"`
+	DiffPct    float64 `json:"diff_pct"`
+}
+
+// isAdminRequest reports whether r carries the configured admin bearer
+// token. It is always false when no token is configured.
+func (a *App) isAdminRequest(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return a.adminToken != "" && ok && subtle.ConstantTimeCompare([]byte(token), []byte(a.adminToken)) == 1
+}
+
+// requireAdminToken rejects requests that do not carry the configured admin
+// bearer token. Admin endpoints are disabled when no token is configured.
+func (a *App) requireAdminToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.isAdminRequest(r) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAdmin guards the admin endpoints: requests must carry the admin
+// bearer token and, when ADMIN_HMAC_SECRET is set, be signed with it.
+func (a *App) requireAdmin(next http.Handler) http.Handler {
+	if len(a.adminHMACSecret) > 0 {
+		next = HMACMiddleware(a.adminHMACSecret)(next)
+	}
+	return a.requireAdminToken(next)
+}
+
+// HMACMiddleware rejects requests whose X-Signature-256 header is not
+// "sha256=" followed by the hex HMAC-SHA256 of the request body under secret.
+func HMACMiddleware(secret []byte) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			signature, ok := strings.CutPrefix(r.Header.Get("X-Signature-256"), "sha256=")
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "Error reading request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			mac := hmac.New(sha256.New, secret)
+			mac.Write(body)
+			want := hex.EncodeToString(mac.Sum(nil))
+			if !hmac.Equal([]byte(strings.ToLower(signature)), []byte(want)) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ReconcileHandler compares the cached EODHD close of a ticker on a given date
+// against the close reported by Yahoo Finance.
+func (a *App) ReconcileHandler(w http.ResponseWriter, r *http.Request) {
+	ticker := strings.ToUpper(mux.Vars(r)["ticker"])
+	yahooSymbol, ok := yahooSymbols[ticker]
+	if !ok {
+		http.Error(w, "Ticker cannot be reconciled", http.StatusBadRequest)
+		return
+	}
+	day, err := validateDateParam("date", r.URL.Query().Get("date"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	date := day.Format(time.DateOnly)
+
+	stockData, err := a.PrepareSymbolJSONData(r.Context(), ticker, fundInceptionDate, "")
+	if err != nil {
+		http.Error(w, "Error preparing symbol JSON data", http.StatusInternalServerError)
+		return
+	}
+	eodClose, found := 0.0, false
+	for _, data := range stockData {
+		if data.Date == date {
+			eodClose, found = data.Close, true
+			break
+		}
+	}
+	if !found {
+		http.Error(w, "No EODHD price for date", http.StatusNotFound)
+		return
+	}
+
+	yahooClose, err := a.fetchYahooClose(r.Context(), yahooSymbol, date)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error fetching Yahoo Finance price: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reconcilePrices(eodClose, yahooClose))
+}
+
+// reconcilePrices reports the relative difference between the two closes.
+func reconcilePrices(eodClose, yahooClose float64) ReconcileResult {
+	result := ReconcileResult{
+		Status:     "ok",
+		EODHDClose: eodClose,
+		YahooClose: yahooClose,
+	}
+	if yahooClose != 0 {
+		result.DiffPct = (eodClose - yahooClose) / yahooClose * 100
+	}
+	if math.Abs(result.DiffPct) > reconcileTolerancePct {
+		result.Status = "discrepancy"
+	}
+	return result
+}
+
+// fetchYahooClose reads the daily close of symbol on date from the Yahoo
+// Finance chart API.
+func (a *App) fetchYahooClose(ctx context.Context, symbol, date string) (float64, error) {
+	day, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		return 0, err
+	}
+	url := fmt.Sprintf("%s/v8/finance/chart/%s?period1=%d&period2=%d&interval=1d",
+		a.yahooBaseURL, symbol, day.Unix(), day.AddDate(0, 0, 1).Unix())
+	body, err := readDataFromURL(ctx, url, a.retryPolicy)
+	if err != nil {
+		return 0, err
+	}
+	return parseYahooClose(body, date)
+}
+
+// parseYahooClose extracts the close on date from a Yahoo Finance chart API
+// response.
+func parseYahooClose(body []byte, date string) (float64, error) {
+	var chart struct {
+		Chart struct {
+			Result []struct {
+				Timestamp  []int64 `json:"timestamp"`
+				Indicators struct {
+					Quote []struct {
+						Close []*float64 `json:"close"`
+					} `json:"quote"`
+				} `json:"indicators"`
+			} `json:"result"`
+		} `json:"chart"`
+	}
+	if err := json.Unmarshal(body, &chart); err != nil {
+		return 0, err
+	}
+	for _, result := range chart.Chart.Result {
+		if len(result.Indicators.Quote) == 0 {
+			continue
+		}
+		closes := result.Indicators.Quote[0].Close
+		for i, ts := range result.Timestamp {
+			if i < len(closes) && closes[i] != nil && time.Unix(ts, 0).UTC().Format(time.DateOnly) == date {
+				return *closes[i], nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("no Yahoo Finance price for %s", date)
+}
@@ -0,0 +1,137 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequireAdminToken(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		configured string
+		header     string
+		want       int
+	}{
+		{"secret", "Bearer secret", http.StatusOK},
+		{"secret", "Bearer wrong", http.StatusUnauthorized},
+		{"secret", "", http.StatusUnauthorized},
+		{"", "Bearer ", http.StatusUnauthorized},
+	}
+	for _, tc := range tests {
+		app := &App{adminToken: tc.configured}
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/admin/reconcile/VOO.US", nil)
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+		app.requireAdminToken(ok).ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Errorf("token %q, header %q: Code = %d, want %d", tc.configured, tc.header, rr.Code, tc.want)
+		}
+	}
+}
+
+func TestHMACMiddleware(t *testing.T) {
+	secret := []byte("hmac-secret")
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	var seen string
+	handler := HMACMiddleware(secret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		seen = string(body)
+	}))
+	tests := []struct {
+		name      string
+		body      string
+		signature string
+		want      int
+	}{
+		{"valid", `{"ticker":"VOO.US"}`, sign(`{"ticker":"VOO.US"}`), http.StatusOK},
+		{"valid empty body", "", sign(""), http.StatusOK},
+		{"tampered body", `{"ticker":"BTC-USD.CC"}`, sign(`{"ticker":"VOO.US"}`), http.StatusUnauthorized},
+		{"wrong secret", "", "sha256=" + strings.Repeat("0", 64), http.StatusUnauthorized},
+		{"missing prefix", "", strings.TrimPrefix(sign(""), "sha256="), http.StatusUnauthorized},
+		{"missing header", "", "", http.StatusUnauthorized},
+	}
+	for _, tc := range tests {
+		seen = ""
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/admin/reconcile/VOO.US", strings.NewReader(tc.body))
+		if tc.signature != "" {
+			req.Header.Set("X-Signature-256", tc.signature)
+		}
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Errorf("%s: Code = %d, want %d", tc.name, rr.Code, tc.want)
+		}
+		if tc.want == http.StatusOK && seen != tc.body {
+			t.Errorf("%s: handler read body %q, want %q", tc.name, seen, tc.body)
+		}
+	}
+}
+
+func TestReconcilePrices(t *testing.T) {
+	if got := reconcilePrices(100.50, 100.48); got.Status != "ok" || !almostEqual(got.DiffPct, 0.02/100.48*100) {
+		t.Errorf("reconcilePrices(100.50, 100.48) = %+v, want ok", got)
+	}
+	if got := reconcilePrices(101, 100); got.Status != "discrepancy" {
+		t.Errorf("reconcilePrices(101, 100) = %+v, want discrepancy", got)
+	}
+}
+
+func TestParseYahooClose(t *testing.T) {
+	// 2024-01-15 14:30 UTC and 2024-01-16 14:30 UTC.
+	body := []byte(`{"chart":{"result":[{"timestamp":[1705329000,1705415400],
+		"indicators":{"quote":[{"close":[100.48,null]}]}}]}}`)
+	got, err := parseYahooClose(body, "2024-01-15")
+	if err != nil || got != 100.48 {
+		t.Errorf("parseYahooClose = %v, %v, want 100.48", got, err)
+	}
+	if _, err := parseYahooClose(body, "2024-01-16"); err == nil {
+		t.Error("parseYahooClose with a null close: want error")
+	}
+}
+
+func TestReconcileHandler(t *testing.T) {
+	yahoo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"chart":{"result":[{"timestamp":[1546439400],"indicators":{"quote":[{"close":[250]}]}}]}}`)
+	}))
+	defer yahoo.Close()
+
+	app := newTestApp(t)
+	app.adminToken = "secret"
+	app.yahooBaseURL = yahoo.URL
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 225, 226))
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/admin/reconcile/VOO.US?date=2019-01-02", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	app.newRouter().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+}
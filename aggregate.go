@@ -0,0 +1,193 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// QuarterlyReturn summarises the performance of the index over one calendar
+// quarter.
+type QuarterlyReturn struct {
+	Quarter    string  `json:"quarter"`
+	StartValue float64 `json:"start_value"`
+	EndValue   float64 `json:"end_value"`
+	ReturnPct  float64 `json:"return_pct"`
+	Partial    bool    `json:"partial,omitempty"`
+	// YearLabel classifies the return of the containing year, see
+	// classifyYear.
+	YearLabel string `json:"year_label,omitempty"`
+}
+
+// AnnualReturn summarises the performance of the index over one calendar
+// year.
+type AnnualReturn struct {
+	Year       string  `json:"year"`
+	StartValue float64 `json:"start_value"`
+	EndValue   float64 `json:"end_value"`
+	ReturnPct  float64 `json:"return_pct"`
+	Partial    bool    `json:"partial,omitempty"`
+	YearLabel  string  `json:"year_label,omitempty"`
+}
+
+// Year labels returned by classifyYear.
+const (
+	yearStrongGrowth = "strong_growth"
+	yearGrowth       = "growth"
+	yearFlat         = "flat"
+	yearContraction  = "contraction"
+)
+
+// classifyYear labels an annual return in percent: above 20% is strong
+// growth, 0% to 20% growth, -5% up to 0% flat and below -5% contraction.
+func classifyYear(annualReturn float64) string {
+	switch {
+	case annualReturn > 20:
+		return yearStrongGrowth
+	case annualReturn >= 0:
+		return yearGrowth
+	case annualReturn >= -5:
+		return yearFlat
+	default:
+		return yearContraction
+	}
+}
+
+// quarterOf returns the quarter label (e.g. "2021-Q3") of a date string and the
+// last day of that quarter.
+func quarterOf(date string) (string, string, error) {
+	t, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		return "", "", err
+	}
+	q := (int(t.Month())-1)/3 + 1
+	end := time.Date(t.Year(), time.Month(q*3)+1, 0, 0, 0, 0, 0, time.UTC)
+	return fmt.Sprintf("%d-Q%d", t.Year(), q), end.Format(time.DateOnly), nil
+}
+
+// aggregateQuarterly groups the index series by calendar quarter. Each
+// quarter starts from the closing value of the previous quarter (or the first
+// point of the series) so that chaining the returns reproduces the full
+// period return. A trailing quarter that has not finished yet is flagged as
+// partial.
+func aggregateQuarterly(series []IndexData) []QuarterlyReturn {
+	var quarters []QuarterlyReturn
+	for i, data := range series {
+		quarter, quarterEnd, err := quarterOf(data.Date)
+		if err != nil {
+			continue
+		}
+		if len(quarters) == 0 || quarters[len(quarters)-1].Quarter != quarter {
+			startValue := data.AdjClose
+			if len(quarters) > 0 {
+				startValue = quarters[len(quarters)-1].EndValue
+			}
+			quarters = append(quarters, QuarterlyReturn{
+				Quarter:    quarter,
+				StartValue: startValue,
+			})
+		}
+		current := &quarters[len(quarters)-1]
+		current.EndValue = data.AdjClose
+		if i == len(series)-1 {
+			current.Partial = maxDateStr(data.Date, quarterEnd) != data.Date
+		}
+	}
+	for i := range quarters {
+		if quarters[i].StartValue != 0 {
+			quarters[i].ReturnPct = (quarters[i].EndValue/quarters[i].StartValue - 1) * 100
+		}
+	}
+	labels := make(map[string]string)
+	for _, year := range annualFromQuarters(quarters) {
+		labels[year.Year] = year.YearLabel
+	}
+	for i := range quarters {
+		quarters[i].YearLabel = labels[quarters[i].Quarter[:4]]
+	}
+	return quarters
+}
+
+// Output frequencies accepted by ?frequency.
+const (
+	frequencyDaily         = "daily"
+	frequencyBusinessDaily = "business_daily"
+	frequencyWeeklyLast    = "weekly_last"
+	frequencyMonthlyLast   = "monthly_last"
+)
+
+// Resample aligns the daily index series to frequency. Business daily keeps
+// the weekday points, including forward filled ones, and drops weekends.
+// Weekly and monthly keep the last point of every ISO week or calendar month.
+// Daily returns series unchanged.
+func Resample(series []IndexData, frequency string) []IndexData {
+	if frequency == "" || frequency == frequencyDaily {
+		return series
+	}
+	resampled := make([]IndexData, 0, len(series))
+	lastPeriod := ""
+	for _, data := range series {
+		date, err := time.Parse(time.DateOnly, data.Date)
+		if err != nil {
+			continue
+		}
+		if frequency == frequencyBusinessDaily {
+			if date.Weekday() != time.Saturday && date.Weekday() != time.Sunday {
+				resampled = append(resampled, data)
+			}
+			continue
+		}
+		period := data.Date[:7]
+		if frequency == frequencyWeeklyLast {
+			year, week := date.ISOWeek()
+			period = fmt.Sprintf("%d-W%02d", year, week)
+		}
+		if len(resampled) > 0 && period == lastPeriod {
+			resampled[len(resampled)-1] = data
+			continue
+		}
+		lastPeriod = period
+		resampled = append(resampled, data)
+	}
+	return resampled
+}
+
+// aggregateAnnual groups the index series by calendar year, chaining the
+// years the same way aggregateQuarterly chains quarters.
+func aggregateAnnual(series []IndexData) []AnnualReturn {
+	return annualFromQuarters(aggregateQuarterly(series))
+}
+
+// annualFromQuarters combines consecutive quarters of the same year.
+func annualFromQuarters(quarters []QuarterlyReturn) []AnnualReturn {
+	var years []AnnualReturn
+	for _, quarter := range quarters {
+		year := quarter.Quarter[:4]
+		if len(years) == 0 || years[len(years)-1].Year != year {
+			years = append(years, AnnualReturn{Year: year, StartValue: quarter.StartValue})
+		}
+		current := &years[len(years)-1]
+		current.EndValue = quarter.EndValue
+		current.Partial = quarter.Partial
+	}
+	for i := range years {
+		if years[i].StartValue != 0 {
+			years[i].ReturnPct = (years[i].EndValue/years[i].StartValue - 1) * 100
+		}
+		years[i].YearLabel = classifyYear(years[i].ReturnPct)
+	}
+	return years
+}
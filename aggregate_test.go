@@ -0,0 +1,157 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// indexSeries builds a calendar-daily index series starting at start.
+func indexSeries(start string, values ...float64) []IndexData {
+	series := make([]IndexData, 0, len(values))
+	date := start
+	for _, v := range values {
+		series = append(series, IndexData{Date: date, AdjClose: v})
+		date = incrementDate(date)
+	}
+	return series
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestAggregateQuarterly(t *testing.T) {
+	series := []IndexData{
+		{Date: "2021-03-30", AdjClose: 100},
+		{Date: "2021-03-31", AdjClose: 110},
+		{Date: "2021-04-01", AdjClose: 120},
+		{Date: "2021-06-30", AdjClose: 121},
+		{Date: "2021-07-01", AdjClose: 99},
+		{Date: "2021-08-15", AdjClose: 242},
+	}
+	got := aggregateQuarterly(series)
+	want := []QuarterlyReturn{
+		{Quarter: "2021-Q1", StartValue: 100, EndValue: 110, ReturnPct: 10},
+		{Quarter: "2021-Q2", StartValue: 110, EndValue: 121, ReturnPct: 10},
+		{Quarter: "2021-Q3", StartValue: 121, EndValue: 242, ReturnPct: 100, Partial: true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("len = %d, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Quarter != w.Quarter || g.StartValue != w.StartValue || g.EndValue != w.EndValue ||
+			!almostEqual(g.ReturnPct, w.ReturnPct) || g.Partial != w.Partial {
+			t.Errorf("quarter %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestAggregateQuarterlyCompleteLastQuarter(t *testing.T) {
+	got := aggregateQuarterly(indexSeries("2021-12-30", 100, 105))
+	if len(got) != 1 || got[0].Partial {
+		t.Errorf("aggregateQuarterly = %+v, want a single complete quarter", got)
+	}
+	if got := aggregateQuarterly(nil); len(got) != 0 {
+		t.Errorf("aggregateQuarterly(nil) = %+v, want empty", got)
+	}
+}
+
+func TestClassifyYear(t *testing.T) {
+	tests := []struct {
+		returnPct float64
+		want      string
+	}{
+		{45, yearStrongGrowth},
+		{20.01, yearStrongGrowth},
+		{20, yearGrowth},
+		{0.01, yearGrowth},
+		{0, yearGrowth},
+		{-0.01, yearFlat},
+		{-5, yearFlat},
+		{-5.01, yearContraction},
+		{-60, yearContraction},
+	}
+	for _, tc := range tests {
+		if got := classifyYear(tc.returnPct); got != tc.want {
+			t.Errorf("classifyYear(%v) = %q, want %q", tc.returnPct, got, tc.want)
+		}
+	}
+}
+
+func TestAggregateAnnual(t *testing.T) {
+	series := []IndexData{
+		{Date: "2020-06-30", AdjClose: 100},
+		{Date: "2020-12-31", AdjClose: 130},
+		{Date: "2021-03-31", AdjClose: 120},
+		{Date: "2021-12-31", AdjClose: 117},
+		{Date: "2022-02-01", AdjClose: 100},
+	}
+	got := aggregateAnnual(series)
+	want := []AnnualReturn{
+		{Year: "2020", StartValue: 100, EndValue: 130, ReturnPct: 30, YearLabel: yearStrongGrowth},
+		{Year: "2021", StartValue: 130, EndValue: 117, ReturnPct: -10, YearLabel: yearContraction},
+		{Year: "2022", StartValue: 117, EndValue: 100, ReturnPct: (100.0/117 - 1) * 100, Partial: true, YearLabel: yearContraction},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("len = %d, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Year != w.Year || g.StartValue != w.StartValue || g.EndValue != w.EndValue ||
+			!almostEqual(g.ReturnPct, w.ReturnPct) || g.Partial != w.Partial || g.YearLabel != w.YearLabel {
+			t.Errorf("year %d = %+v, want %+v", i, g, w)
+		}
+	}
+
+	// Every quarter carries the label of its year.
+	for _, quarter := range aggregateQuarterly(series) {
+		if quarter.Quarter[:4] == "2021" && quarter.YearLabel != yearContraction {
+			t.Errorf("quarter %s label = %q, want %q", quarter.Quarter, quarter.YearLabel, yearContraction)
+		}
+	}
+}
+
+func TestResample(t *testing.T) {
+	// Friday 2024-01-26 to Monday 2024-02-05.
+	series := indexSeries("2024-01-26", 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11)
+	dates := func(series []IndexData) []string {
+		var d []string
+		for _, p := range series {
+			d = append(d, p.Date)
+		}
+		return d
+	}
+	tests := []struct {
+		frequency string
+		want      []string
+	}{
+		{frequencyDaily, dates(series)},
+		{frequencyBusinessDaily, []string{"2024-01-26", "2024-01-29", "2024-01-30", "2024-01-31", "2024-02-01", "2024-02-02", "2024-02-05"}},
+		{frequencyWeeklyLast, []string{"2024-01-28", "2024-02-04", "2024-02-05"}},
+		{frequencyMonthlyLast, []string{"2024-01-31", "2024-02-05"}},
+	}
+	for _, tt := range tests {
+		if got := dates(Resample(series, tt.frequency)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Resample(%s) = %v, want %v", tt.frequency, got, tt.want)
+		}
+	}
+	if got := Resample(series, frequencyMonthlyLast); got[0].AdjClose != 6 {
+		t.Errorf("monthly_last AdjClose = %v, want the 2024-01-31 value 6", got[0].AdjClose)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// WindowReturn is the index return over one backtest window.
+type WindowReturn struct {
+	Start     string  `json:"start"`
+	End       string  `json:"end"`
+	ReturnPct float64 `json:"return_pct"`
+}
+
+// periodUnitDays is the number of calendar days in each period unit accepted
+// by parsePeriodDays. Months are approximated as 30 days.
+var periodUnitDays = map[byte]int{'d': 1, 'w': 7, 'm': 30, 'y': 365}
+
+// maxPeriodDays is the longest period accepted by parsePeriodDays, 50 years.
+const maxPeriodDays = 50 * 365
+
+// parsePeriodDays converts a period such as "30d", "2w", "6m" or "1y" to a
+// number of calendar days, at most maxPeriodDays.
+func parsePeriodDays(name, value string) (int, error) {
+	if len(value) >= 2 {
+		if days, ok := periodUnitDays[value[len(value)-1]]; ok {
+			if n, err := strconv.Atoi(value[:len(value)-1]); err == nil && n > 0 && n <= maxPeriodDays/days {
+				return n * days, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("invalid '%s' value '%s', expected a period such as 30d, 2w, 6m or 1y, up to 50y", name, value)
+}
+
+// BacktestPeriodHandler returns the index return over rolling windows, e.g.
+// /QUARTZ9/backtest/period?period=1y&step=30d&from=2019-01-02.
+func (a *App) BacktestPeriodHandler(w http.ResponseWriter, r *http.Request) {
+	symbol := strings.ToUpper(mux.Vars(r)["symbol"])
+	fund, ok := lookupFund(symbol)
+	if !ok {
+		http.Error(w, "Invalid symbol", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	period, step := query.Get("period"), query.Get("step")
+	if period == "" {
+		period = "1y"
+	}
+	if step == "" {
+		step = "30d"
+	}
+	windowDays, err := parsePeriodDays("period", period)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stepDays, err := parsePeriodDays("step", step)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, err := optionalDateParam(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	series, err := a.computeIndexSeries(r.Context(), fund, from, indexOptions{})
+	if err != nil {
+		http.Error(w, "Error computing index series", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rollingWindowBacktest(series, windowDays, stepDays))
+}
+
+// rollingWindowBacktest computes the return of every windowDays long window,
+// starting at the first date of the series and moving forward by stepDays.
+// Windows that would end after the last date are left out. A window boundary
+// that falls on a date without a point uses the last value before it.
+func rollingWindowBacktest(series []IndexData, windowDays, stepDays int) []WindowReturn {
+	windows := []WindowReturn{}
+	if len(series) == 0 || windowDays <= 0 || stepDays <= 0 {
+		return windows
+	}
+	first, err := time.Parse(time.DateOnly, series[0].Date)
+	if err != nil {
+		return windows
+	}
+	last, err := time.Parse(time.DateOnly, series[len(series)-1].Date)
+	if err != nil {
+		return windows
+	}
+
+	// Windows are compared as times, as the dates of a window past year 9999
+	// cannot be parsed back, and the loop ends if the date arithmetic
+	// overflows.
+	for start := first; !start.Before(first); start = start.AddDate(0, 0, stepDays) {
+		end := start.AddDate(0, 0, windowDays)
+		if end.After(last) || !end.After(start) {
+			break
+		}
+		startDate, endDate := start.Format(time.DateOnly), end.Format(time.DateOnly)
+		startValue, endValue := valueOn(series, startDate), valueOn(series, endDate)
+		if startValue == 0 {
+			continue
+		}
+		windows = append(windows, WindowReturn{
+			Start:     startDate,
+			End:       endDate,
+			ReturnPct: (endValue/startValue - 1) * 100,
+		})
+	}
+	return windows
+}
+
+// valueOn returns the index value on date, or on the last date before it.
+func valueOn(series []IndexData, date string) float64 {
+	value := 0.0
+	for _, data := range series {
+		if maxDateStr(data.Date, date) != date {
+			break
+		}
+		value = data.AdjClose
+	}
+	return value
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRollingWindowBacktestNonOverlapping(t *testing.T) {
+	// Ten daily points growing by 10 each day.
+	series := indexSeries("2021-01-01", 100, 110, 120, 130, 140, 150, 160, 170, 180, 190)
+	got := rollingWindowBacktest(series, 3, 3)
+	want := []WindowReturn{
+		{Start: "2021-01-01", End: "2021-01-04", ReturnPct: 30},
+		{Start: "2021-01-04", End: "2021-01-07", ReturnPct: 160.0/130*100 - 100},
+		{Start: "2021-01-07", End: "2021-01-10", ReturnPct: 190.0/160*100 - 100},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("len = %d, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].Start != want[i].Start || got[i].End != want[i].End || !almostEqual(got[i].ReturnPct, want[i].ReturnPct) {
+			t.Errorf("window %d = %+v, want %+v", i, got[i], want[i])
+		}
+		// With step == window each window starts where the previous ended.
+		if i > 0 && got[i].Start != got[i-1].End {
+			t.Errorf("window %d starts at %s, want %s", i, got[i].Start, got[i-1].End)
+		}
+	}
+}
+
+func TestRollingWindowBacktestOverlapping(t *testing.T) {
+	series := indexSeries("2021-01-01", 100, 110, 120, 130, 140, 150, 160, 170, 180, 190)
+	got := rollingWindowBacktest(series, 4, 2)
+	if len(got) != 3 {
+		t.Fatalf("len = %d, want 3: %+v", len(got), got)
+	}
+	for i := 1; i < len(got); i++ {
+		if maxDateStr(got[i].Start, got[i-1].End) != got[i-1].End || got[i].Start == got[i-1].End {
+			t.Errorf("window %d (%s) does not overlap window %d (ends %s)", i, got[i].Start, i-1, got[i-1].End)
+		}
+	}
+	if got[1].Start != "2021-01-03" || got[1].End != "2021-01-07" {
+		t.Errorf("window 1 = %+v, want 2021-01-03 to 2021-01-07", got[1])
+	}
+}
+
+func TestRollingWindowBacktestGap(t *testing.T) {
+	// 2021-01-03 is missing; the window uses the value of 2021-01-02.
+	series := []IndexData{
+		{Date: "2021-01-01", AdjClose: 100},
+		{Date: "2021-01-02", AdjClose: 120},
+		{Date: "2021-01-04", AdjClose: 150},
+	}
+	got := rollingWindowBacktest(series, 2, 2)
+	if len(got) != 1 || !almostEqual(got[0].ReturnPct, 20) {
+		t.Errorf("rollingWindowBacktest = %+v, want one window returning 20%%", got)
+	}
+}
+
+func TestRollingWindowBacktestLongPeriods(t *testing.T) {
+	series := []IndexData{
+		{Date: "2021-01-01", AdjClose: 100},
+		{Date: "2021-01-02", AdjClose: 120},
+	}
+	// Periods whose dates overflow must end the loop rather than spin.
+	for _, days := range [][2]int{{1, 3000000}, {3650000, 1}, {1, math.MaxInt}, {math.MaxInt, 1}} {
+		if got := rollingWindowBacktest(series, days[0], days[1]); len(got) > 1 {
+			t.Errorf("rollingWindowBacktest(window %d, step %d) = %+v, want at most one window", days[0], days[1], got)
+		}
+	}
+}
+
+func TestParsePeriodDays(t *testing.T) {
+	tests := map[string]int{"30d": 30, "2w": 14, "6m": 180, "1y": 365, "50y": maxPeriodDays}
+	for period, want := range tests {
+		if got, err := parsePeriodDays("period", period); err != nil || got != want {
+			t.Errorf("parsePeriodDays(%q) = %d, %v, want %d", period, got, err, want)
+		}
+	}
+	for _, period := range []string{"", "y", "0d", "-1y", "1x", "1.5y", "51y", "3000000d", "10000y"} {
+		if _, err := parsePeriodDays("period", period); err == nil {
+			t.Errorf("parsePeriodDays(%q) succeeded, want error", period)
+		}
+	}
+}
+
+func TestBacktestPeriodHandlerInvalid(t *testing.T) {
+	app := newTestApp(t)
+	for _, target := range []string{
+		"/QUARTZ1/backtest/period",
+		"/QUARTZ9/backtest/period?period=1q",
+		"/QUARTZ9/backtest/period?step=0d",
+		"/QUARTZ9/backtest/period?from=2021-02-30",
+	} {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: Code = %d, want %d", target, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxBlendTickers is the largest number of tickers a custom blend may contain.
+const maxBlendTickers = 5
+
+// blendTickers maps the query parameter names accepted by the blend endpoint
+// to their EOD tickers.
+var blendTickers = map[string]string{
+	"voo": "VOO.US",
+	"spy": "SPY.US",
+	"qqq": "QQQ.US",
+	"iwm": "IWM.US",
+	"tlt": "TLT.US",
+	"gld": "GLD.US",
+	"btc": "BTC-USD.CC",
+	"eth": "ETH-USD.CC",
+}
+
+// blendComponent is one ticker of a custom blend and its portfolio weight.
+type blendComponent struct {
+	Ticker string
+	Weight float64
+}
+
+// parseBlendComponents reads the ticker weights of a blend request. Every
+// query parameter other than from must be an allowed ticker, and the weights
+// must be positive and sum to 1.
+func parseBlendComponents(r *http.Request) ([]blendComponent, error) {
+	var components []blendComponent
+	total := 0.0
+	for name, values := range r.URL.Query() {
+		if name == "from" {
+			continue
+		}
+		ticker, ok := blendTickers[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("ticker '%s' is not allowed in a blend", name)
+		}
+		weight, err := strconv.ParseFloat(values[0], 64)
+		if err != nil || math.IsNaN(weight) || weight <= 0 || weight > 1 {
+			return nil, fmt.Errorf("invalid weight '%s' for '%s', expected a number between 0 and 1", values[0], name)
+		}
+		components = append(components, blendComponent{Ticker: ticker, Weight: weight})
+		total += weight
+	}
+	if len(components) == 0 {
+		return nil, fmt.Errorf("at least one ticker weight is required")
+	}
+	if len(components) > maxBlendTickers {
+		return nil, fmt.Errorf("a blend may contain at most %d tickers", maxBlendTickers)
+	}
+	if math.Abs(total-1) > 1e-6 {
+		return nil, fmt.Errorf("weights must sum to 1, got %g", total)
+	}
+	sort.Slice(components, func(i, j int) bool { return components[i].Ticker < components[j].Ticker })
+	return components, nil
+}
+
+// BlendHandler builds an index from a custom mix of allowed tickers, e.g.
+// /blend?voo=0.5&btc=0.3&gld=0.2&from=2020-01-01. The weights are the share
+// of the portfolio allocated to each ticker on the start date. Results are
+// not cached since the weights are user defined.
+func (a *App) BlendHandler(w http.ResponseWriter, r *http.Request) {
+	components, err := parseBlendComponents(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, err := optionalDateParam(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if from == "" {
+		from = fundInceptionDate
+	}
+
+	series, err := a.computeBlendSeries(r.Context(), components, from)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error computing blend: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(series)
+}
+
+// computeBlendSeries fetches the blend components and blends them from the
+// given date. Weights are converted to a number of units of each ticker so
+// that the blend uses the same logic as the fund index.
+func (a *App) computeBlendSeries(ctx context.Context, components []blendComponent, from string) ([]IndexData, error) {
+	data := make([][]StockData, len(components))
+	for i, component := range components {
+		stockData, err := a.PrepareSymbolJSONData(ctx, component.Ticker, fundInceptionDate, "")
+		if err != nil {
+			return nil, err
+		}
+		if len(stockData) == 0 {
+			return nil, fmt.Errorf("no data available for %s", component.Ticker)
+		}
+		data[i] = stockData
+	}
+
+	start := from
+	for _, stockData := range data {
+		start = maxDateStr(start, stockData[0].Date)
+	}
+	units := make([]float64, len(components))
+	for i, component := range components {
+		filled := forwardFillStockData(data[i], start, start, FillLast, false)
+		if len(filled) == 0 || filled[0].AdjClose == 0 {
+			return nil, fmt.Errorf("no %s price on %s", component.Ticker, start)
+		}
+		units[i] = component.Weight / filled[0].AdjClose
+	}
+	return blendIndex(data, units, start, FillLast, false, nil)
+}
@@ -0,0 +1,90 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBlendHandler(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 100, 100, 100, 100))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 20, 20, 20, 20, 20, 20))
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://example.com/blend?voo=0.5&btc=0.5", nil)
+	app.newRouter().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got []IndexData
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(got) != 7 {
+		t.Fatalf("len(index) = %d, want 7", len(got))
+	}
+	// Half the portfolio doubles while the other half is flat.
+	if got[0].AdjClose != 100 || !almostEqual(got[1].AdjClose, 150) {
+		t.Errorf("index = %v, %v; want 100, 150", got[0].AdjClose, got[1].AdjClose)
+	}
+}
+
+func TestBlendHandlerFrom(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 100, 100, 100, 100))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 20, 20, 20, 20, 40, 40))
+
+	rr := httptest.NewRecorder()
+	// 2019-01-05 is a Saturday; VOO is carried forward from Friday.
+	req := httptest.NewRequest("GET", "http://example.com/blend?voo=0.5&btc=0.5&from=2019-01-05", nil)
+	app.newRouter().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got []IndexData
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(got) != 4 || got[0].Date != "2019-01-05" {
+		t.Fatalf("index = %+v, want 4 points from 2019-01-05", got)
+	}
+	if !almostEqual(got[2].AdjClose, 150) {
+		t.Errorf("index[2] = %v, want 150", got[2].AdjClose)
+	}
+}
+
+func TestBlendHandlerInvalid(t *testing.T) {
+	app := newTestApp(t)
+	for _, query := range []string{
+		"",
+		"voo=1&xyz=0",
+		"voo=0.5&btc=0.4",
+		"voo=abc",
+		"voo=1.5&btc=-0.5",
+		"voo=0.2&btc=0.2&gld=0.2&eth=0.2&qqq=0.1&spy=0.1",
+		"voo=1&from=2020-13-01",
+	} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://example.com/blend?"+query, nil)
+		app.newRouter().ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: Code = %d, want %d", query, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
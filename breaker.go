@@ -0,0 +1,113 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// eodBreakerThreshold is the number of consecutive failed EOD calls
+	// after which the circuit breaker opens.
+	eodBreakerThreshold = 5
+	// eodBreakerCooldown is how long the breaker stays open before a probe
+	// call is let through.
+	eodBreakerCooldown = 30 * time.Second
+)
+
+// errCircuitOpen is returned instead of calling the EOD API while it is
+// failing.
+var errCircuitOpen = errors.New("circuit breaker open: EOD API calls are suspended")
+
+// circuitBreaker stops calls to a failing upstream. It is closed while calls
+// succeed and opens after threshold consecutive failures, rejecting calls
+// for the cooldown. It is then half-open: a single probe call is let through,
+// which closes the breaker if it succeeds and opens it again if it fails. A
+// nil breaker lets every call through. It is safe for concurrent use.
+type circuitBreaker struct {
+	threshold int32
+	cooldown  time.Duration
+	failures  atomic.Int32
+	// openedAt is when the breaker opened in Unix nanoseconds, 0 when it is
+	// closed, and probing whether the half-open probe is in flight.
+	openedAt atomic.Int64
+	probing  atomic.Bool
+	// now returns the current time; time.Now when nil.
+	now func() time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: int32(threshold), cooldown: cooldown}
+}
+
+func (b *circuitBreaker) currentTime() int64 {
+	if b.now != nil {
+		return b.now().UnixNano()
+	}
+	return time.Now().UnixNano()
+}
+
+// Allow returns errCircuitOpen if a call must not be made.
+func (b *circuitBreaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	openedAt := b.openedAt.Load()
+	if openedAt == 0 {
+		return nil
+	}
+	if b.currentTime()-openedAt < int64(b.cooldown) || !b.probing.CompareAndSwap(false, true) {
+		return errCircuitOpen
+	}
+	return nil
+}
+
+// Record updates the breaker with the outcome of a call it allowed.
+func (b *circuitBreaker) Record(err error) {
+	if b == nil {
+		return
+	}
+	if !breakerFailure(err) {
+		b.failures.Store(0)
+		b.openedAt.Store(0)
+		b.probing.Store(false)
+		return
+	}
+	if b.probing.Load() {
+		b.openedAt.Store(b.currentTime())
+		b.probing.Store(false)
+		return
+	}
+	if b.failures.Add(1) >= b.threshold {
+		b.openedAt.CompareAndSwap(0, b.currentTime())
+	}
+}
+
+// breakerFailure reports whether err shows that the upstream is failing.
+// Client errors such as an unknown symbol, and cancelled requests, do not.
+func breakerFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensOnFailingEOD(t *testing.T) {
+	var calls atomic.Int32
+	var healthy atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			http.Error(w, "upstream failure", http.StatusInternalServerError)
+			return
+		}
+		body, _ := json.Marshal(fixtureSeries("2019-01-02", true, 100, 101))
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	app := newTestApp(t)
+	app.eodBaseURL = srv.URL
+	app.eodBreaker = newCircuitBreaker(eodBreakerThreshold, eodBreakerCooldown)
+	app.eodBreaker.now = func() time.Time { return now }
+
+	fetch := func() error {
+		_, err := app.PrepareSymbolJSONData(context.Background(), "VOO.US", fundInceptionDate, "")
+		return err
+	}
+	for i := range eodBreakerThreshold {
+		if err := fetch(); err == nil || errors.Is(err, errCircuitOpen) {
+			t.Fatalf("call %d: err = %v, want an upstream error", i+1, err)
+		}
+	}
+	if got := calls.Load(); got != eodBreakerThreshold {
+		t.Fatalf("EOD calls = %d, want %d", got, eodBreakerThreshold)
+	}
+
+	// The breaker is open: calls fail without reaching the EOD API.
+	for range 3 {
+		if err := fetch(); !errors.Is(err, errCircuitOpen) || !errors.Is(err, errUpstreamUnavailable) {
+			t.Errorf("open breaker: err = %v, want errCircuitOpen", err)
+		}
+	}
+	if got := calls.Load(); got != eodBreakerThreshold {
+		t.Errorf("EOD calls while open = %d, want %d", got, eodBreakerThreshold)
+	}
+
+	// After the cooldown a single probe is let through; it fails and the
+	// breaker opens again.
+	now = now.Add(eodBreakerCooldown)
+	if err := fetch(); err == nil || errors.Is(err, errCircuitOpen) {
+		t.Errorf("probe: err = %v, want an upstream error", err)
+	}
+	if err := fetch(); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("after a failed probe: err = %v, want errCircuitOpen", err)
+	}
+	if got := calls.Load(); got != eodBreakerThreshold+1 {
+		t.Errorf("EOD calls = %d, want %d", got, eodBreakerThreshold+1)
+	}
+
+	// A successful probe closes the breaker.
+	healthy.Store(true)
+	now = now.Add(eodBreakerCooldown)
+	if err := fetch(); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if err := app.eodBreaker.Allow(); err != nil {
+		t.Errorf("Allow after a successful probe = %v, want nil", err)
+	}
+}
+
+func TestCircuitBreakerHalfOpenSingleProbe(t *testing.T) {
+	now := time.Unix(0, 1)
+	b := newCircuitBreaker(2, time.Second)
+	b.now = func() time.Time { return now }
+	b.Record(errors.New("timeout"))
+	if err := b.Allow(); err != nil {
+		t.Fatalf("Allow after one failure = %v, want nil", err)
+	}
+	// A client error does not count and resets the failures.
+	b.Record(&httpStatusError{StatusCode: http.StatusNotFound})
+	b.Record(errors.New("timeout"))
+	if err := b.Allow(); err != nil {
+		t.Fatalf("Allow after a reset = %v, want nil", err)
+	}
+	b.Record(errors.New("timeout"))
+	if err := b.Allow(); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("Allow after two failures = %v, want errCircuitOpen", err)
+	}
+
+	now = now.Add(time.Second)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("first half-open Allow = %v, want nil", err)
+	}
+	if err := b.Allow(); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("second half-open Allow = %v, want errCircuitOpen while the probe is in flight", err)
+	}
+
+	var nilBreaker *circuitBreaker
+	if err := nilBreaker.Allow(); err != nil {
+		t.Errorf("nil breaker Allow = %v, want nil", err)
+	}
+	nilBreaker.Record(errors.New("ignored"))
+}
@@ -0,0 +1,192 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// CacheBackend stores the daily EOD responses of every symbol.
+type CacheBackend interface {
+	// Read returns the data of symbol cached on date. It returns an error
+	// wrapping fs.ErrNotExist when nothing is cached, or errChecksumMismatch
+	// when the cached data is corrupt and has been discarded.
+	Read(symbol, date string) ([]byte, error)
+	// Write caches the data of symbol on date.
+	Write(symbol, date string, data []byte) error
+	// Delete removes the data of symbol cached on date. It returns an error
+	// wrapping fs.ErrNotExist when nothing is cached.
+	Delete(symbol, date string) error
+	// ModTime returns when the data of symbol on date was cached. It
+	// returns an error wrapping fs.ErrNotExist when nothing is cached.
+	ModTime(symbol, date string) (time.Time, error)
+	// Location describes where the data of symbol on date is cached, for
+	// logs and cache events.
+	Location(symbol, date string) string
+}
+
+// cacheObjectName is the name of the data of symbol on date relative to the
+// cache root, {symbol}/{date}.json.
+func cacheObjectName(symbol, date string) string {
+	return symbol + "/" + date + ".json"
+}
+
+// FileCacheBackend keeps the cache in a directory, such as the GCS volume
+// mount, with a checksum file next to every data file.
+type FileCacheBackend struct {
+	Dir string
+}
+
+// Read implements CacheBackend.
+func (b FileCacheBackend) Read(symbol, date string) ([]byte, error) {
+	path := b.Location(symbol, date)
+	data, err := readWithChecksum(path)
+	if errors.Is(err, errChecksumMismatch) {
+		removeWithChecksum(path)
+	}
+	return data, err
+}
+
+// Write implements CacheBackend.
+func (b FileCacheBackend) Write(symbol, date string, data []byte) error {
+	return writeWithChecksum(filepath.Join(b.Dir, symbol), date+".json", data)
+}
+
+// Delete implements CacheBackend.
+func (b FileCacheBackend) Delete(symbol, date string) error {
+	path := b.Location(symbol, date)
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	os.Remove(path + checksumSuffix)
+	return nil
+}
+
+// ModTime implements CacheBackend.
+func (b FileCacheBackend) ModTime(symbol, date string) (time.Time, error) {
+	info, err := os.Stat(b.Location(symbol, date))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// Location implements CacheBackend.
+func (b FileCacheBackend) Location(symbol, date string) string {
+	return b.Dir + "/" + cacheObjectName(symbol, date)
+}
+
+// gcsCacheTimeout bounds every call of GCSCacheBackend, which runs under
+// the lock of a symbol and must not hold it on a stalled connection.
+const gcsCacheTimeout = 30 * time.Second
+
+// GCSCacheBackend keeps the cache in a Cloud Storage bucket through the
+// native client, without a volume mount. Objects are verified with the
+// CRC32C checksum kept by Cloud Storage.
+type GCSCacheBackend struct {
+	bucket *storage.BucketHandle
+	name   string
+	store  cacheObjectStore
+}
+
+// newGCSCacheBackend connects to bucket with the application default
+// credentials, which are those of the Workload Identity service account on
+// Cloud Run and GKE.
+func newGCSCacheBackend(ctx context.Context, bucket string) (*GCSCacheBackend, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &GCSCacheBackend{bucket: client.Bucket(bucket), name: bucket, store: gcsObjectStore{client}}, nil
+}
+
+// Read implements CacheBackend.
+func (b *GCSCacheBackend) Read(symbol, date string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gcsCacheTimeout)
+	defer cancel()
+	r, err := b.bucket.Object(cacheObjectName(symbol, date)).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, fmt.Errorf("%w: %w", fs.ErrNotExist, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// Write implements CacheBackend.
+func (b *GCSCacheBackend) Write(symbol, date string, data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), gcsCacheTimeout)
+	defer cancel()
+	w := b.bucket.Object(cacheObjectName(symbol, date)).NewWriter(ctx)
+	w.ContentType = "application/json"
+	w.CRC32C = crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli))
+	w.SendCRC32C = true
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// Delete implements CacheBackend.
+func (b *GCSCacheBackend) Delete(symbol, date string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), gcsCacheTimeout)
+	defer cancel()
+	err := b.bucket.Object(cacheObjectName(symbol, date)).Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("%w: %w", fs.ErrNotExist, err)
+	}
+	return err
+}
+
+// ModTime implements CacheBackend.
+func (b *GCSCacheBackend) ModTime(symbol, date string) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gcsCacheTimeout)
+	defer cancel()
+	attrs, err := b.bucket.Object(cacheObjectName(symbol, date)).Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return time.Time{}, fmt.Errorf("%w: %w", fs.ErrNotExist, err)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return attrs.Updated, nil
+}
+
+// Location implements CacheBackend.
+func (b *GCSCacheBackend) Location(symbol, date string) string {
+	return "gs://" + b.name + "/" + cacheObjectName(symbol, date)
+}
+
+// cache returns the cache backend of the app, the cache directory unless
+// another backend is configured.
+func (a *App) cache() CacheBackend {
+	if a.cacheBackend != nil {
+		return a.cacheBackend
+	}
+	return FileCacheBackend{Dir: a.bucketCacheDirectory}
+}
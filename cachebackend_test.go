@@ -0,0 +1,138 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryCacheBackend is a CacheBackend kept in a map, standing in for a
+// bucket.
+type memoryCacheBackend struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	modTimes map[string]time.Time
+}
+
+func (b *memoryCacheBackend) Read(symbol, date string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, ok := b.objects[cacheObjectName(symbol, date)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", fs.ErrNotExist, cacheObjectName(symbol, date))
+	}
+	return data, nil
+}
+
+func (b *memoryCacheBackend) Write(symbol, date string, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.objects[cacheObjectName(symbol, date)] = data
+	if b.modTimes == nil {
+		b.modTimes = map[string]time.Time{}
+	}
+	b.modTimes[cacheObjectName(symbol, date)] = time.Now()
+	return nil
+}
+
+func (b *memoryCacheBackend) Delete(symbol, date string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.objects[cacheObjectName(symbol, date)]; !ok {
+		return fmt.Errorf("%w: %s", fs.ErrNotExist, cacheObjectName(symbol, date))
+	}
+	delete(b.objects, cacheObjectName(symbol, date))
+	return nil
+}
+
+func (b *memoryCacheBackend) ModTime(symbol, date string) (time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.modTimes[cacheObjectName(symbol, date)]
+	if !ok {
+		return time.Time{}, fmt.Errorf("%w: %s", fs.ErrNotExist, cacheObjectName(symbol, date))
+	}
+	return t, nil
+}
+
+func (b *memoryCacheBackend) Location(symbol, date string) string {
+	return "mem://" + cacheObjectName(symbol, date)
+}
+
+func TestFileCacheBackend(t *testing.T) {
+	backend := FileCacheBackend{Dir: t.TempDir()}
+	if _, err := backend.Read("VOO.US", "2024-01-10"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Read(missing) error = %v, want %v", err, fs.ErrNotExist)
+	}
+	if err := backend.Write("VOO.US", "2024-01-10", []byte("[]")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if data, err := backend.Read("VOO.US", "2024-01-10"); err != nil || string(data) != "[]" {
+		t.Errorf("Read = %q, %v, want []", data, err)
+	}
+
+	path := backend.Location("VOO.US", "2024-01-10")
+	if err := os.WriteFile(path, []byte("[{}]"), 0o644); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+	if _, err := backend.Read("VOO.US", "2024-01-10"); !errors.Is(err, errChecksumMismatch) {
+		t.Errorf("Read(corrupt) error = %v, want %v", err, errChecksumMismatch)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("corrupt file was not discarded: %v", err)
+	}
+}
+
+func TestPrepareSymbolJSONDataCacheBackend(t *testing.T) {
+	var calls int
+	data := fixtureSeries("2019-01-02", true, 100, 101)
+	app := newTestApp(t)
+	app.eodBaseURL = newEODServer(t, data, &calls).URL
+	backend := &memoryCacheBackend{objects: map[string][]byte{}}
+	app.cacheBackend = backend
+
+	if _, err := app.PrepareSymbolJSONData(context.Background(), "VOO.US", fundInceptionDate, ""); err != nil {
+		t.Fatalf("PrepareSymbolJSONData: %v", err)
+	}
+	today := time.Now().UTC().Format(time.DateOnly)
+	if _, ok := backend.objects["VOO.US/"+today+".json"]; !ok {
+		t.Fatalf("objects = %v, want VOO.US/%s.json", backend.objects, today)
+	}
+	if entries, _ := os.ReadDir(app.bucketCacheDirectory); len(entries) != 0 {
+		t.Errorf("cache directory has %d entries, want none with another backend", len(entries))
+	}
+
+	// A new instance reads the object instead of calling the EOD API.
+	other := newTestApp(t)
+	other.eodBaseURL = app.eodBaseURL
+	other.cacheBackend = backend
+	got, err := other.PrepareSymbolJSONData(context.Background(), "VOO.US", fundInceptionDate, "")
+	if err != nil {
+		t.Fatalf("PrepareSymbolJSONData: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("EOD API calls = %d, want 1", calls)
+	}
+	if len(got) != len(data) || got[1].AdjClose != data[1].AdjClose {
+		t.Errorf("PrepareSymbolJSONData = %+v, want %+v", got, data)
+	}
+}
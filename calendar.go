@@ -0,0 +1,136 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "time"
+
+// TradingCalendar reports which dates the equity market is open.
+type TradingCalendar struct {
+	// holidays is keyed by date in time.DateOnly format.
+	holidays map[string]bool
+}
+
+// NewUSTradingCalendar returns the NYSE trading calendar for the given years.
+func NewUSTradingCalendar(fromYear, toYear int) TradingCalendar {
+	calendar := TradingCalendar{holidays: make(map[string]bool)}
+	for year := fromYear; year <= toYear; year++ {
+		for _, holiday := range usMarketHolidays(year) {
+			calendar.holidays[holiday.Format(time.DateOnly)] = true
+		}
+	}
+	return calendar
+}
+
+// IsBusinessDay reports whether the market is open on date.
+func (c TradingCalendar) IsBusinessDay(date time.Time) bool {
+	if date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+		return false
+	}
+	return !c.holidays[date.Format(time.DateOnly)]
+}
+
+// nextBusinessDay returns date if the market is open on that day, otherwise the
+// first following weekday that is not a holiday.
+func nextBusinessDay(date time.Time, calendar TradingCalendar) time.Time {
+	for !calendar.IsBusinessDay(date) {
+		date = date.AddDate(0, 0, 1)
+	}
+	return date
+}
+
+// monthlyInvestmentDates returns the dollar-cost averaging schedule between
+// from and to: the first business day of every month.
+func monthlyInvestmentDates(from, to time.Time, calendar TradingCalendar) []time.Time {
+	var dates []time.Time
+	month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if month.Before(from) {
+		month = month.AddDate(0, 1, 0)
+	}
+	for ; !month.After(to); month = month.AddDate(0, 1, 0) {
+		date := nextBusinessDay(month, calendar)
+		if date.After(to) {
+			break
+		}
+		dates = append(dates, date)
+	}
+	return dates
+}
+
+// usMarketHolidays returns the full-day NYSE holidays of a year.
+func usMarketHolidays(year int) []time.Time {
+	date := func(month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	holidays := []time.Time{
+		nthWeekday(year, time.January, time.Monday, 3),  // Martin Luther King Jr. Day
+		nthWeekday(year, time.February, time.Monday, 3), // Washington's Birthday
+		easterSunday(year).AddDate(0, 0, -2),            // Good Friday
+		lastWeekday(year, time.May, time.Monday),        // Memorial Day
+		observed(date(time.July, 4)),
+		nthWeekday(year, time.September, time.Monday, 1),  // Labor Day
+		nthWeekday(year, time.November, time.Thursday, 4), // Thanksgiving
+		observed(date(time.December, 25)),
+	}
+	// The NYSE does not close on Friday when New Year's Day is a Saturday.
+	if newYear := date(time.January, 1); newYear.Weekday() != time.Saturday {
+		holidays = append(holidays, observed(newYear))
+	}
+	if year >= 2022 {
+		holidays = append(holidays, observed(date(time.June, 19))) // Juneteenth
+	}
+	return holidays
+}
+
+// observed moves a holiday falling on a weekend to the nearest weekday.
+func observed(date time.Time) time.Time {
+	switch date.Weekday() {
+	case time.Saturday:
+		return date.AddDate(0, 0, -1)
+	case time.Sunday:
+		return date.AddDate(0, 0, 1)
+	}
+	return date
+}
+
+// nthWeekday returns the n-th given weekday of a month.
+func nthWeekday(year int, month time.Month, weekday time.Weekday, n int) time.Time {
+	date := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	offset := (int(weekday) - int(date.Weekday()) + 7) % 7
+	return date.AddDate(0, 0, offset+7*(n-1))
+}
+
+// lastWeekday returns the last given weekday of a month.
+func lastWeekday(year int, month time.Month, weekday time.Weekday) time.Time {
+	date := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC)
+	offset := (int(date.Weekday()) - int(weekday) + 7) % 7
+	return date.AddDate(0, 0, -offset)
+}
+
+// easterSunday computes the date of Easter using the anonymous Gregorian
+// algorithm.
+func easterSunday(year int) time.Time {
+	a := year % 19
+	b, c := year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,64 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func mustDate(t testing.TB, date string) time.Time {
+	t.Helper()
+	d, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		t.Fatalf("time.Parse(%q): %v", date, err)
+	}
+	return d
+}
+
+func TestNextBusinessDay(t *testing.T) {
+	calendar := NewUSTradingCalendar(2021, 2024)
+	tests := []struct {
+		date, want string
+	}{
+		{"2022-01-03", "2022-01-03"}, // Monday
+		{"2021-05-01", "2021-05-03"}, // Saturday
+		{"2022-05-01", "2022-05-02"}, // Sunday
+		{"2022-07-04", "2022-07-05"}, // Independence Day
+		{"2024-03-29", "2024-04-01"}, // Good Friday
+		{"2021-12-24", "2021-12-27"}, // Christmas observed on Friday
+	}
+	for _, tc := range tests {
+		got := nextBusinessDay(mustDate(t, tc.date), calendar)
+		if got.Format(time.DateOnly) != tc.want {
+			t.Errorf("nextBusinessDay(%s) = %s, want %s", tc.date, got.Format(time.DateOnly), tc.want)
+		}
+	}
+}
+
+func TestMonthlyInvestmentDates(t *testing.T) {
+	calendar := NewUSTradingCalendar(2021, 2021)
+	got := monthlyInvestmentDates(mustDate(t, "2021-04-15"), mustDate(t, "2021-08-31"), calendar)
+	// May 1st is a Saturday and August 1st a Sunday.
+	want := []string{"2021-05-03", "2021-06-01", "2021-07-01", "2021-08-02"}
+	if len(got) != len(want) {
+		t.Fatalf("monthlyInvestmentDates = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].Format(time.DateOnly) != want[i] {
+			t.Errorf("date %d = %s, want %s", i, got[i].Format(time.DateOnly), want[i])
+		}
+	}
+}
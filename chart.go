@@ -0,0 +1,186 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxChartSeries is the largest number of series a chart request may contain.
+const maxChartSeries = 8
+
+// ChartDataset is one line of a chart. Data holds a value for every label,
+// or null where the series has no value on that date.
+type ChartDataset struct {
+	Label string     `json:"label"`
+	Data  []*float64 `json:"data"`
+}
+
+// ChartData is the data format expected by Chart.js.
+type ChartData struct {
+	Labels   []string       `json:"labels"`
+	Datasets []ChartDataset `json:"datasets"`
+}
+
+// chartTicker reports whether symbol is a raw ticker that may be charted
+// next to the funds.
+func chartTicker(symbol string) bool {
+	for _, ticker := range blendTickers {
+		if ticker == symbol {
+			return true
+		}
+	}
+	return false
+}
+
+// parseChartSymbols reads the comma separated symbols query parameter. Each
+// symbol is either a fund or a ticker allowed in a blend.
+func parseChartSymbols(r *http.Request) ([]string, error) {
+	v := r.URL.Query().Get("symbols")
+	if v == "" {
+		return nil, fmt.Errorf("missing 'symbols', expected a comma separated list")
+	}
+	var symbols []string
+	for _, symbol := range strings.Split(v, ",") {
+		symbol = strings.ToUpper(strings.TrimSpace(symbol))
+		if _, ok := lookupFund(symbol); !ok && !chartTicker(symbol) {
+			return nil, fmt.Errorf("invalid symbol '%s'", symbol)
+		}
+		symbols = append(symbols, symbol)
+	}
+	if len(symbols) > maxChartSeries {
+		return nil, fmt.Errorf("a chart may contain at most %d symbols", maxChartSeries)
+	}
+	return symbols, nil
+}
+
+// ChartDataHandler returns funds and tickers normalised to 100 on the same
+// start date in the Chart.js format, e.g.
+// /chart-data?symbols=QUARTZ9,VOO.US&from=2020-01-01.
+func (a *App) ChartDataHandler(w http.ResponseWriter, r *http.Request) {
+	symbols, err := parseChartSymbols(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, err := optionalDateParam(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	series, err := a.chartSeries(r.Context(), symbols, from)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error computing chart data: %v", err), http.StatusInternalServerError)
+		return
+	}
+	chart := toChartJSFormat(series)
+	orderDatasets(chart, symbols)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chart)
+}
+
+// chartSeries computes the series of every symbol concurrently and rebases
+// them to 100 on the later of from and the first date all series have a
+// value.
+func (a *App) chartSeries(ctx context.Context, symbols []string, from string) (map[string][]IndexData, error) {
+	series := make([][]IndexData, len(symbols))
+	errs := make([]error, len(symbols))
+	var wg sync.WaitGroup
+	for i, symbol := range symbols {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if fund, ok := lookupFund(symbol); ok {
+				series[i], errs[i] = a.computeIndexSeries(ctx, fund, "", indexOptions{})
+				return
+			}
+			data, err := a.PrepareSymbolJSONData(ctx, symbol, fundInceptionDate, "")
+			for _, d := range data {
+				series[i] = append(series[i], IndexData{Date: d.Date, AdjClose: d.AdjClose})
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+
+	start := from
+	for i, s := range series {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("%s: %w", symbols[i], errs[i])
+		}
+		if len(s) > 0 {
+			start = maxDateStr(start, s[0].Date)
+		}
+	}
+	rebased := make(map[string][]IndexData, len(symbols))
+	for i, symbol := range symbols {
+		rebased[symbol] = rebaseSeries(series[i], start)
+	}
+	return rebased, nil
+}
+
+// orderDatasets sorts the datasets of chart in the order of labels.
+func orderDatasets(chart ChartData, labels []string) {
+	order := make(map[string]int, len(labels))
+	for i, label := range labels {
+		order[label] = i
+	}
+	sort.SliceStable(chart.Datasets, func(i, j int) bool {
+		return order[chart.Datasets[i].Label] < order[chart.Datasets[j].Label]
+	})
+}
+
+// toChartJSFormat aligns the series on the sorted union of their dates. A
+// series without a value on a date gets null there. Datasets are sorted by
+// label.
+func toChartJSFormat(series map[string][]IndexData) ChartData {
+	dates := make(map[string]bool)
+	names := make([]string, 0, len(series))
+	for name, s := range series {
+		names = append(names, name)
+		for _, data := range s {
+			dates[data.Date] = true
+		}
+	}
+	sort.Strings(names)
+
+	chart := ChartData{Labels: make([]string, 0, len(dates)), Datasets: make([]ChartDataset, 0, len(series))}
+	for date := range dates {
+		chart.Labels = append(chart.Labels, date)
+	}
+	sort.Strings(chart.Labels)
+	position := make(map[string]int, len(chart.Labels))
+	for i, date := range chart.Labels {
+		position[date] = i
+	}
+
+	for _, name := range names {
+		dataset := ChartDataset{Label: name, Data: make([]*float64, len(chart.Labels))}
+		for _, data := range series[name] {
+			value := data.AdjClose
+			dataset.Data[position[data.Date]] = &value
+		}
+		chart.Datasets = append(chart.Datasets, dataset)
+	}
+	return chart
+}
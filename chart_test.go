@@ -0,0 +1,87 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestToChartJSFormat(t *testing.T) {
+	got := toChartJSFormat(map[string][]IndexData{
+		"VOO.US":  {{Date: "2021-01-01", AdjClose: 100}, {Date: "2021-01-04", AdjClose: 102}},
+		"QUARTZ9": indexSeries("2021-01-01", 100, 101, 102, 103),
+	})
+	wantLabels := []string{"2021-01-01", "2021-01-02", "2021-01-03", "2021-01-04"}
+	if !reflect.DeepEqual(got.Labels, wantLabels) {
+		t.Fatalf("labels = %v, want %v", got.Labels, wantLabels)
+	}
+	if len(got.Datasets) != 2 || got.Datasets[0].Label != "QUARTZ9" || got.Datasets[1].Label != "VOO.US" {
+		t.Fatalf("datasets = %+v, want QUARTZ9 and VOO.US", got.Datasets)
+	}
+	for _, dataset := range got.Datasets {
+		if len(dataset.Data) != len(wantLabels) {
+			t.Errorf("%s has %d values, want one per label", dataset.Label, len(dataset.Data))
+		}
+	}
+	voo := got.Datasets[1].Data
+	if voo[1] != nil || voo[2] != nil {
+		t.Errorf("VOO.US on the weekend = %v, %v, want null", voo[1], voo[2])
+	}
+	if voo[3] == nil || *voo[3] != 102 {
+		t.Errorf("VOO.US on 2021-01-04 = %v, want 102", voo[3])
+	}
+	if q := got.Datasets[0].Data[2]; q == nil || *q != 102 {
+		t.Errorf("QUARTZ9 on 2021-01-03 = %v, want 102", q)
+	}
+}
+
+func TestChartDataHandler(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101, 102, 103, 104))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 13, 14, 15, 16))
+
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/chart-data?symbols=quartz9,VOO.US&from=2019-01-03", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got ChartData
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(got.Labels) != 6 || got.Labels[0] != "2019-01-03" {
+		t.Errorf("labels = %v, want 2019-01-03 to 2019-01-08", got.Labels)
+	}
+	if len(got.Datasets) != 2 || got.Datasets[0].Label != "QUARTZ9" || got.Datasets[1].Label != "VOO.US" {
+		t.Fatalf("datasets = %+v, want QUARTZ9 then VOO.US", got.Datasets)
+	}
+	for _, dataset := range got.Datasets {
+		if dataset.Data[0] == nil || *dataset.Data[0] != 100 {
+			t.Errorf("%s starts at %v, want 100", dataset.Label, dataset.Data[0])
+		}
+	}
+}
+
+func TestParseChartSymbols(t *testing.T) {
+	for _, query := range []string{"", "symbols=QUARTZ9,AAPL.US", "symbols=QUARTZ9,QUARTZ9,QUARTZ9,QUARTZ9,QUARTZ9,QUARTZ9,QUARTZ9,QUARTZ9,QUARTZ9"} {
+		if _, err := parseChartSymbols(httptest.NewRequest("GET", "/chart-data?"+query, nil)); err == nil {
+			t.Errorf("parseChartSymbols(%q) succeeded, want error", query)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/logging"
+)
+
+// checksumSuffix is appended to the name of a cache file to get the name of
+// its checksum file.
+const checksumSuffix = ".sha256"
+
+// errChecksumMismatch is returned when a cache file does not match its
+// checksum.
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// writeWithChecksum writes data to dir/name and its SHA-256 to
+// dir/name.sha256, in the format used by sha256sum.
+func writeWithChecksum(dir, name string, data []byte) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	line := fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), name)
+	return os.WriteFile(path+checksumSuffix, []byte(line), 0o644)
+}
+
+// readWithChecksum reads the file at path and verifies it against its
+// checksum file. Files written before checksums were introduced have no
+// checksum file and are returned unverified.
+func readWithChecksum(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	line, err := os.ReadFile(path + checksumSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	want, _, _ := strings.Cut(strings.TrimSpace(string(line)), " ")
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return nil, fmt.Errorf("%w: %s has SHA-256 %s, want %s", errChecksumMismatch, path, got, want)
+	}
+	return data, nil
+}
+
+// logCorruptCache logs a checksum mismatch of the cache entry at location.
+func (a *App) logCorruptCache(ctx context.Context, location string, err error) {
+	a.logRequest(ctx, logging.Entry{
+		Severity: logging.Error,
+		Payload:  fmt.Sprintf("Discarding corrupt cache file '%s': %v", location, err),
+	})
+}
+
+// removeWithChecksum deletes a cache file and its checksum file.
+func removeWithChecksum(path string) {
+	os.Remove(path)
+	os.Remove(path + checksumSuffix)
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadWithChecksum(t *testing.T) {
+	dir := t.TempDir()
+	if err := writeWithChecksum(dir, "data.json", []byte("[]")); err != nil {
+		t.Fatalf("writeWithChecksum: %v", err)
+	}
+	path := filepath.Join(dir, "data.json")
+	if data, err := readWithChecksum(path); err != nil || string(data) != "[]" {
+		t.Errorf("readWithChecksum = %q, %v, want []", data, err)
+	}
+
+	if err := os.WriteFile(path, []byte("[{}]"), 0o644); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+	if _, err := readWithChecksum(path); !errors.Is(err, errChecksumMismatch) {
+		t.Errorf("readWithChecksum(corrupt) error = %v, want %v", err, errChecksumMismatch)
+	}
+
+	// Files without a checksum are read unverified.
+	os.Remove(path + checksumSuffix)
+	if data, err := readWithChecksum(path); err != nil || string(data) != "[{}]" {
+		t.Errorf("readWithChecksum(no checksum) = %q, %v", data, err)
+	}
+}
+
+func TestPrepareSymbolJSONDataRefetchesCorruptFile(t *testing.T) {
+	var calls int
+	data := fixtureSeries("2019-01-02", true, 100, 101)
+	app := newTestApp(t)
+	app.eodBaseURL = newEODServer(t, data, &calls).URL
+
+	if _, err := app.PrepareSymbolJSONData(context.Background(), "VOO.US", fundInceptionDate, ""); err != nil {
+		t.Fatalf("PrepareSymbolJSONData: %v", err)
+	}
+	path := filepath.Join(app.bucketCacheDirectory, "VOO.US", time.Now().UTC().Format(time.DateOnly)+".json")
+	if _, err := os.Stat(path + checksumSuffix); err != nil {
+		t.Fatalf("checksum file not written: %v", err)
+	}
+
+	// Flip a byte of the cached file.
+	body, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("os.ReadFile: %v", err)
+	}
+	body[len(body)/2] ^= 0x01
+	if err := os.WriteFile(path, body, 0o644); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+
+	got, err := app.PrepareSymbolJSONData(context.Background(), "VOO.US", fundInceptionDate, "")
+	if err != nil {
+		t.Fatalf("PrepareSymbolJSONData: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("EOD API calls = %d, want 2", calls)
+	}
+	if len(got) != len(data) || got[1].AdjClose != data[1].AdjClose {
+		t.Errorf("PrepareSymbolJSONData = %+v, want %+v", got, data)
+	}
+	if _, err := readWithChecksum(path); err != nil {
+		t.Errorf("re-fetched file does not verify: %v", err)
+	}
+}
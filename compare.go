@@ -0,0 +1,108 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ComparisonPoint holds the values of two funds on a date.
+type ComparisonPoint struct {
+	Date string  `json:"date"`
+	A    float64 `json:"a"`
+	B    float64 `json:"b"`
+}
+
+// compareFundParam reads a fund symbol from the named query parameter.
+func compareFundParam(r *http.Request, name string) (FundDefinition, error) {
+	v := strings.ToUpper(r.URL.Query().Get(name))
+	fund, ok := lookupFund(v)
+	if !ok {
+		return FundDefinition{}, fmt.Errorf("invalid '%s' value '%s', expected one of %s", name, v, strings.Join(fundSymbols, ", "))
+	}
+	return fund, nil
+}
+
+// alignComparison keeps the dates on or after from that both series have,
+// and rescales both to 100 on the first of them.
+func alignComparison(a, b []IndexData, from string) []ComparisonPoint {
+	values := make(map[string]float64, len(b))
+	for _, point := range b {
+		values[point.Date] = point.AdjClose
+	}
+	points := []ComparisonPoint{}
+	for _, point := range a {
+		v, ok := values[point.Date]
+		if !ok || maxDateStr(point.Date, from) != point.Date {
+			continue
+		}
+		points = append(points, ComparisonPoint{Date: point.Date, A: point.AdjClose, B: v})
+	}
+	if len(points) == 0 || points[0].A == 0 || points[0].B == 0 {
+		return points
+	}
+	baseA, baseB := points[0].A, points[0].B
+	for i := range points {
+		points[i].A = points[i].A / baseA * 100
+		points[i].B = points[i].B / baseB * 100
+	}
+	return points
+}
+
+// CompareHandler returns two funds normalised to 100 on their first shared
+// date, e.g. /compare?a=QUARTZ9&b=QUARTZ5&from=2020-01-01.
+func (a *App) CompareHandler(w http.ResponseWriter, r *http.Request) {
+	fundA, err := compareFundParam(r, "a")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fundB, err := compareFundParam(r, "b")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, err := optionalDateParam(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := optionalDateParam(r, "to")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if from != "" && to != "" && maxDateStr(from, to) != to {
+		http.Error(w, fmt.Sprintf("invalid date range: 'from' %s is after 'to' %s", from, to), http.StatusBadRequest)
+		return
+	}
+
+	seriesA, err := a.computeIndexSeries(r.Context(), fundA, "", indexOptions{To: to})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error computing %s: %v", fundA.Name, err), http.StatusInternalServerError)
+		return
+	}
+	seriesB, err := a.computeIndexSeries(r.Context(), fundB, "", indexOptions{To: to})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error computing %s: %v", fundB.Name, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alignComparison(seriesA, seriesB, from))
+}
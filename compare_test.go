@@ -0,0 +1,81 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAlignComparison(t *testing.T) {
+	a := indexSeries("2021-01-01", 100, 110, 121, 133.1)
+	b := indexSeries("2021-01-02", 50, 40, 60)
+	got := alignComparison(a, b, "")
+	want := []ComparisonPoint{
+		{Date: "2021-01-02", A: 100, B: 100},
+		{Date: "2021-01-03", A: 110, B: 80},
+		{Date: "2021-01-04", A: 121, B: 120},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("alignComparison = %+v, want %+v", got, want)
+	}
+	for i, w := range want {
+		if got[i].Date != w.Date || !almostEqual(got[i].A, w.A) || !almostEqual(got[i].B, w.B) {
+			t.Errorf("point %d = %+v, want %+v", i, got[i], w)
+		}
+	}
+	if got := alignComparison(a, b, "2021-01-03"); len(got) != 2 || got[0].A != 100 || got[0].B != 100 {
+		t.Errorf("from 2021-01-03: %+v, want two points starting at 100", got)
+	}
+}
+
+func TestCompareHandler(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101, 99, 103, 104))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 9, 14, 15, 16))
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/compare?"+query, nil))
+		return rr
+	}
+
+	rr := get("a=QUARTZ9&b=quartz5&from=2019-01-04&to=2019-01-07")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got []ComparisonPoint
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(got) != 4 || got[0].Date != "2019-01-04" || got[len(got)-1].Date != "2019-01-07" {
+		t.Fatalf("comparison = %+v, want 2019-01-04 to 2019-01-07", got)
+	}
+	if got[0].A != 100 || got[0].B != 100 {
+		t.Errorf("first point = %+v, want both at 100", got[0])
+	}
+	// BTC weighs more in QUARTZ5, so its fall on Saturday is larger.
+	if got[1].B >= got[1].A {
+		t.Errorf("2019-01-05: a = %v, b = %v, want b below a", got[1].A, got[1].B)
+	}
+
+	for _, query := range []string{"", "a=QUARTZ9", "a=QUARTZ9&b=SPY.US", "a=QUARTZ9&b=QUARTZ5&from=2019-01-07&to=2019-01-04", "a=QUARTZ9&b=QUARTZ5&to=soon"} {
+		if rr := get(query); rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: Code = %d, want %d", query, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
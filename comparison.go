@@ -0,0 +1,77 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// parseComparisonTickers reads the comma separated tickers query parameter.
+// Only the tickers allowed in a blend may be compared; funds are not
+// accepted since the comparison does not blend anything.
+func parseComparisonTickers(r *http.Request) ([]string, error) {
+	v := r.URL.Query().Get("tickers")
+	if v == "" {
+		return nil, fmt.Errorf("missing 'tickers', expected a comma separated list")
+	}
+	var tickers []string
+	for _, ticker := range strings.Split(v, ",") {
+		ticker = strings.ToUpper(strings.TrimSpace(ticker))
+		if !chartTicker(ticker) {
+			return nil, fmt.Errorf("ticker '%s' is not allowed", ticker)
+		}
+		tickers = append(tickers, ticker)
+	}
+	if len(tickers) > maxChartSeries {
+		return nil, fmt.Errorf("a comparison may contain at most %d tickers", maxChartSeries)
+	}
+	return tickers, nil
+}
+
+// RawComparisonHandler returns the raw prices of several tickers normalised
+// to 100 on the same base date in the Chart.js format, e.g.
+// /raw-comparison?tickers=SPY.US,QQQ.US&from=2020-01-01. The base date is the
+// later of from and the first date every ticker has a price. It is only
+// enabled with RAW_COMPARISON_ENABLED=true.
+func (a *App) RawComparisonHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.rawComparisonEnabled {
+		http.NotFound(w, r)
+		return
+	}
+	tickers, err := parseComparisonTickers(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, err := optionalDateParam(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	series, err := a.chartSeries(r.Context(), tickers, from)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error computing comparison: %v", err), http.StatusInternalServerError)
+		return
+	}
+	chart := toChartJSFormat(series)
+	orderDatasets(chart, tickers)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chart)
+}
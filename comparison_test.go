@@ -0,0 +1,64 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRawComparisonHandler(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "SPY.US", fixtureSeries("2019-01-02", false, 200, 210, 220))
+	writeFixture(t, app, "QQQ.US", fixtureSeries("2019-01-03", false, 50, 40))
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/raw-comparison?"+query, nil))
+		return rr
+	}
+
+	if rr := get("tickers=SPY.US"); rr.Code != http.StatusNotFound {
+		t.Errorf("disabled: Code = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+
+	app.rawComparisonEnabled = true
+	rr := get("tickers=qqq.us,SPY.US&from=2019-01-02")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got ChartData
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	// QQQ starts a day later, so both are rebased on 2019-01-03.
+	if len(got.Labels) != 2 || got.Labels[0] != "2019-01-03" {
+		t.Errorf("labels = %v, want 2019-01-03 and 2019-01-04", got.Labels)
+	}
+	if len(got.Datasets) != 2 || got.Datasets[0].Label != "QQQ.US" || got.Datasets[1].Label != "SPY.US" {
+		t.Fatalf("datasets = %+v, want QQQ.US then SPY.US", got.Datasets)
+	}
+	if v := got.Datasets[0].Data[1]; v == nil || *v != 80 {
+		t.Errorf("QQQ.US on 2019-01-04 = %v, want 80", v)
+	}
+
+	for _, query := range []string{"", "tickers=QUARTZ9", "tickers=AAPL.US", "tickers=SPY.US&from=2019-02-30"} {
+		if rr := get(query); rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: Code = %d, want %d", query, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ContributionSchedule is the amount invested on the first business day of
+// every month and of every year. Either may be zero.
+type ContributionSchedule struct {
+	Monthly float64
+	Annual  float64
+}
+
+// Contribution is the state of a simulated investment after contributing on
+// a date.
+type Contribution struct {
+	Date     string  `json:"date"`
+	Amount   float64 `json:"amount"`
+	Invested float64 `json:"invested"`
+	Value    float64 `json:"value"`
+}
+
+// ContributionResult is the outcome of investing a ContributionSchedule in an
+// index series.
+type ContributionResult struct {
+	TotalInvested float64        `json:"total_invested"`
+	FinalValue    float64        `json:"final_value"`
+	GainPct       float64        `json:"gain_pct"`
+	Contributions []Contribution `json:"contributions"`
+}
+
+// parseContributionSchedule parses ?simulate_contribution, e.g.
+// monthly:500,annual:6000.
+func parseContributionSchedule(v string) (ContributionSchedule, error) {
+	var schedule ContributionSchedule
+	seen := map[string]bool{}
+	for _, part := range strings.Split(v, ",") {
+		kind, amount, ok := strings.Cut(part, ":")
+		n, err := strconv.ParseFloat(amount, 64)
+		if !ok || err != nil || !(n > 0) || math.IsInf(n, 0) || seen[kind] {
+			return ContributionSchedule{}, fmt.Errorf("invalid 'simulate_contribution' value '%s', expected monthly:AMOUNT, annual:AMOUNT or both", v)
+		}
+		seen[kind] = true
+		switch kind {
+		case "monthly":
+			schedule.Monthly = n
+		case "annual":
+			schedule.Annual = n
+		default:
+			return ContributionSchedule{}, fmt.Errorf("invalid 'simulate_contribution' value '%s', expected monthly:AMOUNT, annual:AMOUNT or both", v)
+		}
+	}
+	return schedule, nil
+}
+
+// simulateContributions invests schedule in series, buying at the index value
+// of the first date on or after every contribution date. Monthly
+// contributions are made on the first business day of every month and annual
+// ones on the first business day of every year, over the dates of series.
+func simulateContributions(series []IndexData, schedule ContributionSchedule) ContributionResult {
+	result := ContributionResult{Contributions: []Contribution{}}
+	if len(series) == 0 {
+		return result
+	}
+	first, err := time.Parse(time.DateOnly, series[0].Date)
+	if err != nil {
+		return result
+	}
+	last, err := time.Parse(time.DateOnly, series[len(series)-1].Date)
+	if err != nil {
+		return result
+	}
+
+	units := 0.0
+	i := 0
+	calendar := NewUSTradingCalendar(first.Year(), last.Year())
+	for _, date := range monthlyInvestmentDates(first, last, calendar) {
+		amount := schedule.Monthly
+		if date.Month() == time.January {
+			amount += schedule.Annual
+		}
+		if amount == 0 {
+			continue
+		}
+		// Buy on the first date of the series on or after the contribution
+		// date.
+		day := date.Format(time.DateOnly)
+		for i < len(series) && series[i].Date != day && maxDateStr(series[i].Date, day) == day {
+			i++
+		}
+		if i == len(series) || series[i].AdjClose <= 0 {
+			break
+		}
+		units += amount / series[i].AdjClose
+		result.TotalInvested += amount
+		result.Contributions = append(result.Contributions, Contribution{
+			Date:     series[i].Date,
+			Amount:   amount,
+			Invested: result.TotalInvested,
+			Value:    units * series[i].AdjClose,
+		})
+	}
+	result.FinalValue = units * series[len(series)-1].AdjClose
+	if result.TotalInvested > 0 {
+		result.GainPct = (result.FinalValue/result.TotalInvested - 1) * 100
+	}
+	return result
+}
+
+// ContributionsHandler simulates regular contributions to a fund, e.g.
+// /QUARTZ9/dca?simulate_contribution=monthly:500,annual:6000.
+func (a *App) ContributionsHandler(w http.ResponseWriter, r *http.Request) {
+	symbol := strings.ToUpper(mux.Vars(r)["symbol"])
+	fund, ok := lookupFund(symbol)
+	if !ok {
+		writeJSONError(w, "Invalid symbol", http.StatusBadRequest)
+		return
+	}
+	v := r.URL.Query().Get("simulate_contribution")
+	if v == "" {
+		writeJSONError(w, "Missing simulate_contribution", http.StatusBadRequest)
+		return
+	}
+	schedule, err := parseContributionSchedule(v)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, err := optionalDateParam(r, "from")
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	series, err := a.computeIndexSeries(r.Context(), fund, from, indexOptions{})
+	if err != nil {
+		a.writeIndexError(r.Context(), w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(simulateContributions(series, schedule))
+}
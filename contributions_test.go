@@ -0,0 +1,108 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func dailyIndexSeries(from, to string, value float64) []IndexData {
+	start, _ := time.Parse(time.DateOnly, from)
+	end, _ := time.Parse(time.DateOnly, to)
+	var series []IndexData
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		series = append(series, IndexData{Date: d.Format(time.DateOnly), AdjClose: value})
+		value++
+	}
+	return series
+}
+
+func TestParseContributionSchedule(t *testing.T) {
+	got, err := parseContributionSchedule("monthly:500,annual:6000")
+	if err != nil || got != (ContributionSchedule{Monthly: 500, Annual: 6000}) {
+		t.Errorf("parseContributionSchedule = %+v, %v", got, err)
+	}
+	for _, v := range []string{"monthly", "weekly:10", "monthly:-1", "monthly:0", "monthly:1,monthly:2", "monthly:x"} {
+		if _, err := parseContributionSchedule(v); err == nil {
+			t.Errorf("parseContributionSchedule(%q) succeeded, want an error", v)
+		}
+	}
+}
+
+func TestSimulateContributionsTotalInvested(t *testing.T) {
+	// 2020-06-15 to 2022-03-31 spans 21 month starts (July 2020 to March
+	// 2022) and two year starts (2021 and 2022).
+	series := dailyIndexSeries("2020-06-15", "2022-03-31", 100)
+	result := simulateContributions(series, ContributionSchedule{Monthly: 500, Annual: 6000})
+
+	if want := 21*500.0 + 2*6000.0; result.TotalInvested != want {
+		t.Errorf("TotalInvested = %v, want %v", result.TotalInvested, want)
+	}
+	if got, want := len(result.Contributions), 21; got != want {
+		t.Errorf("len(Contributions) = %d, want %d", got, want)
+	}
+	if got := result.Contributions[6]; got.Date != "2021-01-04" || got.Amount != 6500 {
+		t.Errorf("January 2021 contribution = %+v, want 6500 on 2021-01-04", got)
+	}
+	if result.FinalValue <= result.TotalInvested || result.GainPct <= 0 {
+		t.Errorf("FinalValue = %v, GainPct = %v in a rising index", result.FinalValue, result.GainPct)
+	}
+
+	annual := simulateContributions(series, ContributionSchedule{Annual: 6000})
+	if annual.TotalInvested != 12000 || len(annual.Contributions) != 2 {
+		t.Errorf("annual only = %v over %d contributions, want 12000 over 2", annual.TotalInvested, len(annual.Contributions))
+	}
+}
+
+func TestContributionsHandler(t *testing.T) {
+	app := newTestApp(t)
+	closes := make([]float64, 400)
+	for i := range closes {
+		closes[i] = 100
+	}
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", false, closes...))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, closes...))
+
+	// From 2019-01-15 to 2020-02-05 there are 13 month starts, February
+	// 2019 to February 2020, and one year start on 2020-01-02.
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ9/dca?simulate_contribution=monthly:500,annual:6000&from=2019-01-15", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got ContributionResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if want := 13*500.0 + 6000; got.TotalInvested != want || !almostEqual(got.FinalValue, want) || !almostEqual(got.GainPct, 0) {
+		t.Errorf("result = invested %v, value %v, gain %v%%, want %v invested in a flat index", got.TotalInvested, got.FinalValue, got.GainPct, want)
+	}
+	if len(got.Contributions) != 13 || got.Contributions[0].Date != "2019-02-01" || got.Contributions[11].Amount != 6500 {
+		t.Errorf("contributions = %+v, want 13 from 2019-02-01 with 6500 in January 2020", got.Contributions)
+	}
+
+	for _, target := range []string{"/QUARTZ9/dca", "/QUARTZ9/dca?simulate_contribution=weekly:10", "/NOPE/dca?simulate_contribution=monthly:10"} {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		var body ErrorResponse
+		if rr.Code != http.StatusBadRequest || json.Unmarshal(rr.Body.Bytes(), &body) != nil || body.Code != http.StatusBadRequest {
+			t.Errorf("GET %s = %d %s, want a JSON %d error", target, rr.Code, rr.Body, http.StatusBadRequest)
+		}
+	}
+}
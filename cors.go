@@ -0,0 +1,106 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// CORSConfig selects the browser origins allowed to call the service.
+type CORSConfig struct {
+	// AllowedOrigins are the allowed origins, e.g. https://myapp.example.com,
+	// or * for any origin.
+	AllowedOrigins []string
+	// AllowCredentials lets browsers send cookies and auth headers. Allowed
+	// origins are then echoed back, as browsers require. It cannot be
+	// combined with *, which would let any site make credentialed requests.
+	AllowCredentials bool
+	// AllowedMethods are the methods answered to preflight requests.
+	AllowedMethods []string
+}
+
+// defaultCORSConfig allows any origin to read the service, as before origins
+// were configurable.
+var defaultCORSConfig = CORSConfig{
+	AllowedOrigins: []string{"*"},
+	AllowedMethods: []string{"GET", "POST", "OPTIONS"},
+}
+
+// parseCORSOrigins splits the comma separated CORS_ALLOWED_ORIGINS value,
+// defaulting to any origin when it is empty.
+func parseCORSOrigins(v string) []string {
+	var origins []string
+	for _, origin := range strings.Split(v, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	if len(origins) == 0 {
+		return []string{"*"}
+	}
+	return origins
+}
+
+// validate reports whether the config is safe to serve.
+func (c CORSConfig) validate() error {
+	if c.AllowCredentials && slices.Contains(c.AllowedOrigins, "*") {
+		return errors.New("CORS_ALLOW_CREDENTIALS requires CORS_ALLOWED_ORIGINS to list the allowed origins")
+	}
+	return nil
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for a request
+// from origin, or "" when the origin is not allowed. Any origin is allowed
+// as *, which browsers refuse for credentialed requests.
+func (c CORSConfig) allowOrigin(origin string) string {
+	if slices.Contains(c.AllowedOrigins, "*") {
+		return "*"
+	}
+	if origin != "" && slices.Contains(c.AllowedOrigins, origin) {
+		return origin
+	}
+	return ""
+}
+
+// corsMiddleware sets the CORS headers of the responses of next and answers
+// preflight requests. Requests from origins that are not allowed get no CORS
+// headers, so that browsers do not expose the response.
+func corsMiddleware(c CORSConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		allowed := c.allowOrigin(r.Header.Get("Origin"))
+		if allowed != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allowed)
+			if c.AllowCredentials && allowed != "*" {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+			w.Header().Set("Access-Control-Expose-Headers", requestIDHeader)
+		}
+		if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if allowed != "" {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(c.AllowedMethods, ", "))
+			if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestParseCORSOrigins(t *testing.T) {
+	if got := parseCORSOrigins(""); !slices.Equal(got, []string{"*"}) {
+		t.Errorf("parseCORSOrigins(\"\") = %v, want [*]", got)
+	}
+	got := parseCORSOrigins(" https://a.example.com, ,https://b.example.com")
+	if want := []string{"https://a.example.com", "https://b.example.com"}; !slices.Equal(got, want) {
+		t.Errorf("parseCORSOrigins = %v, want %v", got, want)
+	}
+}
+
+func TestCORSConfigValidate(t *testing.T) {
+	c := defaultCORSConfig
+	c.AllowCredentials = true
+	if err := c.validate(); err == nil {
+		t.Error("validate succeeded for any origin with credentials, want error")
+	}
+	c.AllowedOrigins = []string{"https://myapp.example.com"}
+	if err := c.validate(); err != nil {
+		t.Errorf("validate with an allowlist: %v", err)
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	allowlist := CORSConfig{
+		AllowedOrigins:   []string{"https://myapp.example.com"},
+		AllowCredentials: true,
+		AllowedMethods:   []string{"GET", "OPTIONS"},
+	}
+	wildcardCredentials := defaultCORSConfig
+	wildcardCredentials.AllowCredentials = true
+	tests := []struct {
+		name        string
+		config      CORSConfig
+		method      string
+		origin      string
+		wantCode    int
+		wantOrigin  string
+		wantMethods string
+	}{
+		{"default", defaultCORSConfig, "GET", "https://other.example.com", http.StatusOK, "*", ""},
+		{"default without origin", defaultCORSConfig, "GET", "", http.StatusOK, "*", ""},
+		{"wildcard with credentials", wildcardCredentials, "GET", "https://evil.example.com", http.StatusOK, "*", ""},
+		{"allowed", allowlist, "GET", "https://myapp.example.com", http.StatusOK, "https://myapp.example.com", ""},
+		{"not allowed", allowlist, "GET", "https://evil.example.com", http.StatusOK, "", ""},
+		{"preflight", allowlist, "OPTIONS", "https://myapp.example.com", http.StatusNoContent, "https://myapp.example.com", "GET, OPTIONS"},
+		{"preflight not allowed", allowlist, "OPTIONS", "https://evil.example.com", http.StatusNoContent, "", ""},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(tc.method, "/QUARTZ9", nil)
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		if tc.method == "OPTIONS" {
+			req.Header.Set("Access-Control-Request-Method", "GET")
+			req.Header.Set("Access-Control-Request-Headers", "Authorization")
+		}
+		rr := httptest.NewRecorder()
+		corsMiddleware(tc.config, ok).ServeHTTP(rr, req)
+
+		if rr.Code != tc.wantCode {
+			t.Errorf("%s: Code = %d, want %d", tc.name, rr.Code, tc.wantCode)
+		}
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tc.wantOrigin {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, want %q", tc.name, got, tc.wantOrigin)
+		}
+		if got := rr.Header().Get("Access-Control-Allow-Methods"); got != tc.wantMethods {
+			t.Errorf("%s: Access-Control-Allow-Methods = %q, want %q", tc.name, got, tc.wantMethods)
+		}
+		if got := rr.Header().Get("Vary"); got != "Origin" {
+			t.Errorf("%s: Vary = %q, want Origin", tc.name, got)
+		}
+		wantCredentials := tc.config.AllowCredentials && tc.wantOrigin != "" && tc.wantOrigin != "*"
+		if got := rr.Header().Get("Access-Control-Allow-Credentials") == "true"; got != wantCredentials {
+			t.Errorf("%s: Access-Control-Allow-Credentials = %v, want %v", tc.name, got, wantCredentials)
+		}
+	}
+}
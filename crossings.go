@@ -0,0 +1,79 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Crossing is a date on which the index crossed a target value.
+type Crossing struct {
+	Date      string `json:"date"`
+	Direction string `json:"direction"`
+}
+
+// CrossingsHandler returns the dates on which the index crossed a target
+// value, e.g. /QUARTZ9/crossings?target=150&from=2019-01-02.
+func (a *App) CrossingsHandler(w http.ResponseWriter, r *http.Request) {
+	symbol := strings.ToUpper(mux.Vars(r)["symbol"])
+	fund, ok := lookupFund(symbol)
+	if !ok {
+		http.Error(w, "Invalid symbol", http.StatusBadRequest)
+		return
+	}
+	v := r.URL.Query().Get("target")
+	target, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(target) || math.IsInf(target, 0) || target <= 0 {
+		http.Error(w, "invalid 'target' value '"+v+"', expected a positive number", http.StatusBadRequest)
+		return
+	}
+	from, err := optionalDateParam(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	series, err := a.computeIndexSeries(r.Context(), fund, from, indexOptions{})
+	if err != nil {
+		http.Error(w, "Error computing index series", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(findCrossings(series, target))
+}
+
+// findCrossings returns every date on which the index moved from below target
+// to at or above it ("up"), or from at or above target to below it ("down").
+// A point exactly at target counts as having reached it.
+func findCrossings(series []IndexData, target float64) []Crossing {
+	crossings := []Crossing{}
+	for i := 1; i < len(series); i++ {
+		wasAbove, isAbove := series[i-1].AdjClose >= target, series[i].AdjClose >= target
+		switch {
+		case !wasAbove && isAbove:
+			crossings = append(crossings, Crossing{Date: series[i].Date, Direction: "up"})
+		case wasAbove && !isAbove:
+			crossings = append(crossings, Crossing{Date: series[i].Date, Direction: "down"})
+		}
+	}
+	return crossings
+}
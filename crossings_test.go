@@ -0,0 +1,52 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestFindCrossings(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		want   []Crossing
+	}{
+		{"exact value counts as reached", []float64{149.99, 150, 150.01}, []Crossing{{"2021-01-02", "up"}}},
+		{"one tick below after reaching", []float64{150, 149.99}, []Crossing{{"2021-01-02", "down"}}},
+		{"one tick above from below", []float64{149.99, 150.01, 149.99}, []Crossing{{"2021-01-02", "up"}, {"2021-01-03", "down"}}},
+		{"never reached", []float64{100, 149.99, 120}, []Crossing{}},
+		{"starts above", []float64{160, 170, 150}, []Crossing{}},
+	}
+	for _, tc := range tests {
+		if got := findCrossings(indexSeries("2021-01-01", tc.values...), 150); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: findCrossings = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCrossingsHandlerInvalidTarget(t *testing.T) {
+	app := newTestApp(t)
+	for _, target := range []string{"/QUARTZ9/crossings", "/QUARTZ9/crossings?target=abc", "/QUARTZ9/crossings?target=-5"} {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: Code = %d, want %d", target, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// errorBudgetHours is the longest window the error budget covers.
+	errorBudgetHours = 30 * 24
+	// defaultErrorBudgetWindow is used when the caller gives no window.
+	defaultErrorBudgetWindow = 7 * 24 * time.Hour
+	// errorRateSLO is the error rate the service may have, as a fraction.
+	errorRateSLO = 0.01
+)
+
+// hourOutcomes counts the requests of one hour since the Unix epoch.
+type hourOutcomes struct {
+	hour    int64
+	total   int64
+	success int64
+}
+
+// ErrorBudget counts request outcomes in a circular buffer of hours. It is
+// safe for concurrent use.
+type ErrorBudget struct {
+	mu    sync.Mutex
+	hours [errorBudgetHours]hourOutcomes
+	// now returns the current time; time.Now when nil.
+	now func() time.Time
+}
+
+func (b *ErrorBudget) currentHour() int64 {
+	now := time.Now
+	if b.now != nil {
+		now = b.now
+	}
+	return now().Unix() / 3600
+}
+
+// Record counts a request that succeeded or failed in the current hour.
+func (b *ErrorBudget) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	hour := b.currentHour()
+	slot := &b.hours[hour%errorBudgetHours]
+	if slot.hour != hour {
+		*slot = hourOutcomes{hour: hour}
+	}
+	slot.total++
+	if success {
+		slot.success++
+	}
+}
+
+// ErrorBudgetReport is the body of the /admin/error-budget endpoint. The
+// budget is the error rate allowed by the SLO; the remaining budget is
+// negative once it is exceeded.
+type ErrorBudgetReport struct {
+	TotalRequests      int64   `json:"total_requests"`
+	SuccessfulRequests int64   `json:"successful_requests"`
+	ErrorRatePct       float64 `json:"error_rate_pct"`
+	BudgetConsumedPct  float64 `json:"budget_consumed_pct"`
+	BudgetRemainingPct float64 `json:"budget_remaining_pct"`
+}
+
+// Report sums the requests of the current hour and of the hours before it
+// that fall within window.
+func (b *ErrorBudget) Report(window time.Duration) ErrorBudgetReport {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	hour := b.currentHour()
+	hours := int64(window / time.Hour)
+	var report ErrorBudgetReport
+	for _, slot := range b.hours {
+		if slot.hour > hour-hours && slot.hour <= hour {
+			report.TotalRequests += slot.total
+			report.SuccessfulRequests += slot.success
+		}
+	}
+	report.BudgetRemainingPct = 100
+	if report.TotalRequests > 0 {
+		errorRate := float64(report.TotalRequests-report.SuccessfulRequests) / float64(report.TotalRequests)
+		report.ErrorRatePct = errorRate * 100
+		report.BudgetConsumedPct = errorRate / errorRateSLO * 100
+		report.BudgetRemainingPct = 100 - report.BudgetConsumedPct
+	}
+	return report
+}
+
+// parseErrorBudgetWindow reads the window query parameter, a number of days
+// such as 7d or a duration in whole hours such as 36h.
+func parseErrorBudgetWindow(r *http.Request) (time.Duration, error) {
+	v := r.URL.Query().Get("window")
+	if v == "" {
+		return defaultErrorBudgetWindow, nil
+	}
+	var window time.Duration
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid 'window' value '%s', expected a number of days such as 7d", v)
+		}
+		window = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, fmt.Errorf("invalid 'window' value '%s', expected a number of days such as 7d", v)
+		}
+		window = d
+	}
+	if window < time.Hour || window > errorBudgetHours*time.Hour || window%time.Hour != 0 {
+		return 0, fmt.Errorf("invalid 'window' value '%s', expected whole hours up to %dd", v, errorBudgetHours/24)
+	}
+	return window, nil
+}
+
+// trackErrorBudget records whether every request succeeded. Server errors
+// consume the budget; client errors do not.
+func (a *App) trackErrorBudget(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		a.errorBudget.Record(rec.status < 500)
+	})
+}
+
+// ErrorBudgetHandler reports the share of requests that succeeded within the
+// window, e.g. /admin/error-budget?window=7d, against the error rate SLO.
+func (a *App) ErrorBudgetHandler(w http.ResponseWriter, r *http.Request) {
+	window, err := parseErrorBudgetWindow(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var report ErrorBudgetReport
+	if a.errorBudget != nil {
+		report = a.errorBudget.Report(window)
+	} else {
+		report.BudgetRemainingPct = 100
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
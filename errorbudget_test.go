@@ -0,0 +1,110 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestErrorBudgetReport(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 30, 0, 0, time.UTC)
+	b := &ErrorBudget{now: func() time.Time { return now }}
+	// 5000 requests with 20 failures: a 0.4% error rate uses 40% of the
+	// 1% budget.
+	for i := range 5000 {
+		b.Record(i >= 20)
+	}
+	got := b.Report(7 * 24 * time.Hour)
+	want := ErrorBudgetReport{TotalRequests: 5000, SuccessfulRequests: 4980, ErrorRatePct: 0.4, BudgetConsumedPct: 40, BudgetRemainingPct: 60}
+	if got.TotalRequests != want.TotalRequests || got.SuccessfulRequests != want.SuccessfulRequests ||
+		!almostEqual(got.ErrorRatePct, want.ErrorRatePct) || !almostEqual(got.BudgetConsumedPct, want.BudgetConsumedPct) ||
+		!almostEqual(got.BudgetRemainingPct, want.BudgetRemainingPct) {
+		t.Errorf("Report = %+v, want %+v", got, want)
+	}
+
+	// Two days later, with a 2% error rate, the older requests fall out
+	// of a one day window and the budget is overspent.
+	now = now.Add(48 * time.Hour)
+	for i := range 100 {
+		b.Record(i >= 2)
+	}
+	got = b.Report(24 * time.Hour)
+	if got.TotalRequests != 100 || !almostEqual(got.BudgetConsumedPct, 200) || !almostEqual(got.BudgetRemainingPct, -100) {
+		t.Errorf("Report(1d) = %+v, want 100 requests and 200%% consumed", got)
+	}
+	if got := b.Report(7 * 24 * time.Hour); got.TotalRequests != 5100 {
+		t.Errorf("Report(7d).TotalRequests = %d, want 5100", got.TotalRequests)
+	}
+
+	// A slot reused by a later hour drops the counts of the earlier one.
+	now = now.Add(errorBudgetHours * time.Hour)
+	b.Record(true)
+	if got := b.Report(errorBudgetHours * time.Hour); got.TotalRequests != 1 || got.BudgetRemainingPct != 100 {
+		t.Errorf("Report after wrap-around = %+v, want 1 successful request", got)
+	}
+}
+
+func TestErrorBudgetHandler(t *testing.T) {
+	app := newTestApp(t)
+	app.adminToken = "secret"
+	app.errorBudget = &ErrorBudget{}
+	router := app.newRouter()
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/routes", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/UNKNOWN", nil))
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/admin/error-budget", http.StatusOK},
+		{"/admin/error-budget?window=7d", http.StatusOK},
+		{"/admin/error-budget?window=36h", http.StatusOK},
+		{"/admin/error-budget?window=90m", http.StatusBadRequest},
+		{"/admin/error-budget?window=31d", http.StatusBadRequest},
+		{"/admin/error-budget?window=week", http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest("GET", tc.target, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Errorf("GET %s: Code = %d, want %d: %s", tc.target, rr.Code, tc.want, rr.Body)
+			continue
+		}
+		if rr.Code != http.StatusOK {
+			continue
+		}
+		var got ErrorBudgetReport
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatalf("json.Unmarshal: %v", err)
+		}
+		// The 400 of the unknown symbol is a client error and does not
+		// consume the budget.
+		if got.TotalRequests < 2 || got.SuccessfulRequests != got.TotalRequests {
+			t.Errorf("GET %s: report = %+v, want only successful requests", tc.target, got)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/error-budget", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("without token: Code = %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
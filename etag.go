@@ -0,0 +1,85 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// cacheModTime returns when the cached data of the components of fund was
+// last written, today's or, with stale-while-revalidate, the previous day's.
+// ok is false when the data of a component is not cached.
+func (a *App) cacheModTime(fund FundDefinition) (modTime time.Time, ok bool) {
+	now := time.Now().UTC()
+	dates := []string{now.Format(time.DateOnly)}
+	if a.staleThreshold > 0 {
+		dates = append(dates, now.AddDate(0, 0, -1).Format(time.DateOnly))
+	}
+	for _, symbol := range fund.Symbols() {
+		found := false
+		for _, date := range dates {
+			if t, err := a.cache().ModTime(symbol, date); err == nil {
+				if t.After(modTime) {
+					modTime = t
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return time.Time{}, false
+		}
+	}
+	return modTime, true
+}
+
+// indexETag identifies the response to r built from data cached at modTime.
+// The query and the Accept header select the content of the response.
+func indexETag(r *http.Request, modTime time.Time) string {
+	h := sha256.New()
+	h.Write([]byte(r.URL.Path + "\n" + r.URL.RawQuery + "\n" + r.Header.Get("Accept") + "\n" + modTime.UTC().Format(time.RFC3339Nano)))
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// etagMatches reports whether the If-None-Match header value matches etag,
+// using the weak comparison of RFC 9110.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// setCacheValidators sets the ETag and Last-Modified headers of the index
+// response to r, when the data of every component of fund is cached. It
+// reports whether the client already has that response, in which case only
+// 304 Not Modified needs to be written.
+func (a *App) setCacheValidators(w http.ResponseWriter, r *http.Request, fund FundDefinition) (notModified bool) {
+	modTime, ok := a.cacheModTime(fund)
+	if !ok {
+		return false
+	}
+	etag := indexETag(r, modTime)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	return etagMatches(r.Header.Get("If-None-Match"), etag)
+}
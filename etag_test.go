@@ -0,0 +1,111 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`"abc"`, true},
+		{`W/"abc"`, true},
+		{`"xyz", "abc"`, true},
+		{`*`, true},
+		{`"xyz"`, false},
+		{``, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, `"abc"`); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestHandlerETag(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101, 102))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 13))
+
+	get := func(target, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := get("/QUARTZ9", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Header().Get("Last-Modified") == "" {
+		t.Fatalf("status = %d, ETag = %q, Last-Modified = %q, want 200 with both headers", first.Code, etag, first.Header().Get("Last-Modified"))
+	}
+
+	rr := get("/QUARTZ9", etag)
+	if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Errorf("status = %d with %d bytes, want 304 without a body", rr.Code, rr.Body.Len())
+	}
+	if got := rr.Header().Get("ETag"); got != etag {
+		t.Errorf("ETag = %q, want %q", got, etag)
+	}
+
+	// Other parameters are another response.
+	if rr := get("/QUARTZ9?group_by=year", etag); rr.Code != http.StatusOK {
+		t.Errorf("group_by=year: status = %d, want 200", rr.Code)
+	}
+
+	// So is the data cached again.
+	today := time.Now().UTC().Format(time.DateOnly)
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(app.bucketCacheDirectory, "VOO.US", today+".json"), later, later); err != nil {
+		t.Fatalf("os.Chtimes: %v", err)
+	}
+	if rr := get("/QUARTZ9", etag); rr.Code != http.StatusOK || rr.Header().Get("ETag") == etag {
+		t.Errorf("after a new fetch: status = %d, ETag = %q, want 200 with a new ETag", rr.Code, rr.Header().Get("ETag"))
+	}
+}
+
+// BenchmarkHandlerNotModified measures a poll of an unchanged index, which
+// neither computes nor encodes the index.
+func BenchmarkHandlerNotModified(b *testing.B) {
+	app := newTestApp(b)
+	writeFixture(b, app, "VOO.US", benchmarkSeries(5*252, true))
+	writeFixture(b, app, "BTC-USD.CC", benchmarkSeries(5*365, false))
+	router := app.newRouter()
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ9", nil))
+	etag := rr.Header().Get("ETag")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest("GET", "/QUARTZ9", nil)
+		req.Header.Set("If-None-Match", etag)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotModified {
+			b.Fatalf("status = %d, want 304", rr.Code)
+		}
+	}
+}
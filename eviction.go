@@ -0,0 +1,208 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"github.com/gorilla/mux"
+)
+
+// cacheEvictionInterval is how often expired cache files are deleted.
+const cacheEvictionInterval = time.Hour
+
+// symbolLocks hands out a read-write lock per symbol. Reads of the cache
+// files of a symbol hold the read lock, and eviction holds the write lock so
+// that it never deletes a file that is being read. The zero value is ready
+// to use.
+type symbolLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.RWMutex
+}
+
+// forSymbol returns the lock of symbol.
+func (l *symbolLocks) forSymbol(symbol string) *sync.RWMutex {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.locks == nil {
+		l.locks = make(map[string]*sync.RWMutex)
+	}
+	lock, ok := l.locks[symbol]
+	if !ok {
+		lock = &sync.RWMutex{}
+		l.locks[symbol] = lock
+	}
+	return lock
+}
+
+// gracefulCacheEviction deletes the price files of every symbol dated before
+// the given date, together with their checksum files. It waits for ongoing
+// reads of a symbol to complete before deleting its files, and returns the
+// number of files deleted. Only the file backend is evicted; the objects of
+// a bucket cache expire with its retention policy instead.
+func (a *App) gracefulCacheEviction(before string) (int, error) {
+	backend, ok := a.cache().(FileCacheBackend)
+	if !ok {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(backend.Dir)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, entry := range entries {
+		// Split data lives in its own directory and is not read through
+		// PrepareSymbolJSONData.
+		if !entry.IsDir() || entry.Name() == "splits" {
+			continue
+		}
+		n, err := a.evictSymbol(backend.Dir, entry.Name(), before)
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// evictSymbol deletes the price files of symbol in the cache directory dir
+// dated before the given date while holding the write lock of symbol.
+func (a *App) evictSymbol(dir, symbol, before string) (int, error) {
+	lock := a.cacheLocks.forSymbol(symbol)
+	lock.Lock()
+	defer lock.Unlock()
+
+	dir = filepath.Join(dir, symbol)
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, file := range files {
+		date, ok := strings.CutSuffix(file.Name(), ".json")
+		if !ok {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, date); err != nil || date == before || minDateStr(date, before) != date {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, err
+		}
+		os.Remove(path + checksumSuffix)
+		removed++
+	}
+	return removed, nil
+}
+
+// runCacheEviction deletes the cache files of previous days every interval
+// until ctx is done. Only today's files are ever read, and the previous day's
+// with stale-while-revalidate.
+func (a *App) runCacheEviction(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		today := time.Now().UTC().Format(time.DateOnly)
+		if a.staleThreshold > 0 {
+			today = time.Now().UTC().AddDate(0, 0, -1).Format(time.DateOnly)
+		}
+		removed, err := a.gracefulCacheEviction(today)
+		if err != nil {
+			a.log.Log(logging.Entry{
+				Severity: logging.Warning,
+				Payload:  fmt.Sprintf("cache eviction: %v", err),
+			})
+			continue
+		}
+		if removed > 0 {
+			a.log.Log(logging.Entry{
+				Severity: logging.Info,
+				Payload:  fmt.Sprintf("cache eviction deleted %d files before %s", removed, today),
+			})
+		}
+	}
+}
+
+// invalidateCache deletes the data of symbol cached on date, along with the
+// series kept in memory, so that the next read fetches it again. It returns
+// an error wrapping fs.ErrNotExist when nothing was cached on date.
+func (a *App) invalidateCache(symbol, date string) error {
+	lock := a.cacheLocks.forSymbol(symbol)
+	lock.Lock()
+	defer lock.Unlock()
+	a.memCache.Remove(cacheObjectName(symbol, date))
+	return a.cache().Delete(symbol, date)
+}
+
+// CacheInvalidateHandler deletes today's cached data of a fund's components
+// or of a ticker, or that of ?date, e.g. DELETE /QUARTZ9/cache. It returns
+// 404 when none of them had data cached on that date.
+func (a *App) CacheInvalidateHandler(w http.ResponseWriter, r *http.Request) {
+	symbol := strings.ToUpper(mux.Vars(r)["symbol"])
+	symbols := []string{symbol}
+	if fund, ok := lookupFund(symbol); ok {
+		symbols = fund.Symbols()
+	} else if !chartTicker(symbol) {
+		http.Error(w, "Invalid symbol", http.StatusBadRequest)
+		return
+	}
+	date := time.Now().UTC().Format(time.DateOnly)
+	if v := r.URL.Query().Get("date"); v != "" {
+		day, err := validateDateParam("date", v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		date = day.Format(time.DateOnly)
+	}
+
+	deleted := 0
+	for _, ticker := range symbols {
+		err := a.invalidateCache(ticker, date)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error deleting cached data of %s: %v", ticker, err), http.StatusInternalServerError)
+			return
+		}
+		deleted++
+	}
+	if deleted == 0 {
+		http.Error(w, "No cached data for date", http.StatusNotFound)
+		return
+	}
+	a.logRequest(r.Context(), logging.Entry{
+		Severity: logging.Info,
+		Payload:  fmt.Sprintf("invalidated the cache of %s on %s", strings.Join(symbols, ", "), date),
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,192 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGracefulCacheEviction(t *testing.T) {
+	app := newTestApp(t)
+	for _, file := range []struct{ dir, name string }{
+		{"VOO.US", "2024-01-10.json"},
+		{"VOO.US", "2024-01-15.json"},
+		{"BTC-USD.CC", "2024-01-14.json"},
+		{filepath.Join("splits", "VOO.US"), "2024-01-10.json"},
+	} {
+		if err := writeWithChecksum(filepath.Join(app.bucketCacheDirectory, file.dir), file.name, []byte("[]")); err != nil {
+			t.Fatalf("writeWithChecksum: %v", err)
+		}
+	}
+
+	removed, err := app.gracefulCacheEviction("2024-01-15")
+	if err != nil {
+		t.Fatalf("gracefulCacheEviction: %v", err)
+	}
+	if removed != 2 {
+		t.Errorf("removed = %d, want 2", removed)
+	}
+	for path, wantExists := range map[string]bool{
+		"VOO.US/2024-01-10.json":        false,
+		"VOO.US/2024-01-10.json.sha256": false,
+		"VOO.US/2024-01-15.json":        true,
+		"BTC-USD.CC/2024-01-14.json":    false,
+		"splits/VOO.US/2024-01-10.json": true,
+	} {
+		_, err := os.Stat(filepath.Join(app.bucketCacheDirectory, path))
+		if exists := !errors.Is(err, fs.ErrNotExist); exists != wantExists {
+			t.Errorf("%s exists = %v, want %v", path, exists, wantExists)
+		}
+	}
+}
+
+func TestGracefulCacheEvictionWaitsForReads(t *testing.T) {
+	app := newTestApp(t)
+	dir := filepath.Join(app.bucketCacheDirectory, "VOO.US")
+	if err := writeWithChecksum(dir, "2024-01-10.json", []byte("[]")); err != nil {
+		t.Fatalf("writeWithChecksum: %v", err)
+	}
+
+	// Hold the read lock as PrepareSymbolJSONData does while reading.
+	lock := app.cacheLocks.forSymbol("VOO.US")
+	lock.RLock()
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := app.gracefulCacheEviction("2024-01-15"); err != nil {
+			t.Errorf("gracefulCacheEviction: %v", err)
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("eviction completed while a read was in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if _, err := os.Stat(filepath.Join(dir, "2024-01-10.json")); err != nil {
+		t.Errorf("file deleted during a read: %v", err)
+	}
+
+	lock.RUnlock()
+	wg.Wait()
+	if _, err := os.Stat(filepath.Join(dir, "2024-01-10.json")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("file not deleted after the read completed: %v", err)
+	}
+}
+
+func TestGracefulCacheEvictionBucketBackend(t *testing.T) {
+	app := newTestApp(t)
+	if err := writeWithChecksum(filepath.Join(app.bucketCacheDirectory, "VOO.US"), "2024-01-10.json", []byte("[]")); err != nil {
+		t.Fatalf("writeWithChecksum: %v", err)
+	}
+	// A bucket cache expires with its retention policy, so the local
+	// directory is left alone.
+	app.cacheBackend = &memoryCacheBackend{objects: map[string][]byte{}}
+	if removed, err := app.gracefulCacheEviction("2024-01-15"); removed != 0 || err != nil {
+		t.Errorf("gracefulCacheEviction = %d, %v, want 0, nil", removed, err)
+	}
+	if _, err := os.Stat(filepath.Join(app.bucketCacheDirectory, "VOO.US", "2024-01-10.json")); err != nil {
+		t.Errorf("cache directory was evicted: %v", err)
+	}
+}
+
+func TestCacheInvalidateHandler(t *testing.T) {
+	var calls int
+	app := newTestApp(t)
+	app.adminToken = "secret"
+	app.memCache = newMemoryCache(1<<20, 0)
+	app.eodBaseURL = newEODServer(t, fixtureSeries("2019-01-02", false, 100, 101, 102), &calls).URL
+
+	do := func(method, target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, req)
+		return rr
+	}
+	for range 2 {
+		if rr := do("GET", "/QUARTZ9", ""); rr.Code != http.StatusOK {
+			t.Fatalf("GET: Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("EOD API calls = %d, want 2", calls)
+	}
+
+	if rr := do("DELETE", "/QUARTZ9/cache", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("DELETE without token: Code = %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := do("DELETE", "/QUARTZ9/cache", "secret"); rr.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: Code = %d, want %d: %s", rr.Code, http.StatusNoContent, rr.Body)
+	}
+	if _, err := os.Stat(filepath.Join(app.bucketCacheDirectory, "VOO.US", time.Now().UTC().Format(time.DateOnly)+".json")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("cache file still exists: %v", err)
+	}
+	if rr := do("GET", "/QUARTZ9", ""); rr.Code != http.StatusOK {
+		t.Fatalf("GET: Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	if calls != 4 {
+		t.Errorf("EOD API calls after invalidation = %d, want 4", calls)
+	}
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/QUARTZ9/cache?date=2024-03-15", http.StatusNotFound},
+		{"/QUARTZ9/cache?date=soon", http.StatusBadRequest},
+		{"/DOGE/cache", http.StatusBadRequest},
+		{"/VOO.US/cache", http.StatusNoContent},
+		{"/VOO.US/cache", http.StatusNotFound},
+	}
+	for _, tc := range tests {
+		if rr := do("DELETE", tc.target, "secret"); rr.Code != tc.want {
+			t.Errorf("DELETE %s: Code = %d, want %d", tc.target, rr.Code, tc.want)
+		}
+	}
+
+	// Like the other admin endpoints, invalidation must be signed once an
+	// HMAC secret is configured.
+	app.adminHMACSecret = []byte("hmac-secret")
+	if rr := do("DELETE", "/QUARTZ9/cache", "secret"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("unsigned DELETE: Code = %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+	mac := hmac.New(sha256.New, app.adminHMACSecret)
+	req := httptest.NewRequest("DELETE", "/QUARTZ9/cache", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("signed DELETE: Code = %d, want %d: %s", rr.Code, http.StatusNoContent, rr.Body)
+	}
+}
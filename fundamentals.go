@@ -0,0 +1,168 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// treasuryYieldTicker is the EODHD series of the 10-year Treasury
+	// yield, in percent.
+	treasuryYieldTicker = "US10Y.INDX"
+	// defaultEquityRiskPremium is the expected annual return of equities
+	// over the risk-free rate.
+	defaultEquityRiskPremium = 0.05
+	// fundamentalsCacheTTL is how long a fundamentals response is reused.
+	fundamentalsCacheTTL = 24 * time.Hour
+)
+
+// Fundamentals holds educational estimates for a fund.
+type Fundamentals struct {
+	Symbol                 string  `json:"symbol"`
+	AsOf                   string  `json:"as_of"`
+	EquityWeight           float64 `json:"equity_weight"`
+	RiskFreeRatePct        float64 `json:"risk_free_rate_pct"`
+	EquityRiskPremiumPct   float64 `json:"equity_risk_premium_pct"`
+	EstimatedEquityWACCPct float64 `json:"estimated_equity_wacc_pct"`
+}
+
+// fundamentalsCache keeps fundamentals for fundamentalsCacheTTL. A nil cache
+// is valid and never holds any entries.
+type fundamentalsCache struct {
+	mu      sync.Mutex
+	entries map[string]fundamentalsEntry
+	now     func() time.Time
+}
+
+type fundamentalsEntry struct {
+	fundamentals Fundamentals
+	expires      time.Time
+}
+
+// newFundamentalsCache returns an empty fundamentals cache.
+func newFundamentalsCache() *fundamentalsCache {
+	return &fundamentalsCache{entries: make(map[string]fundamentalsEntry), now: time.Now}
+}
+
+// Get returns the unexpired fundamentals of symbol.
+func (c *fundamentalsCache) Get(symbol string) (Fundamentals, bool) {
+	if c == nil {
+		return Fundamentals{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[symbol]
+	if !ok || !c.now().Before(entry.expires) {
+		return Fundamentals{}, false
+	}
+	return entry.fundamentals, true
+}
+
+// Add caches the fundamentals of symbol for fundamentalsCacheTTL.
+func (c *fundamentalsCache) Add(symbol string, f Fundamentals) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[symbol] = fundamentalsEntry{fundamentals: f, expires: c.now().Add(fundamentalsCacheTTL)}
+}
+
+// computeWACC estimates the cost of capital of a portfolio whose equity share
+// is expected to earn the risk-free rate plus the equity risk premium, and
+// whose remainder is valued at the risk-free rate. Rates are fractions.
+func computeWACC(riskFreeRate, erp, equityWeight float64) float64 {
+	costOfEquity := riskFreeRate + erp
+	return equityWeight*costOfEquity + (1-equityWeight)*riskFreeRate
+}
+
+// FundamentalsHandler returns educational estimates for a fund, e.g.
+// /fundamentals/QUARTZ9.
+func (a *App) FundamentalsHandler(w http.ResponseWriter, r *http.Request) {
+	symbol := strings.ToUpper(mux.Vars(r)["symbol"])
+	fund, ok := lookupFund(symbol)
+	if !ok {
+		http.Error(w, "Invalid symbol", http.StatusBadRequest)
+		return
+	}
+
+	fundamentals, ok := a.fundamentals.Get(symbol)
+	if !ok {
+		var err error
+		fundamentals, err = a.computeFundamentals(r.Context(), fund)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error computing fundamentals: %v", err), http.StatusInternalServerError)
+			return
+		}
+		a.fundamentals.Add(symbol, fundamentals)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fundamentals)
+}
+
+// equityComponent is the equity component of the funds.
+const equityComponent = "VOO.US"
+
+// computeFundamentals estimates the WACC of the equity component of a fund
+// from the latest 10-year Treasury yield and the current value share of VOO
+// in the fund.
+func (a *App) computeFundamentals(ctx context.Context, fund FundDefinition) (Fundamentals, error) {
+	tickers := append([]string{treasuryYieldTicker}, fund.Symbols()...)
+	data, tickerErrors := a.FetchSymbolsConcurrently(ctx, tickers, fundInceptionDate, "")
+	if len(tickerErrors) > 0 {
+		return Fundamentals{}, &componentError{Errors: tickerErrors}
+	}
+	for _, ticker := range tickers {
+		if len(data[ticker]) == 0 {
+			return Fundamentals{}, fmt.Errorf("no data available for %s", ticker)
+		}
+	}
+
+	yield := data[treasuryYieldTicker][len(data[treasuryYieldTicker])-1]
+	equityValue, total, asOf := 0.0, 0.0, ""
+	for _, c := range fund.Components {
+		latest := data[c.Symbol][len(data[c.Symbol])-1]
+		value := c.Weight * latest.AdjClose
+		if c.Symbol == equityComponent {
+			equityValue = value
+		}
+		total += value
+		asOf = maxDateStr(asOf, latest.Date)
+	}
+	if total == 0 {
+		return Fundamentals{}, fmt.Errorf("fund value is zero")
+	}
+
+	riskFreeRate := yield.AdjClose / 100
+	equityWeight := equityValue / total
+	return Fundamentals{
+		Symbol:                 fund.Name,
+		AsOf:                   asOf,
+		EquityWeight:           equityWeight,
+		RiskFreeRatePct:        yield.AdjClose,
+		EquityRiskPremiumPct:   defaultEquityRiskPremium * 100,
+		EstimatedEquityWACCPct: computeWACC(riskFreeRate, defaultEquityRiskPremium, equityWeight) * 100,
+	}, nil
+}
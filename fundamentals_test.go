@@ -0,0 +1,94 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestComputeWACC(t *testing.T) {
+	tests := []struct {
+		rf, erp, weight, want float64
+	}{
+		{0.04, 0.05, 1, 0.09},
+		{0.04, 0.05, 0, 0.04},
+		{0.042, 0.05, 0.8, 0.082},
+	}
+	for _, tc := range tests {
+		if got := computeWACC(tc.rf, tc.erp, tc.weight); !almostEqual(got, tc.want) {
+			t.Errorf("computeWACC(%v, %v, %v) = %v, want %v", tc.rf, tc.erp, tc.weight, got, tc.want)
+		}
+	}
+}
+
+func TestFundamentalsHandler(t *testing.T) {
+	app := newTestApp(t)
+	app.fundamentals = newFundamentalsCache()
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 400))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 900))
+	writeFixture(t, app, treasuryYieldTicker, fixtureSeries("2019-01-02", true, 3.5, 4.2))
+
+	get := func() Fundamentals {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/fundamentals/quartz9", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+		}
+		var got Fundamentals
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatalf("json.Unmarshal: %v", err)
+		}
+		return got
+	}
+
+	// QUARTZ9 holds 9 VOO at 400 and 1 BTC at 900, so 80% is equity.
+	got := get()
+	if got.Symbol != "QUARTZ9" || !almostEqual(got.EquityWeight, 0.8) || got.RiskFreeRatePct != 4.2 {
+		t.Errorf("fundamentals = %+v, want QUARTZ9 with 80%% equity at 4.2%%", got)
+	}
+	if !almostEqual(got.EstimatedEquityWACCPct, 8.2) {
+		t.Errorf("estimated_equity_wacc_pct = %v, want 8.2", got.EstimatedEquityWACCPct)
+	}
+
+	// The response is reused without reading the cache files again.
+	if err := os.RemoveAll(app.bucketCacheDirectory); err != nil {
+		t.Fatalf("os.RemoveAll: %v", err)
+	}
+	if again := get(); again != got {
+		t.Errorf("cached fundamentals = %+v, want %+v", again, got)
+	}
+}
+
+func TestFundamentalsCacheExpiry(t *testing.T) {
+	cache := newFundamentalsCache()
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	cache.Add("QUARTZ9", Fundamentals{Symbol: "QUARTZ9"})
+
+	now = now.Add(fundamentalsCacheTTL - time.Second)
+	if _, ok := cache.Get("QUARTZ9"); !ok {
+		t.Error("fundamentals expired before the TTL")
+	}
+	now = now.Add(time.Second)
+	if _, ok := cache.Get("QUARTZ9"); ok {
+		t.Error("fundamentals still cached after the TTL")
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// ComponentWeight is the share of a component in a fund.
+type ComponentWeight struct {
+	Symbol string
+	Weight float64
+}
+
+// FundDefinition describes a fund served by the index endpoint. The index
+// multiplies the adjusted close of every component by its weight and is
+// normalised to 100 on the first date. Weights must sum to 1.
+type FundDefinition struct {
+	Name       string
+	Components []ComponentWeight
+	// StartDate is the first date of the index, fundInceptionDate if empty.
+	StartDate string
+}
+
+// inception returns the first date of the fund index.
+func (f FundDefinition) inception() string {
+	if f.StartDate != "" {
+		return f.StartDate
+	}
+	return fundInceptionDate
+}
+
+// Symbols returns the EOD tickers of the components.
+func (f FundDefinition) Symbols() []string {
+	symbols := make([]string, len(f.Components))
+	for i, c := range f.Components {
+		symbols[i] = c.Symbol
+	}
+	return symbols
+}
+
+// rebalanceable reports whether the fund can be rebalanced, which is only
+// implemented between two components.
+func (f FundDefinition) rebalanceable() bool {
+	return len(f.Components) == 2
+}
+
+// errRebalanceComponents is returned when rebalancing a fund that does not
+// have two components.
+var errRebalanceComponents = errors.New("rebalance is only supported for funds of two components")
+
+// Weight returns the weight of symbol in the fund, 0 if it is not a
+// component.
+func (f FundDefinition) Weight(symbol string) float64 {
+	for _, c := range f.Components {
+		if c.Symbol == symbol {
+			return c.Weight
+		}
+	}
+	return 0
+}
+
+// btcComponent is the component followed by ?calendar=crypto and shifted by
+// ?offset_days.
+const btcComponent = "BTC-USD.CC"
+
+// fundComponents are the EOD tickers the funds may hold, the components of
+// the symbols config file when SYMBOLS_CONFIG_PATH is set.
+var fundComponents = []string{"VOO.US", btcComponent, "ETH-USD.CC"}
+
+// builtinFunds are the funds served by the service. Components must be
+// among fundComponents.
+var builtinFunds = []FundDefinition{
+	{Name: "QUARTZ9", Components: []ComponentWeight{{"VOO.US", 0.9}, {"BTC-USD.CC", 0.1}}},
+	{Name: "QUARTZ7", Components: []ComponentWeight{{"VOO.US", 0.7}, {"BTC-USD.CC", 0.3}}},
+	{Name: "QUARTZ5", Components: []ComponentWeight{{"VOO.US", 0.5}, {"BTC-USD.CC", 0.5}}},
+	// ETH history begins in August 2015, so QUARTZ712 starts then rather
+	// than on fundInceptionDate.
+	{Name: "QUARTZ712", Components: []ComponentWeight{{"VOO.US", 0.7}, {"BTC-USD.CC", 0.1}, {"ETH-USD.CC", 0.2}}, StartDate: "2015-08-01"},
+}
+
+// fundWeightTolerance is how far the weights of a fund may sum from 1.
+const fundWeightTolerance = 1e-9
+
+// fundDefinitions holds the loaded funds by name.
+var fundDefinitions map[string]FundDefinition
+
+// fundSymbols lists every fund served by the index endpoint, in the order of
+// their definitions.
+var fundSymbols []string
+
+// componentHistoryStart is the earliest start date of the funds. The data
+// of every component is fetched and cached from this date, whichever fund
+// requests it, and trimmed to the start date of each fund.
+var componentHistoryStart string
+
+func init() {
+	definitions, err := loadFundDefinitions(builtinFunds)
+	if err != nil {
+		panic(err)
+	}
+	fundDefinitions = definitions
+	for _, f := range builtinFunds {
+		fundSymbols = append(fundSymbols, f.Name)
+	}
+	componentHistoryStart = historyStart(builtinFunds)
+}
+
+// historyStart returns the earliest start date of the funds.
+func historyStart(funds []FundDefinition) string {
+	start := fundInceptionDate
+	for _, f := range funds {
+		start = minDateStr(start, f.inception())
+	}
+	return start
+}
+
+// loadFundDefinitions validates the fund definitions and indexes them by
+// name.
+func loadFundDefinitions(funds []FundDefinition) (map[string]FundDefinition, error) {
+	return validateFundDefinitions(funds, fundComponents)
+}
+
+// validateFundDefinitions is loadFundDefinitions with components as the
+// supported EOD tickers.
+func validateFundDefinitions(funds []FundDefinition, components []string) (map[string]FundDefinition, error) {
+	definitions := make(map[string]FundDefinition, len(funds))
+	for _, f := range funds {
+		if f.Name == "" {
+			return nil, fmt.Errorf("fund without a name")
+		}
+		if _, ok := definitions[f.Name]; ok {
+			return nil, fmt.Errorf("fund %s is defined twice", f.Name)
+		}
+		total := 0.0
+		for _, c := range f.Components {
+			if !slices.Contains(components, c.Symbol) {
+				return nil, fmt.Errorf("fund %s: unsupported component %s", f.Name, c.Symbol)
+			}
+			if c.Weight < 0 {
+				return nil, fmt.Errorf("fund %s: negative weight for %s", f.Name, c.Symbol)
+			}
+			total += c.Weight
+		}
+		if math.Abs(total-1) > fundWeightTolerance {
+			return nil, fmt.Errorf("fund %s: weights sum to %g, want 1", f.Name, total)
+		}
+		if f.StartDate != "" {
+			if _, err := time.Parse(time.DateOnly, f.StartDate); err != nil {
+				return nil, fmt.Errorf("fund %s: invalid start date %q", f.Name, f.StartDate)
+			}
+		}
+		definitions[f.Name] = f
+	}
+	return definitions, nil
+}
+
+// componentsOf returns the EOD tickers held by any of the funds.
+func componentsOf(funds []FundDefinition) []string {
+	var components []string
+	for _, f := range funds {
+		for _, c := range f.Components {
+			if !slices.Contains(components, c.Symbol) {
+				components = append(components, c.Symbol)
+			}
+		}
+	}
+	return components
+}
+
+// setFundDefinitions replaces the funds served by the service. The
+// components of the funds become fundComponents.
+func setFundDefinitions(funds []FundDefinition) error {
+	components := componentsOf(funds)
+	definitions, err := validateFundDefinitions(funds, components)
+	if err != nil {
+		return err
+	}
+	symbols := make([]string, len(funds))
+	for i, f := range funds {
+		symbols[i] = f.Name
+	}
+	fundDefinitions, fundSymbols, fundComponents = definitions, symbols, components
+	componentHistoryStart = historyStart(funds)
+	return nil
+}
+
+// lookupFund returns the definition of a fund symbol.
+func lookupFund(symbol string) (FundDefinition, bool) {
+	f, ok := fundDefinitions[symbol]
+	return f, ok
+}
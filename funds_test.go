@@ -0,0 +1,199 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoadFundDefinitions(t *testing.T) {
+	if len(fundSymbols) != len(builtinFunds) {
+		t.Fatalf("fundSymbols = %v, want one per built-in fund", fundSymbols)
+	}
+	for _, symbol := range fundSymbols {
+		if _, ok := lookupFund(symbol); !ok {
+			t.Errorf("lookupFund(%s) not found", symbol)
+		}
+	}
+
+	invalid := map[string][]FundDefinition{
+		"no name":     {{Components: []ComponentWeight{{"VOO.US", 1}}}},
+		"duplicate":   {{Name: "A", Components: []ComponentWeight{{"VOO.US", 1}}}, {Name: "A", Components: []ComponentWeight{{"VOO.US", 1}}}},
+		"unsupported": {{Name: "A", Components: []ComponentWeight{{"DOGE-USD.CC", 1}}}},
+		"negative":    {{Name: "A", Components: []ComponentWeight{{"VOO.US", 1.5}, {"BTC-USD.CC", -0.5}}}},
+		"sum":         {{Name: "A", Components: []ComponentWeight{{"VOO.US", 0.6}, {"BTC-USD.CC", 0.3}}}},
+	}
+	for name, funds := range invalid {
+		if _, err := loadFundDefinitions(funds); err == nil {
+			t.Errorf("%s: loadFundDefinitions succeeded, want error", name)
+		}
+	}
+}
+
+func TestComputeIndexSeriesWeights(t *testing.T) {
+	app := newTestApp(t)
+	voo := []float64{100, 101, 102, 103, 104}
+	btc := []float64{10, 11, 12, 13, 14}
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", false, voo...))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, btc...))
+
+	// The index previously held 7 units of VOO and 3 of BTC; the same
+	// weights as fractions give the same returns.
+	fund, _ := lookupFund("QUARTZ7")
+	got, err := app.computeIndexSeries(context.Background(), fund, fundInceptionDate, indexOptions{Fill: FillLast})
+	if err != nil {
+		t.Fatalf("computeIndexSeries: %v", err)
+	}
+	if len(got) != len(btc) {
+		t.Fatalf("len(index) = %d, want %d", len(got), len(btc))
+	}
+	units := func(i int) float64 { return 7*voo[i] + 3*btc[i] }
+	for i, point := range got {
+		if want := units(i) / units(0) * 100; !almostEqual(point.AdjClose, want) {
+			t.Errorf("index[%d] = %v, want %v", i, point.AdjClose, want)
+		}
+	}
+
+	definitions, err := loadFundDefinitions([]FundDefinition{
+		{Name: "QUARTZ55", Components: []ComponentWeight{{"VOO.US", 0.55}, {"BTC-USD.CC", 0.45}}},
+	})
+	if err != nil {
+		t.Fatalf("loadFundDefinitions: %v", err)
+	}
+	got, err = app.computeIndexSeries(context.Background(), definitions["QUARTZ55"], fundInceptionDate, indexOptions{Fill: FillLast})
+	if err != nil {
+		t.Fatalf("computeIndexSeries: %v", err)
+	}
+	want := (0.55*104 + 0.45*14) / (0.55*100 + 0.45*10) * 100
+	if last := got[len(got)-1].AdjClose; !almostEqual(last, want) {
+		t.Errorf("QUARTZ55 index = %v, want %v", last, want)
+	}
+}
+
+func TestComputeIndexSeriesThreeComponents(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", false, 100, 110, 121, 133.1))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 20, 10, 20))
+	// ETH only has data from the second day, so the index starts there.
+	writeFixture(t, app, "ETH-USD.CC", fixtureSeries("2019-01-03", false, 50, 40, 60))
+
+	fund, ok := lookupFund("QUARTZ712")
+	if !ok {
+		t.Fatal("QUARTZ712 is not defined")
+	}
+	got, err := app.computeIndexSeries(context.Background(), fund, "", indexOptions{})
+	if err != nil {
+		t.Fatalf("computeIndexSeries: %v", err)
+	}
+	value := func(voo, btc, eth float64) float64 { return 0.7*voo + 0.1*btc + 0.2*eth }
+	base := value(110, 20, 50)
+	want := []IndexData{
+		{Date: "2019-01-03", AdjClose: 100},
+		{Date: "2019-01-04", AdjClose: value(121, 10, 40) / base * 100},
+		{Date: "2019-01-05", AdjClose: value(133.1, 20, 60) / base * 100},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("index = %+v, want %d points", got, len(want))
+	}
+	for i, w := range want {
+		if got[i].Date != w.Date || !almostEqual(got[i].AdjClose, w.AdjClose) {
+			t.Errorf("index[%d] = %s %v, want %s %v", i, got[i].Date, got[i].AdjClose, w.Date, w.AdjClose)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ712?rebalance=monthly", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("rebalance of three components: Code = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestFundStartDatesShareComponentCache(t *testing.T) {
+	t.Cleanup(func() {
+		if err := setFundDefinitions(builtinFunds); err != nil {
+			t.Fatalf("setFundDefinitions(builtinFunds): %v", err)
+		}
+	})
+	err := setFundDefinitions([]FundDefinition{
+		{Name: "QUARTZ9", Components: []ComponentWeight{{"VOO.US", 0.9}, {"BTC-USD.CC", 0.1}}},
+		{Name: "LATE", Components: []ComponentWeight{{"VOO.US", 0.5}, {"BTC-USD.CC", 0.5}}, StartDate: "2019-01-04"},
+	})
+	if err != nil {
+		t.Fatalf("setFundDefinitions: %v", err)
+	}
+	// The EOD API only returns the data from the requested date.
+	data := fixtureSeries("2018-12-31", false, 100, 101, 102, 103, 104, 105, 106)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(sinceStockData(data, r.URL.Query().Get("from")))
+	}))
+	t.Cleanup(srv.Close)
+	app := newTestApp(t)
+	app.eodBaseURL = srv.URL
+
+	for _, want := range []struct{ symbol, start string }{{"LATE", "2019-01-04"}, {"QUARTZ9", fundInceptionDate}} {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/"+want.symbol, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET /%s status = %d, want %d: %s", want.symbol, rr.Code, http.StatusOK, rr.Body)
+		}
+		var got []IndexData
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatalf("json.Unmarshal: %v", err)
+		}
+		if len(got) == 0 || got[0].Date != want.start {
+			t.Errorf("GET /%s index = %+v, want it to start on %s", want.symbol, got, want.start)
+		}
+	}
+}
+
+func TestQUARTZ712StartsWithETH(t *testing.T) {
+	// The EOD API only returns the data from the requested date, and ETH
+	// history begins on 2015-08-07.
+	closes := make([]float64, 2500)
+	for i := range closes {
+		closes[i] = 100 + float64(i)
+	}
+	data := map[string][]StockData{
+		"VOO.US":     fixtureSeries("2015-01-02", true, closes...),
+		"BTC-USD.CC": fixtureSeries("2014-09-17", false, closes...),
+		"ETH-USD.CC": fixtureSeries("2015-08-07", false, closes...),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		symbol := r.URL.Path[len("/eod/"):]
+		json.NewEncoder(w).Encode(sinceStockData(data[symbol], r.URL.Query().Get("from")))
+	}))
+	t.Cleanup(srv.Close)
+	app := newTestApp(t)
+	app.eodBaseURL = srv.URL
+
+	for _, want := range []struct{ symbol, start string }{{"QUARTZ712", "2015-08-07"}, {"QUARTZ9", fundInceptionDate}} {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/"+want.symbol, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("GET /%s status = %d, want %d: %s", want.symbol, rr.Code, http.StatusOK, rr.Body)
+		}
+		var got []IndexData
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatalf("json.Unmarshal: %v", err)
+		}
+		if len(got) == 0 || got[0].Date != want.start || got[0].AdjClose != 100 {
+			t.Errorf("GET /%s starts with %+v, want 100 on %s", want.symbol, got[:min(len(got), 1)], want.start)
+		}
+	}
+}
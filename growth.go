@@ -0,0 +1,79 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// MoneyMultiple is the growth of one unit of money invested at the start of
+// the series.
+type MoneyMultiple struct {
+	Date     string  `json:"date"`
+	Multiple float64 `json:"multiple"`
+}
+
+// MoneyMultipleResponse is the response of the multiple of money endpoint.
+type MoneyMultipleResponse struct {
+	Multiples []MoneyMultiple `json:"multiples"`
+	// InitialInvestmentMultipliedBy is the multiple on the last date.
+	InitialInvestmentMultipliedBy float64 `json:"initial_investment_multiplied_by"`
+}
+
+// MultipleOfMoneyHandler returns how many times an investment made on the
+// from date (or the fund inception) has grown, e.g. /QUARTZ9/mom?from=2021-01-01.
+func (a *App) MultipleOfMoneyHandler(w http.ResponseWriter, r *http.Request) {
+	symbol := strings.ToUpper(mux.Vars(r)["symbol"])
+	fund, ok := lookupFund(symbol)
+	if !ok {
+		http.Error(w, "Invalid symbol", http.StatusBadRequest)
+		return
+	}
+	from, err := optionalDateParam(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	series, err := a.computeIndexSeries(r.Context(), fund, from, indexOptions{})
+	if err != nil {
+		http.Error(w, "Error computing index series", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(multipleOfMoney(series))
+}
+
+// multipleOfMoney divides every index value by the first one.
+func multipleOfMoney(series []IndexData) MoneyMultipleResponse {
+	response := MoneyMultipleResponse{Multiples: []MoneyMultiple{}}
+	if len(series) == 0 || series[0].AdjClose == 0 {
+		return response
+	}
+	initial := series[0].AdjClose
+	for _, data := range series {
+		response.Multiples = append(response.Multiples, MoneyMultiple{
+			Date:     data.Date,
+			Multiple: data.AdjClose / initial,
+		})
+	}
+	response.InitialInvestmentMultipliedBy = response.Multiples[len(response.Multiples)-1].Multiple
+	return response
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMultipleOfMoney(t *testing.T) {
+	for _, series := range [][]IndexData{
+		indexSeries("2021-01-01", 100, 120, 153),
+		indexSeries("2021-01-01", 87.5, 50, 175),
+	} {
+		got := multipleOfMoney(series)
+		if len(got.Multiples) != len(series) {
+			t.Fatalf("len = %d, want %d", len(got.Multiples), len(series))
+		}
+		if got.Multiples[0].Multiple != 1 {
+			t.Errorf("multiple[0] = %v, want 1", got.Multiples[0].Multiple)
+		}
+		want := series[len(series)-1].AdjClose / series[0].AdjClose
+		if !almostEqual(got.InitialInvestmentMultipliedBy, want) {
+			t.Errorf("initial_investment_multiplied_by = %v, want %v", got.InitialInvestmentMultipliedBy, want)
+		}
+	}
+	if got := multipleOfMoney(nil); len(got.Multiples) != 0 || got.InitialInvestmentMultipliedBy != 0 {
+		t.Errorf("multipleOfMoney(nil) = %+v", got)
+	}
+}
+
+func TestMultipleOfMoneyHandler(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101, 102, 103, 104))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 13, 14, 15, 16))
+
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ9/mom?from=2019-01-04", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got MoneyMultipleResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(got.Multiples) != 5 || got.Multiples[0].Date != "2019-01-04" || got.Multiples[0].Multiple != 1 {
+		t.Errorf("multiples = %+v, want 5 points starting at 2019-01-04 with multiple 1", got.Multiples)
+	}
+}
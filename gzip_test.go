@@ -0,0 +1,122 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]bool{
+		"":                  false,
+		"gzip":              true,
+		"deflate, gzip;q=1": true,
+		"br;q=1.0, *;q=0.5": true,
+		"gzip;q=0":          false,
+		"gzip; q=0.000":     false,
+		"deflate":           false,
+		"gzipx":             false,
+	}
+	for header, want := range tests {
+		if got := acceptsGzip(header); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	large := strings.Repeat(`{"date":"2019-01-02","adjusted_close":100},`, 100)
+	handler := gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large":
+			w.Header().Set("Content-Type", "application/json")
+			// Written in pieces smaller than gzipMinSize.
+			for i := 0; i < len(large); i += 100 {
+				io.WriteString(w, large[i:min(i+100, len(large))])
+			}
+		case "/error":
+			http.Error(w, "Invalid symbol", http.StatusBadRequest)
+		case "/empty":
+			w.WriteHeader(http.StatusNotModified)
+		}
+	}))
+	get := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("/large", "gzip")
+	if rr.Header().Get("Content-Encoding") != "gzip" || rr.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("headers = %v, want gzip encoding varying on Accept-Encoding", rr.Header())
+	}
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil || string(body) != large {
+		t.Errorf("decompressed body = %d bytes, %v, want the %d bytes written", len(body), err, len(large))
+	}
+	if rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", rr.Header().Get("Content-Type"))
+	}
+
+	if rr := get("/large", ""); rr.Header().Get("Content-Encoding") != "" || rr.Body.String() != large {
+		t.Errorf("without Accept-Encoding: Content-Encoding = %q, %d bytes", rr.Header().Get("Content-Encoding"), rr.Body.Len())
+	}
+	rr = get("/error", "gzip")
+	if rr.Code != http.StatusBadRequest || rr.Header().Get("Content-Encoding") != "" || rr.Body.String() != "Invalid symbol\n" {
+		t.Errorf("small error: %d %q, Content-Encoding %q, want it uncompressed", rr.Code, rr.Body, rr.Header().Get("Content-Encoding"))
+	}
+	if rr := get("/empty", "gzip"); rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Errorf("empty response: %d with %d bytes, want 304 without a body", rr.Code, rr.Body.Len())
+	}
+}
+
+// BenchmarkGzipIndexResponse reports the size of the daily index of a fund
+// with and without compression.
+func BenchmarkGzipIndexResponse(b *testing.B) {
+	app := newTestApp(b)
+	writeFixture(b, app, "VOO.US", benchmarkSeries(5*252, true))
+	writeFixture(b, app, "BTC-USD.CC", benchmarkSeries(5*365, false))
+	handler := gzipMiddleware(app.newRouter())
+
+	plain := httptest.NewRecorder()
+	handler.ServeHTTP(plain, httptest.NewRequest("GET", "/QUARTZ9", nil))
+	var compressed int
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest("GET", "/QUARTZ9", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Header().Get("Content-Encoding") != "gzip" {
+			b.Fatalf("response not compressed: %v", rr.Header())
+		}
+		compressed = rr.Body.Len()
+	}
+	b.ReportMetric(float64(plain.Body.Len()), "plain-bytes")
+	b.ReportMetric(float64(compressed), "gzip-bytes")
+	b.ReportMetric(float64(compressed)/float64(plain.Body.Len())*100, "%size")
+}
@@ -15,17 +15,25 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"io/fs"
+	"math"
 	"net/http"
-	"os"
+	neturl "net/url"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/logging"
 	"github.com/gorilla/mux"
+	"golang.org/x/sync/singleflight"
 )
 
 // Define a struct to match the expected data structure from the endpoint
@@ -37,15 +45,74 @@ type StockData struct {
 	Close    float64 `json:"close"`
 	AdjClose float64 `json:"adjusted_close"`
 	Volume   int64   `json:"volume"`
+
+	// SplitAdjClose is the close adjusted for splits only, see
+	// applySplitAdjustment.
+	SplitAdjClose float64 `json:"split_adj_close,omitempty"`
+
+	// FillStreak is the number of consecutive days the price has been
+	// carried forward by forwardFillStockData; 0 for a real price.
+	FillStreak int `json:"-"`
 }
 
+// fundInceptionDate is the first date of every fund index.
+const fundInceptionDate = "2019-01-02"
+
 type IndexData struct {
 	Date     string  `json:"date"`
 	AdjClose float64 `json:"adjusted_close"`
+
+	// Timestamp is the start of the date in the requested output timezone,
+	// see applyOutputTimezone.
+	Timestamp string `json:"timestamp,omitempty"`
+
+	// Regime is the market regime of the date, see classifyMarketRegime.
+	Regime string `json:"regime,omitempty"`
+
+	// VolatilityRegime is the volatility regime of the date, see
+	// detectVolatilityRegimes.
+	VolatilityRegime string `json:"vol_regime,omitempty"`
+
+	// Alert is set on days whose move exceeds ?threshold_alert, see
+	// annotateAlerts.
+	Alert bool `json:"alert,omitempty"`
+
+	// Confidence is 1 for real prices and lower for forward-filled ones,
+	// see fillConfidence.
+	Confidence float64 `json:"confidence,omitempty"`
+
+	// RunupPct is the gain from the lowest value so far, see computeRunup.
+	RunupPct float64 `json:"runup_pct,omitempty"`
+
+	// DrawdownPct is the decline from the highest value so far, see
+	// computeDrawdown.
+	DrawdownPct float64 `json:"drawdown_pct,omitempty"`
+
+	// Volatility30D is the standard deviation of the last 30 daily returns
+	// in percent and AnnualisedVol30D the same scaled by √252, see
+	// computeVolatility30D.
+	Volatility30D    float64 `json:"volatility_30d,omitempty"`
+	AnnualisedVol30D float64 `json:"annualised_vol_30d_pct,omitempty"`
+
+	// FillStreak is the largest FillStreak of the component prices.
+	FillStreak int `json:"-"`
+}
+
+// MarshalJSON encodes a NaN AdjClose, e.g. a z-score without enough history,
+// as null.
+func (d IndexData) MarshalJSON() ([]byte, error) {
+	type indexData IndexData
+	if !math.IsNaN(d.AdjClose) {
+		return json.Marshal(indexData(d))
+	}
+	return json.Marshal(struct {
+		indexData
+		AdjClose *float64 `json:"adjusted_close"`
+	}{indexData: indexData(d)})
 }
 
 func (a *App) Handler(w http.ResponseWriter, r *http.Request) {
-	a.log.Log(logging.Entry{
+	a.logRequest(r.Context(), logging.Entry{
 		Severity: logging.Info,
 		HTTPRequest: &logging.HTTPRequest{
 			Request: r,
@@ -57,138 +124,1140 @@ func (a *App) Handler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	symbol := vars["symbol"]
 
-	ratioVOO := 9
-	ratioBTC := 1
-
 	// Check if the symbol is not provided
 	if symbol == "" {
-		http.Error(w, "Symbol is required", http.StatusBadRequest)
+		writeJSONError(w, "Symbol is required", http.StatusBadRequest)
 		return
 	}
 
-	// Case insensitive check for the symbol
-	symbol = strings.ToUpper(symbol)
+	// Optional aggregation of the daily series
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy != "" && groupBy != "quarter" && groupBy != "year" {
+		writeJSONError(w, "Invalid group_by, supported values: quarter, year", http.StatusBadRequest)
+		return
+	}
+
+	// Optional output format, JSON unless requested otherwise. Parquet and
+	// CSV only hold the daily series, without the response envelope.
+	format := responseFormat(r)
+	seriesOnly := format == "parquet" || format == "csv"
+	switch {
+	case format != "" && format != "json" && format != "parquet" && format != "msgpack" && format != "csv":
+		writeJSONError(w, "Invalid format, supported values: json, parquet, msgpack, csv", http.StatusBadRequest)
+		return
+	case seriesOnly && groupBy != "":
+		writeJSONError(w, fmt.Sprintf("The %s format does not support group_by", format), http.StatusBadRequest)
+		return
+	}
 
-	// Switch case to handle different symbols
-	switch symbol {
-	case "QUARTZ9":
-		ratioVOO = 9
-		ratioBTC = 1
-	case "QUARTZ7":
-		ratioVOO = 7
-		ratioBTC = 3
-	case "QUARTZ5":
-		ratioVOO = 5
-		ratioBTC = 5
+	// Optional pagination of the daily series
+	page, pageSize, paginated, err := parsePagination(r)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if paginated && groupBy != "" {
+		writeJSONError(w, "Pagination does not support group_by", http.StatusBadRequest)
+		return
+	}
+
+	// Optional raw component series, for debugging the blend
+	includeRawData, err := parseBoolParam(r, "include_raw_data")
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if includeRawData && (groupBy != "" || seriesOnly) {
+		writeJSONError(w, "include_raw_data is only supported for the daily JSON series", http.StatusBadRequest)
+		return
+	}
+
+	// Optional computation trace, for admins debugging the index values
+	debug, err := parseBoolParam(r, "debug")
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if debug && (groupBy != "" || seriesOnly) {
+		writeJSONError(w, "debug is only supported for the daily JSON series", http.StatusBadRequest)
+		return
+	}
+	if debug && !a.isAdminRequest(r) {
+		writeJSONError(w, "debug requires the admin token", http.StatusUnauthorized)
+		return
+	}
+
+	// Optional list of the dates with forward-filled prices
+	includeDateGaps, err := parseBoolParam(r, "include_date_gaps")
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if includeDateGaps && (groupBy != "" || seriesOnly) {
+		writeJSONError(w, "include_date_gaps is only supported for the daily JSON series", http.StatusBadRequest)
+		return
+	}
+
+	// Optional split-only adjustment, without dividend reinvestment
+	splitOnly, err := parseBoolParam(r, "split_only")
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// dividend_reinvestment=false asks for the same price-only index
+	if r.URL.Query().Get("dividend_reinvestment") != "" {
+		reinvest, err := parseBoolParam(r, "dividend_reinvestment")
+		if err != nil {
+			writeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if reinvest && splitOnly {
+			writeJSONError(w, "dividend_reinvestment=true contradicts split_only=true", http.StatusBadRequest)
+			return
+		}
+		splitOnly = !reinvest
+	}
+
+	// Optional crypto calendar, following the dates BTC actually traded
+	calendar := r.URL.Query().Get("calendar")
+	if calendar != "" && calendar != "crypto" {
+		writeJSONError(w, fmt.Sprintf("invalid 'calendar' value '%s', expected crypto", calendar), http.StatusBadRequest)
+		return
+	}
+
+	// Optional rebalancing mode, fixed units unless requested otherwise
+	var rebalance RebalanceConfig
+	switch mode := r.URL.Query().Get("rebalance"); mode {
+	case "", rebalanceMonthly, rebalanceRiskParity:
+		rebalance.Mode = mode
+	default:
+		writeJSONError(w, fmt.Sprintf("invalid 'rebalance' value '%s', expected %s or %s", mode, rebalanceMonthly, rebalanceRiskParity), http.StatusBadRequest)
+		return
+	}
+
+	// Optional capital gains tax on rebalancing
+	if v := r.URL.Query().Get("tax_jurisdiction"); v != "" {
+		rates, ok := taxJurisdictions[strings.ToUpper(v)]
+		if !ok {
+			writeJSONError(w, fmt.Sprintf("invalid 'tax_jurisdiction' value '%s', expected US", v), http.StatusBadRequest)
+			return
+		}
+		if rebalance.Mode == "" {
+			writeJSONError(w, "tax_jurisdiction requires rebalance", http.StatusBadRequest)
+			return
+		}
+		rebalance.TaxRate, rebalance.LongTermTaxRate = rates.TaxRate, rates.LongTermTaxRate
+	}
+
+	// Optional treatment of days without a component price
+	fill := FillStrategy(r.URL.Query().Get("fill_strategy"))
+	switch fill {
+	case "":
+		fill = FillLast
+	case FillLast, FillZero, FillMean:
 	default:
-		http.Error(w, "Invalid symbol", http.StatusBadRequest)
+		writeJSONError(w, fmt.Sprintf("invalid 'fill_strategy' value '%s', expected %s, %s or %s", fill, FillLast, FillZero, FillMean), http.StatusBadRequest)
+		return
+	}
+	if fill != FillLast && rebalance.Mode != "" {
+		writeJSONError(w, "fill_strategy is not supported with rebalance", http.StatusBadRequest)
+		return
+	}
+
+	// Optional business-day calendar, without filled weekend entries
+	fillBusinessDaysOnly, err := parseBoolParam(r, "fill_business_days_only")
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if fillBusinessDaysOnly && rebalance.Mode != "" {
+		writeJSONError(w, "fill_business_days_only is not supported with rebalance", http.StatusBadRequest)
+		return
+	}
+
+	// Optional shift of the BTC series, to test leading and lagging
+	offsetDays := 0
+	if v := r.URL.Query().Get("offset_days"); v != "" {
+		if offsetDays, err = strconv.Atoi(v); err != nil {
+			writeJSONError(w, fmt.Sprintf("invalid 'offset_days' value '%s', expected an integer", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Optional cap on the daily move of every component
+	clampReturns := 0.0
+	if v := r.URL.Query().Get("clamp_returns"); v != "" {
+		clampReturns, err = strconv.ParseFloat(v, 64)
+		if err != nil || !(clampReturns > 0) || clampReturns > 1 {
+			writeJSONError(w, fmt.Sprintf("invalid 'clamp_returns' value '%s', expected a fraction between 0 and 1", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Optional smoothing of the daily series
+	smoothingAlpha, err := parseSmoothing(r)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Get the symbol from the URL query parameters
-	stockDataVOO, err := a.PrepareSymbolJSONData("VOO.US", "2019-01-02")
+	// Optional bull/bear/neutral label on every date
+	regime, err := parseBoolParam(r, "regime")
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if regime && (groupBy != "" || seriesOnly) {
+		writeJSONError(w, "regime is only supported for the daily JSON series", http.StatusBadRequest)
+		return
+	}
+	// Optional regime the returned points must be classified in
+	regimeFilter, err := parseRegimeFilter(r)
 	if err != nil {
-		log.Fatal("Error preparing symbol JSON data:", err)
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if regimeFilter != "" && (groupBy != "" || seriesOnly) {
+		writeJSONError(w, "regime_filter is only supported for the daily JSON series", http.StatusBadRequest)
+		return
 	}
 
-	stockDataBTC, err := a.PrepareSymbolJSONData("BTC-USD.CC", "2019-01-02")
+	// Optional date range of the returned index
+	from, err := optionalDateParam(r, "from")
 	if err != nil {
-		log.Fatal("Error preparing symbol JSON data:", err)
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := optionalDateParam(r, "to")
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if from != "" && to != "" && maxDateStr(from, to) != to {
+		writeJSONError(w, fmt.Sprintf("invalid date range: 'from' %s is after 'to' %s", from, to), http.StatusBadRequest)
+		return
 	}
 
-	stockDataVOOFF := forwardFillStockData(stockDataVOO, "2019-01-02", stockDataBTC[len(stockDataBTC)-1].Date)
+	// Optional output frequency, calendar daily unless requested otherwise
+	frequency := r.URL.Query().Get("frequency")
+	switch frequency {
+	case "", frequencyDaily, frequencyBusinessDaily, frequencyWeeklyLast, frequencyMonthlyLast:
+	default:
+		writeJSONError(w, fmt.Sprintf("invalid 'frequency' value '%s', expected %s, %s, %s or %s", frequency, frequencyDaily, frequencyBusinessDaily, frequencyWeeklyLast, frequencyMonthlyLast), http.StatusBadRequest)
+		return
+	}
+	if frequency != "" && groupBy != "" {
+		writeJSONError(w, "frequency is not supported with group_by", http.StatusBadRequest)
+		return
+	}
 
-	// Create a map to store the stock data by date
-	stockDataVOOMap := make(map[string]StockData)
-	for _, data := range stockDataVOOFF {
-		stockDataVOOMap[data.Date] = data
+	// Optional date on which the index equals 100
+	baseDate, err := optionalDateParam(r, "base_date")
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	stockDataIndex := make([]IndexData, 0)
+	// Optional IANA timezone of the timestamps
+	var outputLocation *time.Location
+	if name := r.URL.Query().Get("output_timezone"); name != "" {
+		if outputLocation, err = parseTimezone(name); err != nil {
+			writeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
-	// Calculate index at the start
-	stockDataIndex = append(stockDataIndex, IndexData{
-		Date:     stockDataBTC[0].Date,
-		AdjClose: 100,
-	})
-	initialIndexValue := (stockDataBTC[0].AdjClose * float64(ratioBTC)) + (stockDataVOOFF[0].AdjClose * float64(ratioVOO))
-
-	for i := 1; i < len(stockDataBTC); i++ {
-		currentIndexValue := (stockDataBTC[i].AdjClose * float64(ratioBTC)) + (stockDataVOOFF[i].AdjClose * float64(ratioVOO))
-		indexValue := (currentIndexValue / initialIndexValue) * 100
-		stockDataIndex = append(stockDataIndex, IndexData{
-			Date:     stockDataBTC[i].Date,
-			AdjClose: indexValue,
+	// Optional low/medium/high volatility label on every date
+	volRegime, err := parseBoolParam(r, "vol_regime")
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if volRegime && (groupBy != "" || seriesOnly) {
+		writeJSONError(w, "vol_regime is only supported for the daily JSON series", http.StatusBadRequest)
+		return
+	}
+
+	// Optional certainty of every point, lower for forward-filled prices
+	includeConfidence, err := parseBoolParam(r, "fill_confidence")
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if includeConfidence && (groupBy != "" || seriesOnly) {
+		writeJSONError(w, "fill_confidence is only supported for the daily JSON series", http.StatusBadRequest)
+		return
+	}
+
+	// Optional highlighting of large daily moves
+	thresholdAlert := 0.0
+	if v := r.URL.Query().Get("threshold_alert"); v != "" {
+		thresholdAlert, err = strconv.ParseFloat(v, 64)
+		if err != nil || !(thresholdAlert > 0) || math.IsInf(thresholdAlert, 1) {
+			writeJSONError(w, fmt.Sprintf("invalid 'threshold_alert' value '%s', expected a positive percentage", v), http.StatusBadRequest)
+			return
+		}
+		if groupBy != "" || seriesOnly {
+			writeJSONError(w, "threshold_alert is only supported for the daily JSON series", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Optional gain from the lowest value so far
+	runup, err := parseBoolParam(r, "runup")
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if runup && (groupBy != "" || seriesOnly) {
+		writeJSONError(w, "runup is only supported for the daily JSON series", http.StatusBadRequest)
+		return
+	}
+
+	// Optional 30 day volatility, daily or also annualised
+	volatility30D, err := parseBoolParam(r, "volatility_30d")
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	annualiseVolatility, err := parseBoolParam(r, "annualise_volatility")
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if (volatility30D || annualiseVolatility) && (groupBy != "" || seriesOnly) {
+		writeJSONError(w, "volatility_30d is only supported for the daily JSON series", http.StatusBadRequest)
+		return
+	}
+
+	// Optional normalisation of the index levels
+	normalize := r.URL.Query().Get("normalize")
+	switch {
+	case normalize != "" && normalize != "zscore":
+		writeJSONError(w, fmt.Sprintf("invalid 'normalize' value '%s', expected zscore", normalize), http.StatusBadRequest)
+		return
+	case normalize != "" && groupBy != "":
+		writeJSONError(w, "normalize does not support group_by", http.StatusBadRequest)
+		return
+	}
+
+	// Optional transforms of the daily series, applied in the order given
+	transforms, err := parseTransforms(r)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if transforms != nil && (groupBy != "" || seriesOnly) {
+		writeJSONError(w, "transforms is only supported for the daily JSON series", http.StatusBadRequest)
+		return
+	}
+
+	// Optional hash of the index data, for clients to verify it
+	fieldsHash, err := parseBoolParam(r, "fields_hash")
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if fieldsHash && (groupBy != "" || seriesOnly || format == "msgpack") {
+		writeJSONError(w, "fields_hash is only supported for the daily JSON series", http.StatusBadRequest)
+		return
+	}
+
+	// Case insensitive check for the symbol
+	symbol = strings.ToUpper(symbol)
+
+	// Look up the fund composition
+	fund, ok := lookupFund(symbol)
+	if !ok {
+		writeJSONError(w, "Invalid symbol", http.StatusBadRequest)
+		return
+	}
+	if includeRawData && len(fund.Components) > a.maxRawDataSeries {
+		writeJSONError(w, fmt.Sprintf("include_raw_data is limited to %d component series", a.maxRawDataSeries), http.StatusBadRequest)
+		return
+	}
+	if rebalance.Mode != "" && !fund.rebalanceable() {
+		writeJSONError(w, errRebalanceComponents.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Clients polling the index get 304 Not Modified until the cached data
+	// changes, without the index being computed again.
+	if a.setCacheValidators(w, r, fund) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// A component that cannot be fetched leaves the index empty, but the
+	// caller still gets the errors and any component data that is available.
+	// The plain index falls back to the snapshot kept in memory, if any.
+	opts := indexOptions{
+		SplitOnly:            splitOnly,
+		CryptoCalendar:       calendar == "crypto",
+		Rebalance:            rebalance,
+		OffsetDays:           offsetDays,
+		Fill:                 fill,
+		FillBusinessDaysOnly: fillBusinessDaysOnly,
+		To:                   to,
+		ClampReturns:         clampReturns,
+	}
+	var trace computationTrace
+	if debug {
+		opts.Trace = &trace
+	}
+	var stale bool
+	opts.Stale = &stale
+	start := time.Now()
+	stockDataIndex, err := a.computeIndexSeries(r.Context(), fund, "", opts)
+	a.promMetrics.observeIndexDuration(symbol, start)
+	var componentErr *componentError
+	if errors.As(err, &componentErr) {
+		w.Header().Del("ETag")
+		w.Header().Del("Last-Modified")
+		stockDataIndex = []IndexData{}
+		if snapshot, ok := a.snapshots.Get(symbol); ok && opts == (indexOptions{Fill: FillLast, Trace: opts.Trace, Stale: opts.Stale}) {
+			stockDataIndex = slices.Clone(snapshot)
+		}
+	} else if err != nil {
+		a.writeIndexError(r.Context(), w, err)
+		return
+	} else if w.Header().Get("ETag") == "" {
+		// The data has just been fetched for the first time today.
+		a.setCacheValidators(w, r, fund)
+	}
+
+	// Compare the after-tax index with the same rebalancing without tax.
+	var summary *IndexSummary
+	if rebalance.TaxRate > 0 && componentErr == nil {
+		untaxed, err := a.computeIndexSeries(r.Context(), fund, "", indexOptions{
+			SplitOnly:      splitOnly,
+			CryptoCalendar: calendar == "crypto",
+			Rebalance:      RebalanceConfig{Mode: rebalance.Mode},
+			OffsetDays:     offsetDays,
+			To:             to,
+		})
+		if err != nil {
+			a.writeIndexError(r.Context(), w, err)
+			return
+		}
+		summary = &IndexSummary{
+			ReturnPct:         totalReturnPct(untaxed),
+			AfterTaxReturnPct: totalReturnPct(stockDataIndex),
+		}
+	}
+
+	if smoothingAlpha > 0 {
+		stockDataIndex = applyEMA(stockDataIndex, smoothingAlpha)
+	}
+	if baseDate != "" {
+		if stockDataIndex, err = rebaseAt(stockDataIndex, baseDate); err != nil {
+			writeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Annotate the series as requested, then apply ?transforms.
+	var pipeline Pipeline
+	if outputLocation != nil {
+		pipeline = append(pipeline, func(series []IndexData) []IndexData { return applyOutputTimezone(series, outputLocation) })
+	}
+	if regime || regimeFilter != "" {
+		pipeline = append(pipeline, func(series []IndexData) []IndexData { return classifyMarketRegime(series, regimeWindow) })
+	}
+	if includeConfidence {
+		pipeline = append(pipeline, annotateConfidence)
+	}
+	if volRegime {
+		pipeline = append(pipeline, func(series []IndexData) []IndexData {
+			return detectVolatilityRegimes(series, volRegimeShortWindow, volRegimeLongWindow)
 		})
 	}
+	if runup {
+		pipeline = append(pipeline, computeRunup)
+	}
+	if volatility30D || annualiseVolatility {
+		pipeline = append(pipeline, func(series []IndexData) []IndexData { return computeVolatility30D(series, annualiseVolatility) })
+	}
+	stockDataIndex = append(pipeline, transforms...).Apply(stockDataIndex)
+	var alertDates []string
+	if thresholdAlert > 0 {
+		stockDataIndex = annotateAlerts(stockDataIndex, thresholdAlert)
+		alertDates = []string{}
+		for _, data := range stockDataIndex {
+			if data.Alert {
+				alertDates = append(alertDates, data.Date)
+			}
+		}
+	}
+
+	if normalize == "zscore" {
+		stockDataIndex = computeExpandingZScore(stockDataIndex)
+	}
+	if from != "" {
+		stockDataIndex = seriesSince(stockDataIndex, from)
+	}
+	var regimeGaps []RegimeGap
+	if regimeFilter != "" {
+		stockDataIndex, regimeGaps = filterRegime(stockDataIndex, regimeFilter)
+	}
+	stockDataIndex = Resample(stockDataIndex, frequency)
+
+	response := IndexResponse{Index: stockDataIndex}
+	if componentErr != nil {
+		response.Errors = componentErr.Errors
+	}
+	response.AlertDates = alertDates
+	response.Gaps = regimeGaps
+	response.Summary = summary
+	if debug {
+		response.DebugTrace = append([]string{}, trace...)
+	}
+	if paginated {
+		var pagination Pagination
+		response.Index, pagination = paginate(stockDataIndex, page, pageSize)
+		response.Pagination = &pagination
+		stockDataIndex = response.Index
+	}
+	if includeDateGaps {
+		response.FilledDates = filledDates(stockDataIndex, maxFilledDates)
+	}
+	if includeRawData {
+		response.Components = a.componentSeries(r.Context(), fund, stockDataIndex)
+	}
+
+	// Let clients know when the data is being refreshed in the background.
+	if stale {
+		w.Header().Set("X-Cache", "STALE")
+	}
+
+	if seriesOnly {
+		if err := writeResponse(w, r, stockDataIndex); err != nil {
+			writeJSONError(w, fmt.Sprintf("Error encoding %s data", format), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if fieldsHash {
+		indexJSON, err := json.Marshal(response.Index)
+		if err != nil {
+			writeJSONError(w, "Error encoding JSON data", http.StatusInternalServerError)
+			return
+		}
+		response.DataHash = computeResponseHash(indexJSON)
+	}
+
+	payload := response.payload()
+	switch {
+	case response.Errors != nil:
+	case groupBy == "quarter":
+		payload = aggregateQuarterly(stockDataIndex)
+	case groupBy == "year":
+		payload = aggregateAnnual(stockDataIndex)
+	}
+
+	if format == "msgpack" {
+		msgpackData, err := encodeMsgpack(payload)
+		if err != nil {
+			writeJSONError(w, "Error encoding MessagePack data", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-msgpack")
+		w.Write(msgpackData)
+		return
+	}
 
 	// Return stockDataIndex as JSON
-	jsonIndexData, err := json.Marshal(stockDataIndex)
+	jsonIndexData, err := json.Marshal(payload)
 	if err != nil {
-		log.Fatal("Error marshalling JSON data:", err)
+		writeJSONError(w, "Error encoding JSON data", http.StatusInternalServerError)
+		return
 	}
 
 	// set the content type to JSON
 	w.Header().Set("Content-Type", "application/json")
 
-	// Allow for cross-origin requests from any origin
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-
 	fmt.Fprintf(w, "%s", jsonIndexData)
 }
 
-func (a *App) PrepareSymbolJSONData(symbol string, startDate string) ([]StockData, error) {
-	// URL of the EOD Historical API (replace with the actual endpoint)
-	url := "https://eodhd.com/api/eod/" + symbol + "?api_token=" + a.EODAPIKEY + "&fmt=json&from=" + startDate
+// eodFetchTimeout bounds a fetch from EODHD, including its retries, as the
+// fetch outlives the request that started it.
+const eodFetchTimeout = 2 * time.Minute
 
-	currentUTCDate := time.Now().UTC().Format(time.DateOnly)
-	directory := a.bucketCacheDirectory + "/" + symbol
-	fileName := currentUTCDate + ".json"
-	fullPath := a.bucketCacheDirectory + "/" + symbol + "/" + currentUTCDate + ".json"
+// errUpstreamUnavailable is wrapped by errors fetching data from EODHD.
+var errUpstreamUnavailable = errors.New("upstream data unavailable")
 
-	// Check if the file exists
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-		// If the file does not exist, read data from the URL
-		body, err := readDataFromURL(url)
-		if err != nil {
-			log.Fatal("Error reading data from URL:", err)
+// writeIndexError reports an error computing the index series. Upstream
+// failures are reported as 503 Service Unavailable so that clients retry.
+func (a *App) writeIndexError(ctx context.Context, w http.ResponseWriter, err error) {
+	a.logRequest(ctx, logging.Entry{
+		Severity: logging.Error,
+		Payload:  fmt.Sprintf("error computing index series: %v", err),
+	})
+	if errors.Is(err, errUpstreamUnavailable) {
+		writeJSONError(w, errUpstreamUnavailable.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	writeJSONError(w, "unable to compute index series", http.StatusInternalServerError)
+}
+
+// indexOptions selects the variant of the fund index computed by
+// computeIndexSeries. The zero value is the standard index.
+type indexOptions struct {
+	// SplitOnly adjusts the components for splits but not for dividends.
+	SplitOnly bool
+	// CryptoCalendar restricts the index to the dates BTC traded, if the fund
+	// holds BTC.
+	CryptoCalendar bool
+	// Rebalance selects a rebalancing mode and its taxes.
+	Rebalance RebalanceConfig
+	// OffsetDays shifts the BTC dates by the given number of days, if the
+	// fund holds BTC.
+	OffsetDays int
+	// Fill selects how days without a component price are filled. The zero
+	// value is FillLast.
+	Fill FillStrategy
+	// FillBusinessDaysOnly leaves Saturdays and Sundays out of the index instead of
+	// filling them.
+	FillBusinessDaysOnly bool
+	// To leaves out the component data after the given date.
+	To string
+	// ClampReturns caps the daily return of every component at plus or
+	// minus the given fraction when set.
+	ClampReturns float64
+	// Trace, when set, records the raw data, fills and blend of every day.
+	Trace *computationTrace
+	// Stale, when set, is set to whether stale component data was used.
+	Stale *bool
+}
+
+// computeIndexSeries blends the component series of the fund into its index.
+// The index is computed from the fund inception, or the first date every
+// component has a price, and, when from is set, trimmed to start at from and
+// rebased to 100 on that date. opts selects a variant of the index; with risk
+// parity rebalancing the weights are not used.
+func (a *App) computeIndexSeries(ctx context.Context, fund FundDefinition, from string, opts indexOptions) ([]IndexData, error) {
+	symbols := fund.Symbols()
+	data, tickerErrors, stale := a.fetchSymbols(ctx, symbols, fund.inception(), opts.To)
+	if opts.Stale != nil {
+		*opts.Stale = stale
+	}
+	if len(tickerErrors) > 0 {
+		return nil, &componentError{Errors: tickerErrors}
+	}
+	components := make([][]StockData, len(symbols))
+	weights := make([]float64, len(symbols))
+	btc := -1
+	for i, c := range fund.Components {
+		components[i], weights[i] = data[c.Symbol], c.Weight
+		if c.Symbol == btcComponent {
+			btc = i
 		}
-		// Parse the JSON data into a slice of StockData
-		var stockData []StockData
-		err = json.Unmarshal(body, &stockData)
-		if err != nil {
-			log.Fatal("Error unmarshalling JSON data:", err)
+		for _, point := range components[i] {
+			opts.Trace.add("raw %s %s adjusted_close=%.4f", c.Symbol, point.Date, point.AdjClose)
 		}
+	}
 
-		// Save the data to a file
-		saveData(body, directory, fileName)
-		if err != nil {
-			log.Fatal("Error saving data to file:", err)
+	var err error
+
+	if opts.SplitOnly {
+		for i, symbol := range symbols {
+			if components[i], err = a.splitOnlySeries(ctx, symbol, components[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if opts.ClampReturns > 0 {
+		for i := range components {
+			components[i] = clampStockData(components[i], opts.ClampReturns)
+		}
+	}
+
+	if opts.OffsetDays != 0 && btc >= 0 {
+		components[btc] = shiftStockData(components[btc], opts.OffsetDays)
+	}
+
+	var stockDataIndex []IndexData
+	if opts.Rebalance.Mode != "" {
+		if !fund.rebalanceable() {
+			return nil, errRebalanceComponents
+		}
+		opts.Trace.add("%s rebalancing: the daily blend is not traced", opts.Rebalance.Mode)
+		stockDataIndex, err = rebalancedIndex(components[0], components[1], [2]float64{weights[0], weights[1]}, fund.inception(), opts.Rebalance)
+	} else {
+		fill := opts.Fill
+		if fill == "" {
+			fill = FillLast
+		}
+		stockDataIndex, err = blendIndex(components, weights, fund.inception(), fill, opts.FillBusinessDaysOnly, opts.Trace)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.CryptoCalendar && btc >= 0 {
+		stockDataIndex = restrictToTradedDates(stockDataIndex, components[btc])
+	}
+	if opts.OffsetDays != 0 {
+		end := ""
+		for i, component := range components {
+			if last := component[len(component)-1].Date; i == 0 || minDateStr(end, last) == last {
+				end = last
+			}
+		}
+		stockDataIndex = clipSeries(stockDataIndex, end)
+	}
+	if from != "" {
+		stockDataIndex = rebaseSeries(stockDataIndex, from)
+	}
+	return stockDataIndex, nil
+}
+
+// blendIndex combines the component price series into an index that equals
+// 100 on the first date, on or after startDate, for which every component has
+// a price. Each component contributes its adjusted close multiplied by its
+// weight. Components are filled onto a daily calendar up to the most recent
+// date of any component using fill, skipping weekends with businessDays.
+// Every component is filled over the same range, so the filled slices have the
+// same length and the same date at each index, which the blend below relies
+// on. When trace is set, the fills and the blend of every day are recorded in
+// it.
+func blendIndex(components [][]StockData, weights []float64, startDate string, fill FillStrategy, businessDays bool, trace *computationTrace) ([]IndexData, error) {
+	if len(components) == 0 || len(components) != len(weights) {
+		return nil, fmt.Errorf("expected one weight per component")
+	}
+	start, end := startDate, ""
+	for _, component := range components {
+		if len(component) == 0 {
+			return nil, fmt.Errorf("no component data available")
+		}
+		start = maxDateStr(start, component[0].Date)
+		end = maxDateStr(end, component[len(component)-1].Date)
+	}
+
+	filled := make([][]StockData, len(components))
+	for i, component := range components {
+		filled[i] = forwardFillStockData(component, start, end, fill, businessDays)
+		if len(filled[i]) == 0 {
+			return nil, fmt.Errorf("no component data available since %s", start)
+		}
+	}
+
+	value := func(i int) (float64, int) {
+		total, streak := 0.0, 0
+		for c := range filled {
+			total += filled[c][i].AdjClose * weights[c]
+			streak = max(streak, filled[c][i].FillStreak)
+		}
+		return total, streak
+	}
+	initialIndexValue, _ := value(0)
+	if initialIndexValue == 0 {
+		return nil, fmt.Errorf("index value is zero on %s", start)
+	}
+
+	series := make([]IndexData, 0, len(filled[0]))
+	for i := range filled[0] {
+		total, streak := value(i)
+		if trace != nil {
+			for c := range filled {
+				if point := filled[c][i]; point.FillStreak > 0 {
+					trace.add("fill component %d %s with %s (%d days)", c, point.Date, fill, point.FillStreak)
+				}
+			}
+			terms := make([]string, len(filled))
+			for c := range filled {
+				terms[c] = fmt.Sprintf("%g x %.4f", weights[c], filled[c][i].AdjClose)
+			}
+			trace.add("blend %s: %s = %.4f, / %.4f * 100 = %.4f", filled[0][i].Date, strings.Join(terms, " + "), total, initialIndexValue, total/initialIndexValue*100)
+		}
+		series = append(series, IndexData{
+			Date:       filled[0][i].Date,
+			AdjClose:   total / initialIndexValue * 100,
+			FillStreak: streak,
+		})
+	}
+	return series, nil
+}
+
+// restrictToTradedDates keeps the points of series on dates for which data
+// has a price. With the crypto calendar the index follows the days BTC
+// actually traded: BTC points are used as-is, including weekends and
+// holidays, while VOO keeps its most recent close, e.g. Friday's on a
+// Saturday. Dates missing from the BTC data are dropped instead of filled.
+func restrictToTradedDates(series []IndexData, data []StockData) []IndexData {
+	traded := make(map[string]bool, len(data))
+	for _, d := range data {
+		traded[d.Date] = true
+	}
+	restricted := make([]IndexData, 0, len(series))
+	for _, point := range series {
+		if traded[point.Date] {
+			restricted = append(restricted, point)
+		}
+	}
+	return restricted
+}
+
+// clampDailyReturn returns the return from prev to curr, capped at plus or
+// minus maxReturn.
+func clampDailyReturn(prev, curr float64, maxReturn float64) float64 {
+	if prev == 0 {
+		return 0
+	}
+	return max(-maxReturn, min(curr/prev-1, maxReturn))
+}
+
+// clampStockData rebuilds the adjusted closes of data from its daily returns
+// capped at plus or minus maxReturn, starting from the first close.
+func clampStockData(data []StockData, maxReturn float64) []StockData {
+	clamped := make([]StockData, len(data))
+	copy(clamped, data)
+	for i := 1; i < len(data); i++ {
+		clamped[i].AdjClose = clamped[i-1].AdjClose * (1 + clampDailyReturn(data[i-1].AdjClose, data[i].AdjClose, maxReturn))
+	}
+	return clamped
+}
+
+// shiftStockData returns a copy of data with every date moved by days, which
+// may be negative.
+func shiftStockData(data []StockData, days int) []StockData {
+	shifted := make([]StockData, len(data))
+	for i, d := range data {
+		date, err := time.Parse(time.DateOnly, d.Date)
+		if err == nil {
+			d.Date = date.AddDate(0, 0, days).Format(time.DateOnly)
+		}
+		shifted[i] = d
+	}
+	return shifted
+}
+
+// clipSeries drops the points of series after endDate.
+func clipSeries(series []IndexData, endDate string) []IndexData {
+	for i, point := range series {
+		if point.Date != endDate && maxDateStr(point.Date, endDate) == point.Date {
+			return series[:i]
+		}
+	}
+	return series
+}
+
+// seriesSince drops the points of series before from. Unlike rebaseSeries the
+// values are kept, so that a window matches the same dates of the full index.
+func seriesSince(series []IndexData, from string) []IndexData {
+	for i, point := range series {
+		if maxDateStr(point.Date, from) == point.Date {
+			return series[i:]
+		}
+	}
+	return series[:0]
+}
+
+// rebaseAt rescales the series so that it equals 100 on baseDate. Points
+// before baseDate may be below 100. baseDate must lie within the series; on a
+// date without a point the last value before it is used.
+func rebaseAt(series []IndexData, baseDate string) ([]IndexData, error) {
+	if len(series) == 0 {
+		return series, nil
+	}
+	first, last := series[0].Date, series[len(series)-1].Date
+	if maxDateStr(baseDate, first) != baseDate || minDateStr(baseDate, last) != baseDate {
+		return nil, fmt.Errorf("invalid 'base_date' value '%s', expected a date between %s and %s", baseDate, first, last)
+	}
+	base := valueOn(series, baseDate)
+	if base == 0 {
+		return nil, fmt.Errorf("index value is zero on %s", baseDate)
+	}
+	rebased := make([]IndexData, len(series))
+	for i, data := range series {
+		data.AdjClose = data.AdjClose / base * 100
+		rebased[i] = data
+	}
+	return rebased, nil
+}
+
+// rebaseSeries drops the points before from and rescales the remaining points
+// so that the first one equals 100.
+func rebaseSeries(series []IndexData, from string) []IndexData {
+	var rebased []IndexData
+	for _, data := range series {
+		if maxDateStr(data.Date, from) != data.Date {
+			continue
+		}
+		rebased = append(rebased, data)
+	}
+	if len(rebased) == 0 || rebased[0].AdjClose == 0 {
+		return rebased
+	}
+	base := rebased[0].AdjClose
+	for i := range rebased {
+		rebased[i].AdjClose = rebased[i].AdjClose / base * 100
+	}
+	return rebased
+}
+
+// PrepareSymbolJSONData returns the daily data of symbol from startDate,
+// fetching it when it is not cached yet today. When endDate is set, data after
+// endDate is left out; the cache always holds the full history.
+func (a *App) PrepareSymbolJSONData(ctx context.Context, symbol string, startDate string, endDate string) ([]StockData, error) {
+	stockData, _, err := a.prepareSymbolData(ctx, symbol, startDate, endDate)
+	return stockData, err
+}
+
+// prepareSymbolData is PrepareSymbolJSONData, also reporting whether the data
+// is stale. With stale-while-revalidate, the most recent cached data is
+// returned right away and refreshed in the background. The data is always
+// fetched and cached from componentHistoryStart, as the cache is keyed by
+// symbol and date only, and trimmed to startDate.
+func (a *App) prepareSymbolData(ctx context.Context, symbol string, startDate string, endDate string) ([]StockData, bool, error) {
+	now := time.Now()
+	currentUTCDate := now.UTC().Format(time.DateOnly)
+
+	if a.staleThreshold > 0 {
+		if stockData, stale, ok := a.staleSymbolData(ctx, symbol, componentHistoryStart, now); ok {
+			return truncateStockData(sinceStockData(stockData, startDate), endDate), stale, nil
 		}
+	} else if stockData, ok := a.memCache.Get(cacheObjectName(symbol, currentUTCDate)); ok {
+		a.promMetrics.cacheResult(symbol, true)
+		return truncateStockData(sinceStockData(stockData, startDate), endDate), false, nil
+	}
 
-		// Confirm successful write
-		fmt.Printf("Data successfully saved to '%s'\n", fullPath)
+	// Concurrent requests for the same data share a single read or fetch,
+	// so that only one of them calls the EOD API and writes the file.
+	// A caller that goes away stops waiting, but the shared fetch goes on.
+	fetch := a.fetches.DoChan(symbol, func() (any, error) {
+		return a.loadSymbolData(ctx, symbol, componentHistoryStart, currentUTCDate)
+	})
+	var result singleflight.Result
+	select {
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	case result = <-fetch:
+	}
+	if result.Err != nil {
+		return nil, false, result.Err
+	}
+	return truncateStockData(sinceStockData(result.Val.([]StockData), startDate), endDate), false, nil
+}
+
+// loadSymbolData reads the data of symbol cached on the given date, fetching
+// and caching it from the EOD API when it is missing.
+func (a *App) loadSymbolData(ctx context.Context, symbol, startDate, currentUTCDate string) ([]StockData, error) {
+	// Read the cached data, which the backend discards if it no longer
+	// matches its checksum
+	stockData, err := a.readCachedSymbolData(ctx, symbol, currentUTCDate)
+
+	// Check if the file exists
+	a.promMetrics.cacheResult(symbol, !errors.Is(err, fs.ErrNotExist))
+	if errors.Is(err, fs.ErrNotExist) {
+		// If the file does not exist, read data from the URL
+		return a.fetchSymbolData(ctx, symbol, startDate, currentUTCDate)
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading data from cache: %w", err)
 	}
 
-	// If the file exists, read data from the file
-	fileData, err := os.ReadFile(fullPath)
+	// Return the JSON data
+	return stockData, nil
+}
+
+// readCachedSymbolData returns the data of symbol cached on date without
+// fetching it. It returns an error wrapping fs.ErrNotExist when nothing is
+// cached on date.
+func (a *App) readCachedSymbolData(ctx context.Context, symbol, date string) ([]StockData, error) {
+	if stockData, ok := a.memCache.Get(cacheObjectName(symbol, date)); ok {
+		return stockData, nil
+	}
+	lock := a.cacheLocks.forSymbol(symbol)
+	lock.RLock()
+	defer lock.RUnlock()
+	body, err := a.cache().Read(symbol, date)
+	if errors.Is(err, errChecksumMismatch) {
+		a.logCorruptCache(ctx, a.cache().Location(symbol, date), err)
+		return nil, fmt.Errorf("%w: %w", fs.ErrNotExist, err)
+	}
 	if err != nil {
-		log.Fatal("Error reading data from file:", err)
+		return nil, err
+	}
+	var stockData []StockData
+	if err := json.Unmarshal(body, &stockData); err != nil {
+		return nil, fmt.Errorf("error unmarshalling JSON data from cache: %w", err)
 	}
+	a.memCache.Add(cacheObjectName(symbol, date), stockData)
+	return stockData, nil
+}
+
+// fetchSymbolData fetches the data of symbol from the EOD API, unless it has
+// been failing, and caches it under the given date.
+func (a *App) fetchSymbolData(ctx context.Context, symbol, startDate, currentUTCDate string) ([]StockData, error) {
+	// URL of the EOD Historical API (replace with the actual endpoint)
+	url := a.eodBaseURL + "/eod/" + symbol + "?fmt=json&from=" + startDate
 
+	cache := a.cache()
+	location := cache.Location(symbol, currentUTCDate)
+
+	// Keep eviction from deleting the files of symbol while they are written
+	lock := a.cacheLocks.forSymbol(symbol)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	if err := a.eodBreaker.Allow(); err != nil {
+		return nil, fmt.Errorf("%w: %w", errUpstreamUnavailable, err)
+	}
+	// The fetch is shared by every caller waiting for symbol, so it is not
+	// cancelled with the request that started it, only bounded in time.
+	fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), eodFetchTimeout)
+	defer cancel()
+	fetchedAt := time.Now()
+	body, err := a.fetchEOD(fetchCtx, url)
+	a.eodBreaker.Record(err)
+	a.promMetrics.eodCall(symbol, err)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error reading data from URL: %w", errUpstreamUnavailable, err)
+	}
 	// Parse the JSON data into a slice of StockData
 	var stockData []StockData
-	err = json.Unmarshal(fileData, &stockData)
+	err = json.Unmarshal(body, &stockData)
 	if err != nil {
-		log.Fatal("Error unmarshalling JSON data from file:", err)
+		return nil, fmt.Errorf("error unmarshalling JSON data: %w", err)
 	}
 
-	// Return the JSON data
+	// Save the data to the cache
+	if err := cache.Write(symbol, currentUTCDate, body); err != nil {
+		return nil, fmt.Errorf("error saving data to cache: %w", err)
+	}
+
+	a.logRequest(ctx, logging.Entry{
+		Severity: logging.Debug,
+		Payload:  fmt.Sprintf("data of %s saved to %s", symbol, location),
+	})
+
+	// Let subscribers know that fresh data is available
+	a.publishCacheWrite(ctx, WrittenToCacheEvent{
+		Ticker:    symbol,
+		Date:      currentUTCDate,
+		FilePath:  location,
+		SizeBytes: len(body),
+	})
+	a.memCache.Add(cacheObjectName(symbol, currentUTCDate), stockData)
+	a.refreshes.fetched(symbol, fetchedAt)
 	return stockData, nil
 }
 
+// sinceStockData returns the points of data on or after startDate.
+func sinceStockData(data []StockData, startDate string) []StockData {
+	for i, point := range data {
+		if maxDateStr(point.Date, startDate) == point.Date {
+			return data[i:]
+		}
+	}
+	return data[len(data):]
+}
+
+// truncateStockData returns the data on or before endDate, or all of data
+// when endDate is empty. data must be sorted by date.
+func truncateStockData(data []StockData, endDate string) []StockData {
+	if endDate == "" {
+		return data
+	}
+	for i, point := range data {
+		if point.Date != endDate && maxDateStr(point.Date, endDate) == point.Date {
+			return data[:i:i]
+		}
+	}
+	return data
+}
+
+// TickerError is a failure to fetch the data of one ticker.
+type TickerError struct {
+	Ticker  string `json:"ticker"`
+	Message string `json:"message"`
+}
+
+// componentError reports the fund components whose data could not be fetched.
+type componentError struct {
+	Errors []TickerError
+}
+
+func (e *componentError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, tickerErr := range e.Errors {
+		messages[i] = tickerErr.Ticker + ": " + tickerErr.Message
+	}
+	return "unable to fetch component data: " + strings.Join(messages, "; ")
+}
+
+// FetchSymbolsConcurrently prepares the data of every symbol in parallel. It
+// returns the data of the symbols that could be fetched and an error for each
+// symbol that could not, in the order of symbols.
+func (a *App) FetchSymbolsConcurrently(ctx context.Context, symbols []string, startDate, endDate string) (map[string][]StockData, []TickerError) {
+	data, tickerErrors, _ := a.fetchSymbols(ctx, symbols, startDate, endDate)
+	return data, tickerErrors
+}
+
+// fetchSymbols is FetchSymbolsConcurrently, also reporting whether the data
+// of any symbol is stale.
+func (a *App) fetchSymbols(ctx context.Context, symbols []string, startDate, endDate string) (map[string][]StockData, []TickerError, bool) {
+	results := make([][]StockData, len(symbols))
+	stale := make([]bool, len(symbols))
+	errs := make([]error, len(symbols))
+	var wg sync.WaitGroup
+	for i, symbol := range symbols {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], stale[i], errs[i] = a.prepareSymbolData(ctx, symbol, startDate, endDate)
+		}()
+	}
+	wg.Wait()
+
+	data := make(map[string][]StockData, len(symbols))
+	var tickerErrors []TickerError
+	for i, symbol := range symbols {
+		if errs[i] != nil {
+			// The error may describe the upstream request, so clients are
+			// only told whether EODHD is unavailable.
+			a.logRequest(ctx, logging.Entry{
+				Severity: logging.Error,
+				Payload:  fmt.Sprintf("error fetching %s: %v", symbol, errs[i]),
+			})
+			message := "unable to read data"
+			if errors.Is(errs[i], errUpstreamUnavailable) {
+				message = errUpstreamUnavailable.Error()
+			}
+			tickerErrors = append(tickerErrors, TickerError{Ticker: symbol, Message: message})
+			continue
+		}
+		data[symbol] = results[i]
+	}
+	return data, tickerErrors, slices.Contains(stale, true)
+}
+
+// fillConfidence returns how much a price that has been forward filled for
+// streak consecutive days can be trusted: 1 for a real price, 0.1 less for
+// every filled day, and never below 0.1.
+func fillConfidence(streak int) float64 {
+	return math.Max(1-0.1*float64(streak), 0.1)
+}
+
+// FillStrategy selects how forwardFillStockData fills dates without data.
+type FillStrategy string
+
+// Fill strategies accepted by ?fill_strategy.
+const (
+	// FillLast carries the last known data forward.
+	FillLast FillStrategy = "last"
+	// FillZero fills the prices and volume with zero, e.g. for volume data.
+	FillZero FillStrategy = "zero"
+	// FillMean fills with the mean of the closest known data before and
+	// after the gap. A gap at the end of the series is filled like FillLast.
+	FillMean FillStrategy = "mean"
+)
+
 // Function to forward fill the StockData slice for missing inbetween dates from the start date to the end date。 FF based on the last available data from the previous date
-func forwardFillStockData(stockData []StockData, startDate string, endDate string) []StockData {
+// With skipWeekends, Saturdays and Sundays are left out of the result; data
+// on a weekend is still carried forward to the following Monday if needed.
+func forwardFillStockData(stockData []StockData, startDate string, endDate string, strategy FillStrategy, skipWeekends bool) []StockData {
 	// Create a map to store the stock data by date
 	stockDataMap := make(map[string]StockData)
 	for _, data := range stockData {
@@ -198,26 +1267,49 @@ func forwardFillStockData(stockData []StockData, startDate string, endDate strin
 	// Create a slice to hold the forward-filled data
 	var filledData []StockData
 
+	// Seed the fill with the last data point before the start date so that
+	// the range can start on a day without data (e.g. a weekend).
+	var lastData *StockData
+	for i := range stockData {
+		if stockData[i].Date != startDate && maxDateStr(stockData[i].Date, startDate) == startDate {
+			lastData = &stockData[i]
+		}
+	}
+
+	// known is the closest known data before a gap and next the index of the
+	// closest known data after it.
+	known, next := lastData, 0
+
 	// Iterate through the date range and fill in missing dates
 	currentDate := startDate
-	for currentDate <= endDate {
+	for currentDate != "" && maxDateStr(currentDate, endDate) == endDate {
+		for next < len(stockData) && maxDateStr(stockData[next].Date, currentDate) == currentDate {
+			next++
+		}
+		if skipWeekends && isWeekend(currentDate) {
+			if data, exists := stockDataMap[currentDate]; exists {
+				lastData, known = &data, &data
+			}
+			currentDate = incrementDate(currentDate)
+			continue
+		}
 		if data, exists := stockDataMap[currentDate]; exists {
 			filledData = append(filledData, data)
-		} else {
+			lastData = &filledData[len(filledData)-1]
+			known = lastData
+		} else if lastData != nil {
 			// If the date does not exist, use the last available data
-			if len(filledData) > 0 {
-				lastData := filledData[len(filledData)-1]
-				data := StockData{
-					Date:     currentDate,
-					Open:     lastData.Open,
-					High:     lastData.High,
-					Low:      lastData.Low,
-					Close:    lastData.Close,
-					AdjClose: lastData.AdjClose,
-					Volume:   lastData.Volume,
-				}
-				filledData = append(filledData, data)
+			data := *lastData
+			data.Date = currentDate
+			data.FillStreak++
+			switch {
+			case strategy == FillZero:
+				data.Open, data.High, data.Low, data.Close, data.AdjClose, data.SplitAdjClose, data.Volume = 0, 0, 0, 0, 0, 0, 0
+			case strategy == FillMean && next < len(stockData):
+				data = meanStockData(*known, stockData[next], currentDate, data.FillStreak)
 			}
+			filledData = append(filledData, data)
+			lastData = &filledData[len(filledData)-1]
 		}
 		currentDate = incrementDate(currentDate)
 	}
@@ -225,14 +1317,87 @@ func forwardFillStockData(stockData []StockData, startDate string, endDate strin
 	return filledData
 }
 
+// isWeekend reports whether date falls on a Saturday or Sunday.
+func isWeekend(date string) bool {
+	t, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		return false
+	}
+	return t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+}
+
+// meanStockData returns the mean of the prices and volume of prev and next
+// as filled data for date.
+func meanStockData(prev, next StockData, date string, streak int) StockData {
+	prev.Date, prev.FillStreak = date, streak
+	prev.Open = (prev.Open + next.Open) / 2
+	prev.High = (prev.High + next.High) / 2
+	prev.Low = (prev.Low + next.Low) / 2
+	prev.Close = (prev.Close + next.Close) / 2
+	prev.AdjClose = (prev.AdjClose + next.AdjClose) / 2
+	prev.SplitAdjClose = (prev.SplitAdjClose + next.SplitAdjClose) / 2
+	prev.Volume = (prev.Volume + next.Volume) / 2
+	return prev
+}
+
+// readDataFromURL reads the body of url, retrying transient failures as
+// configured by policy. Retries stop when ctx is done.
+func readDataFromURL(ctx context.Context, url string, policy retryPolicy) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		body, err := getURL(ctx, url)
+		if err == nil || attempt+1 >= policy.Attempts {
+			return body, redactAPIToken(err)
+		}
+		delay, retry := policy.delay(err, attempt)
+		if !retry {
+			return nil, redactAPIToken(err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// redactAPIToken removes the api_token query parameter from the URL of err,
+// as net/http includes the URL in the errors of requests.
+func redactAPIToken(err error) error {
+	var urlErr *neturl.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	if u, parseErr := neturl.Parse(urlErr.URL); parseErr == nil {
+		query := u.Query()
+		if query.Has("api_token") {
+			query.Set("api_token", "REDACTED")
+			u.RawQuery = query.Encode()
+		}
+		urlErr.URL = u.String()
+	} else {
+		urlErr.URL = "<redacted>"
+	}
+	return err
+}
+
 // Function to read data from URL and return body
-func readDataFromURL(url string) ([]byte, error) {
+func getURL(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
 	// Send a GET request to the URL
-	resp, err := http.Get(url)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &httpStatusError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
 
 	// Read the body of the response
 	body, err := io.ReadAll(resp.Body)
@@ -243,43 +1408,117 @@ func readDataFromURL(url string) ([]byte, error) {
 	return body, nil
 }
 
-// saveData saves the JSON data to a file in a specific directory
-// filename optional, if not provided, a default name will be used
-func saveData(data []byte, fileDirectory string, fileName string) {
-	// Ensure the directory exists, create it if it doesn't
-	if _, err := os.Stat(fileDirectory); os.IsNotExist(err) {
-		err := os.MkdirAll(fileDirectory, os.ModePerm)
-		if err != nil {
-			log.Fatal("Error creating directory:", err)
-		}
-	}
+// httpStatusError reports an unsuccessful HTTP response. The URL is not
+// included since it may contain an API key.
+type httpStatusError struct {
+	StatusCode int
+	// RetryAfter is the delay requested by the Retry-After header, if any.
+	RetryAfter time.Duration
+}
 
-	// Combine directory with file name to get the full file path
-	filePath := fmt.Sprintf("%s/%s", fileDirectory, fileName)
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status %d", e.StatusCode)
+}
 
-	// Create or open the file for writing
-	file, err := os.Create(filePath)
+// incrementDate increments a date string by one day.
+func incrementDate(date string) string {
+	t, err := time.Parse(time.DateOnly, date)
 	if err != nil {
-		log.Fatal("Error creating file:", err)
+		return "" // Handle error appropriately in real application
 	}
-	defer file.Close()
+	t = t.AddDate(0, 0, 1)
+	return t.Format(time.DateOnly)
+}
 
-	// Write the data to the file
-	_, err = file.Write(data)
+// parseBoolParam parses an optional boolean query parameter. A missing
+// parameter is false.
+func parseBoolParam(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
 	if err != nil {
-		log.Fatal("Error writing data to file:", err)
+		return false, fmt.Errorf("invalid '%s' value '%s', expected true or false", name, value)
 	}
+	return b, nil
+}
 
-	// Confirm successful write
-	fmt.Printf("Data successfully saved to '%s'\n", filePath)
+// validateDateParam parses a date query parameter in YYYY-MM-DD (or
+// YYYYMMDD) format and reports what is wrong with it in terms a caller can
+// act on, e.g. "invalid 'from' date '20210132': month 01 does not have 32
+// days".
+func validateDateParam(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("missing '%s' date, expected YYYY-MM-DD", name)
+	}
+	m := dateParamPattern.FindStringSubmatch(value)
+	if m == nil {
+		return time.Time{}, fmt.Errorf("invalid '%s' date '%s': expected YYYY-MM-DD", name, value)
+	}
+	year, _ := strconv.Atoi(m[1])
+	month, _ := strconv.Atoi(m[2])
+	day, _ := strconv.Atoi(m[3])
+	if month < 1 || month > 12 {
+		return time.Time{}, fmt.Errorf("invalid '%s' date '%s': month %s is not between 01 and 12", name, value, m[2])
+	}
+	if days := time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day(); day < 1 || day > days {
+		return time.Time{}, fmt.Errorf("invalid '%s' date '%s': month %s does not have %s days", name, value, m[2], m[3])
+	}
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC), nil
 }
 
-// incrementDate increments a date string by one day.
-func incrementDate(date string) string {
-	t, err := time.Parse(time.DateOnly, date)
+// optionalDateParam reads an optional date query parameter and returns it in
+// YYYY-MM-DD format, or an empty string when the parameter is absent.
+func optionalDateParam(r *http.Request, name string) (string, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return "", nil
+	}
+	date, err := validateDateParam(name, value)
 	if err != nil {
-		return "" // Handle error appropriately in real application
+		return "", err
 	}
-	t = t.AddDate(0, 0, 1)
-	return t.Format(time.DateOnly)
+	return date.Format(time.DateOnly), nil
+}
+
+// dateParamPattern matches YYYY-MM-DD and YYYYMMDD dates.
+var dateParamPattern = regexp.MustCompile(`^(\d{4})-?(\d{2})-?(\d{2})$`)
+
+// maxDateStr returns the later of two date strings in time.DateOnly format.
+// An unparsable date never wins over a valid one; if neither date is valid an
+// empty string is returned.
+func maxDateStr(a, b string) string {
+	ta, errA := time.Parse(time.DateOnly, a)
+	tb, errB := time.Parse(time.DateOnly, b)
+	switch {
+	case errA != nil && errB != nil:
+		return ""
+	case errA != nil:
+		return b
+	case errB != nil:
+		return a
+	case tb.After(ta):
+		return b
+	}
+	return a
+}
+
+// minDateStr returns the earlier of two date strings in time.DateOnly format.
+// An unparsable date never wins over a valid one; if neither date is valid an
+// empty string is returned.
+func minDateStr(a, b string) string {
+	ta, errA := time.Parse(time.DateOnly, a)
+	tb, errB := time.Parse(time.DateOnly, b)
+	switch {
+	case errA != nil && errB != nil:
+		return ""
+	case errA != nil:
+		return b
+	case errB != nil:
+		return a
+	case tb.Before(ta):
+		return b
+	}
+	return a
 }
@@ -15,23 +15,38 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"cloud.google.com/go/logging"
+	"github.com/gorilla/mux"
+	"github.com/parquet-go/parquet-go"
+	"github.com/vmihailenco/msgpack/v5"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
-func TestHandler(t *testing.T) {
-	ctx := context.Background()
-	rr := httptest.NewRecorder()
-	req := httptest.NewRequest("GET", "http://example.com", nil)
-	client, err := logging.NewClient(ctx, "projects/testing",
+// newTestApp returns an App whose logger writes to stderr and whose cache
+// directory is a fresh temporary directory.
+func newTestApp(t testing.TB) *App {
+	t.Helper()
+	client, err := logging.NewClient(context.Background(), "projects/testing",
 		option.WithoutAuthentication(),
 		option.WithGRPCDialOption(
 			grpc.WithTransportCredentials(insecure.NewCredentials()),
@@ -40,16 +55,1174 @@ func TestHandler(t *testing.T) {
 	if err != nil {
 		t.Fatalf("unable to initialize logging client: %v", err)
 	}
-	app := &App{
-		log: client.Logger("test-log", logging.RedirectAsJSON(os.Stderr)),
+	return &App{
+		log:                  client.Logger("test-log", logging.RedirectAsJSON(os.Stderr)),
+		bucketCacheDirectory: t.TempDir(),
+		maxRawDataSeries:     defaultMaxRawDataSeries,
+	}
+}
+
+// fixtureSeries builds a daily series starting at start with the given
+// closing prices. Weekend dates are skipped when weekdaysOnly is set.
+func fixtureSeries(start string, weekdaysOnly bool, closes ...float64) []StockData {
+	var data []StockData
+	date := start
+	for _, c := range closes {
+		if weekdaysOnly {
+			for isWeekend(date) {
+				date = incrementDate(date)
+			}
+		}
+		data = append(data, StockData{Date: date, Open: c, High: c, Low: c, Close: c, AdjClose: c})
+		date = incrementDate(date)
+	}
+	return data
+}
+
+// writeFixture stores data as today's cache file for symbol so that
+// PrepareSymbolJSONData never reaches the network.
+func writeFixture(t testing.TB, app *App, symbol string, data []StockData) {
+	t.Helper()
+	body, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	dir := filepath.Join(app.bucketCacheDirectory, symbol)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatalf("os.MkdirAll: %v", err)
+	}
+	name := time.Now().UTC().Format(time.DateOnly) + ".json"
+	if err := os.WriteFile(filepath.Join(dir, name), body, 0o644); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101, 102, 103, 104))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 13, 14, 15, 16))
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://example.com/QUARTZ9", nil)
+	req = mux.SetURLVars(req, map[string]string{"symbol": "QUARTZ9"})
+	app.Handler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d", rr.Code, http.StatusOK)
+	}
+	var got []IndexData
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(got) != 7 {
+		t.Fatalf("len(index) = %d, want 7", len(got))
+	}
+	if got[0].AdjClose != 100 {
+		t.Errorf("index[0] = %v, want 100", got[0].AdjClose)
+	}
+}
+
+func TestHandlerInvalidSymbol(t *testing.T) {
+	app := newTestApp(t)
+	for _, symbol := range []string{"", "QUARTZ1"} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://example.com/"+symbol, nil)
+		req = mux.SetURLVars(req, map[string]string{"symbol": symbol})
+		app.Handler(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("symbol %q: Code = %d, want %d", symbol, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestMaxMinDateStr(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		max, min string
+	}{
+		{"2020-12-31", "2021-01-01", "2021-01-01", "2020-12-31"},
+		{"2021-01-01", "2020-12-31", "2021-01-01", "2020-12-31"},
+		{"2021-06-15", "2021-06-15", "2021-06-15", "2021-06-15"},
+		{"2021-6-15", "2021-06-14", "2021-06-14", "2021-06-14"},
+		{"2021-06-14", "not-a-date", "2021-06-14", "2021-06-14"},
+		{"2021-02-30", "garbage", "", ""},
+	}
+	for _, tc := range tests {
+		if got := maxDateStr(tc.a, tc.b); got != tc.max {
+			t.Errorf("maxDateStr(%q, %q) = %q, want %q", tc.a, tc.b, got, tc.max)
+		}
+		if got := minDateStr(tc.a, tc.b); got != tc.min {
+			t.Errorf("minDateStr(%q, %q) = %q, want %q", tc.a, tc.b, got, tc.min)
+		}
+	}
+}
+
+func TestForwardFillStockData(t *testing.T) {
+	// 2019-01-04 is a Friday; the weekend must be filled from Friday's data.
+	data := fixtureSeries("2019-01-03", true, 1, 2, 3)
+	got := forwardFillStockData(data, "2019-01-03", "2019-01-08", FillLast, false)
+	want := []float64{1, 2, 2, 2, 3, 3}
+	if len(got) != len(want) {
+		t.Fatalf("len = %d, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i].AdjClose != w {
+			t.Errorf("%s: AdjClose = %v, want %v", got[i].Date, got[i].AdjClose, w)
+		}
+	}
+	wantStreak := []int{0, 0, 1, 2, 0, 1}
+	for i, w := range wantStreak {
+		if got[i].FillStreak != w {
+			t.Errorf("%s: FillStreak = %d, want %d", got[i].Date, got[i].FillStreak, w)
+		}
+	}
+	// A range starting on a weekend is seeded from the preceding Friday.
+	if got := forwardFillStockData(data, "2019-01-05", "2019-01-07", FillLast, false); len(got) != 3 || got[0].AdjClose != 2 || got[0].Date != "2019-01-05" {
+		t.Errorf("weekend start: got %+v, want three points starting at 2019-01-05 with AdjClose 2", got)
+	}
+	if got := forwardFillStockData(data, "2019-01-03", "invalid", FillLast, false); len(got) != 0 {
+		t.Errorf("invalid end date: len = %d, want 0", len(got))
+	}
+}
+
+func TestForwardFillSkipWeekends(t *testing.T) {
+	// Two weeks of prices from Thursday 2019-01-03, with a price on
+	// Saturday 2019-01-12 and none on Monday 2019-01-14.
+	data := []StockData{
+		{Date: "2019-01-03", AdjClose: 1},
+		{Date: "2019-01-04", AdjClose: 2},
+		{Date: "2019-01-07", AdjClose: 3},
+		{Date: "2019-01-11", AdjClose: 4},
+		{Date: "2019-01-12", AdjClose: 5},
+		{Date: "2019-01-15", AdjClose: 6},
+	}
+	tests := []struct {
+		start, end   string
+		skipWeekends bool
+		want         []float64
+	}{
+		{"2019-01-03", "2019-01-16", false, []float64{1, 2, 2, 2, 3, 3, 3, 3, 4, 5, 5, 5, 6, 6}},
+		{"2019-01-03", "2019-01-16", true, []float64{1, 2, 3, 3, 3, 3, 4, 5, 6, 6}},
+		{"2019-01-05", "2019-01-08", true, []float64{3, 3}},
+		{"2019-01-12", "2019-01-13", true, nil},
+	}
+	for _, tt := range tests {
+		got := forwardFillStockData(data, tt.start, tt.end, FillLast, tt.skipWeekends)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s..%s skipWeekends=%t: len = %d, want %d", tt.start, tt.end, tt.skipWeekends, len(got), len(tt.want))
+			continue
+		}
+		for i, w := range tt.want {
+			if got[i].AdjClose != w {
+				t.Errorf("%s..%s skipWeekends=%t: %s: AdjClose = %v, want %v", tt.start, tt.end, tt.skipWeekends, got[i].Date, got[i].AdjClose, w)
+			}
+			if tt.skipWeekends && isWeekend(got[i].Date) {
+				t.Errorf("%s..%s: weekend date %s in result", tt.start, tt.end, got[i].Date)
+			}
+		}
+	}
+}
+
+func TestHandlerFillBusinessDaysOnly(t *testing.T) {
+	app := newTestApp(t)
+	// Friday 2019-01-04 and Wednesday 2019-01-09, with nothing in between.
+	writeFixture(t, app, "VOO.US", []StockData{{Date: "2019-01-04", AdjClose: 100}, {Date: "2019-01-09", AdjClose: 110}})
+	writeFixture(t, app, "BTC-USD.CC", []StockData{{Date: "2019-01-04", AdjClose: 10}, {Date: "2019-01-09", AdjClose: 11}})
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ9?"+query, nil))
+		return rr
+	}
+	rr := get("fill_business_days_only=true&fill_confidence=true")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got []IndexData
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	var filled []string
+	for _, data := range got {
+		if data.Confidence < 1 {
+			filled = append(filled, data.Date)
+		}
+	}
+	if want := []string{"2019-01-07", "2019-01-08"}; !slices.Equal(filled, want) {
+		t.Errorf("filled dates = %v, want %v", filled, want)
+	}
+	if len(got) != 4 {
+		t.Errorf("len = %d, want 4 business days", len(got))
+	}
+
+	for _, query := range []string{"fill_business_days_only=maybe", "fill_business_days_only=true&rebalance=monthly"} {
+		if rr := get(query); rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: Code = %d, want %d", query, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestForwardFillStrategies(t *testing.T) {
+	// Friday 1, Monday 4: the weekend gap is filled according to the strategy.
+	data := fixtureSeries("2019-01-04", true, 1, 4)
+	tests := []struct {
+		strategy FillStrategy
+		want     []float64
+	}{
+		{FillLast, []float64{1, 1, 1, 4}},
+		{FillZero, []float64{1, 0, 0, 4}},
+		{FillMean, []float64{1, 2.5, 2.5, 4}},
+	}
+	for _, tt := range tests {
+		got := forwardFillStockData(data, "2019-01-04", "2019-01-07", tt.strategy, false)
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: len = %d, want %d", tt.strategy, len(got), len(tt.want))
+		}
+		for i, w := range tt.want {
+			if got[i].AdjClose != w {
+				t.Errorf("%s: %s: AdjClose = %v, want %v", tt.strategy, got[i].Date, got[i].AdjClose, w)
+			}
+		}
+		if got[2].FillStreak != 2 {
+			t.Errorf("%s: FillStreak = %d, want 2", tt.strategy, got[2].FillStreak)
+		}
+	}
+	// Without data after the gap, the mean falls back to the last value.
+	if got := forwardFillStockData(data, "2019-01-07", "2019-01-08", FillMean, false); len(got) != 2 || got[1].AdjClose != 4 {
+		t.Errorf("trailing gap: got %+v, want AdjClose 4 on 2019-01-08", got)
+	}
+}
+
+func TestHandlerGroupByQuarter(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101, 102, 103, 104))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 13, 14, 15, 16))
+
+	for _, tc := range []struct {
+		groupBy  string
+		wantCode int
+	}{
+		{"quarter", http.StatusOK},
+		{"decade", http.StatusBadRequest},
+	} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://example.com/QUARTZ9?group_by="+tc.groupBy, nil)
+		req = mux.SetURLVars(req, map[string]string{"symbol": "QUARTZ9"})
+		app.Handler(rr, req)
+		if rr.Code != tc.wantCode {
+			t.Fatalf("group_by=%s: Code = %d, want %d", tc.groupBy, rr.Code, tc.wantCode)
+		}
+		if tc.wantCode != http.StatusOK {
+			continue
+		}
+		var got []QuarterlyReturn
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatalf("json.Unmarshal: %v", err)
+		}
+		if len(got) != 1 || got[0].Quarter != "2019-Q1" || !got[0].Partial {
+			t.Errorf("group_by=quarter = %+v, want one partial 2019-Q1 entry", got)
+		}
+	}
+}
+
+func TestHandlerParquet(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101, 102, 103, 104))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 13, 14, 15, 16))
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://example.com/QUARTZ9?format=parquet", nil)
+	req = mux.SetURLVars(req, map[string]string{"symbol": "QUARTZ9"})
+	app.Handler(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if got, want := rr.Header().Get("Content-Disposition"), "attachment; filename=QUARTZ9_2019-01-02.parquet"; got != want {
+		t.Errorf("Content-Disposition = %q, want %q", got, want)
+	}
+	body := rr.Body.Bytes()
+	rows, err := parquet.Read[indexRow](bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("parquet.Read: %v", err)
+	}
+	if len(rows) != 7 {
+		t.Errorf("len(rows) = %d, want 7", len(rows))
+	}
+	if rows[0].Date != "2019-01-02" || rows[0].AdjClose != 100 {
+		t.Errorf("rows[0] = %+v, want {2019-01-02 100}", rows[0])
+	}
+}
+
+func TestHandlerCSV(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", false, 100, 200, 50))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 20, 5))
+
+	get := func(target, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, req)
+		return rr
+	}
+	for _, tc := range []struct{ target, accept string }{
+		{"/QUARTZ5?format=csv", ""},
+		{"/QUARTZ5", "text/csv"},
+		{"/QUARTZ5", "text/csv;q=0.9, application/json;q=0.8"},
+	} {
+		rr := get(tc.target, tc.accept)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s Accept %q: Code = %d, want %d: %s", tc.target, tc.accept, rr.Code, http.StatusOK, rr.Body)
+		}
+		if got := rr.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/csv") {
+			t.Errorf("%s Accept %q: Content-Type = %q, want text/csv", tc.target, tc.accept, got)
+		}
+		if got, want := rr.Header().Get("Content-Disposition"), `attachment; filename="QUARTZ5-2019.csv"`; got != want {
+			t.Errorf("Content-Disposition = %q, want %q", got, want)
+		}
+		records, err := csv.NewReader(rr.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("csv.ReadAll: %v", err)
+		}
+		want := [][]string{{"date", "adj_close"}, {"2019-01-02", "100"}, {"2019-01-03", "200"}, {"2019-01-04", "50"}}
+		if !reflect.DeepEqual(records, want) {
+			t.Errorf("records = %v, want %v", records, want)
+		}
+	}
+
+	if rr := get("/QUARTZ5", "application/json, text/csv"); rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Accept preferring JSON: Content-Type = %q, want application/json", rr.Header().Get("Content-Type"))
+	}
+	for _, target := range []string{"/QUARTZ5?format=csv&group_by=year", "/QUARTZ5?format=csv&include_raw_data=true"} {
+		if rr := get(target, ""); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: Code = %d, want %d", target, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestHandlerMsgpack(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101, 102, 103, 104))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 13, 14, 15, 16))
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: Code = %d, want %d", target, rr.Code, http.StatusOK)
+		}
+		return rr
+	}
+	jsonResp, msgpackResp := get("/QUARTZ9"), get("/QUARTZ9?format=msgpack")
+	if got := msgpackResp.Header().Get("Content-Type"); got != "application/x-msgpack" {
+		t.Errorf("Content-Type = %q, want application/x-msgpack", got)
+	}
+
+	var fromJSON, fromMsgpack []IndexData
+	if err := json.Unmarshal(jsonResp.Body.Bytes(), &fromJSON); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	dec := msgpack.NewDecoder(msgpackResp.Body)
+	dec.SetCustomStructTag("json")
+	if err := dec.Decode(&fromMsgpack); err != nil {
+		t.Fatalf("msgpack decode: %v", err)
+	}
+	if len(fromMsgpack) != len(fromJSON) {
+		t.Fatalf("len = %d, want %d", len(fromMsgpack), len(fromJSON))
+	}
+	for i := range fromJSON {
+		if fromMsgpack[i] != fromJSON[i] {
+			t.Errorf("point %d = %+v, want %+v", i, fromMsgpack[i], fromJSON[i])
+		}
+	}
+}
+
+// fakePublisher records the cache events it receives.
+type fakePublisher struct {
+	events []WrittenToCacheEvent
+}
+
+func (p *fakePublisher) PublishCacheWrite(ctx context.Context, event WrittenToCacheEvent) error {
+	p.events = append(p.events, event)
+	return nil
+}
+
+// newEODServer serves data for every EOD API request and counts the calls.
+func newEODServer(t testing.TB, data []StockData, calls *int) *httptest.Server {
+	t.Helper()
+	body, err := json.Marshal(data)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPrepareSymbolJSONDataPublishesCacheWrite(t *testing.T) {
+	var calls int
+	data := fixtureSeries("2019-01-02", true, 100, 101)
+	app := newTestApp(t)
+	app.eodBaseURL = newEODServer(t, data, &calls).URL
+	publisher := &fakePublisher{}
+	app.cachePublisher = publisher
+
+	for i := 0; i < 2; i++ {
+		if _, err := app.PrepareSymbolJSONData(context.Background(), "VOO.US", fundInceptionDate, ""); err != nil {
+			t.Fatalf("PrepareSymbolJSONData: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("EOD API calls = %d, want 1", calls)
+	}
+	if len(publisher.events) != 1 {
+		t.Fatalf("published %d events, want 1", len(publisher.events))
+	}
+	body, _ := json.Marshal(data)
+	if got := publisher.events[0]; got.Ticker != "VOO.US" || got.SizeBytes != len(body) {
+		t.Errorf("event = %+v, want ticker VOO.US and %d bytes", got, len(body))
+	}
+}
+
+func TestHandlerPagination(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101, 102, 103, 104))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 13, 14, 15, 16))
+
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ9?page=3&page_size=3", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d", rr.Code, http.StatusOK)
+	}
+	var got IndexResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	want := Pagination{Page: 3, PageSize: 3, TotalPages: 3, TotalRecords: 7}
+	if got.Pagination == nil || *got.Pagination != want {
+		t.Errorf("pagination = %+v, want %+v", got.Pagination, want)
+	}
+	if len(got.Index) != 1 || got.Index[0].Date != "2019-01-08" {
+		t.Errorf("index = %+v, want the single 2019-01-08 point", got.Index)
+	}
+}
+
+func TestHandlerIncludeRawData(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101, 102, 103, 104))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 13, 14, 15, 16))
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://example.com/QUARTZ9?include_raw_data=true", nil)
+	app.newRouter().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got IndexResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(got.Index) != 7 {
+		t.Errorf("len(index) = %d, want 7", len(got.Index))
+	}
+	// VOO has no weekend prices; the raw series is not forward filled.
+	if n := len(got.Components["VOO.US"]); n != 5 {
+		t.Errorf("len(components[VOO.US]) = %d, want 5", n)
+	}
+	if n := len(got.Components["BTC-USD.CC"]); n != 7 {
+		t.Errorf("len(components[BTC-USD.CC]) = %d, want 7", n)
+	}
+
+	app.maxRawDataSeries = 1
+	rr = httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "http://example.com/QUARTZ9?include_raw_data=true", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("over the series cap: Code = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestValidateDateParam(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{"2021-01-31", "2021-01-31", ""},
+		{"20210131", "2021-01-31", ""},
+		{"2020-02-29", "2020-02-29", ""},
+		{"20210132", "", "invalid 'from' date '20210132': month 01 does not have 32 days"},
+		{"2021-02-29", "", "invalid 'from' date '2021-02-29': month 02 does not have 29 days"},
+		{"2021-13-01", "", "invalid 'from' date '2021-13-01': month 13 is not between 01 and 12"},
+		{"yesterday", "", "invalid 'from' date 'yesterday': expected YYYY-MM-DD"},
+		{"", "", "missing 'from' date, expected YYYY-MM-DD"},
+	}
+	for _, tc := range tests {
+		got, err := validateDateParam("from", tc.value)
+		if tc.wantErr != "" {
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("validateDateParam(%q) error = %v, want %q", tc.value, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || got.Format(time.DateOnly) != tc.want {
+			t.Errorf("validateDateParam(%q) = %v, %v, want %s", tc.value, got, err, tc.want)
+		}
 	}
+}
+
+func TestHandlerIncludeDateGaps(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101, 102, 103, 104))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 13, 14, 15, 16))
 
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "http://example.com/QUARTZ9?include_date_gaps=true", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got IndexResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	// VOO has no prices on the weekend of 2019-01-05.
+	if len(got.FilledDates) != 2 || got.FilledDates[0] != "2019-01-05" || got.FilledDates[1] != "2019-01-06" {
+		t.Errorf("filled_dates = %v, want [2019-01-05 2019-01-06]", got.FilledDates)
+	}
+	if len(got.Index) != 7 {
+		t.Errorf("len(index) = %d, want 7", len(got.Index))
+	}
+}
+
+func TestRestrictToTradedDates(t *testing.T) {
+	// 2019-01-04 is a Friday. BTC has no data on Tuesday 2019-01-08.
+	voo := fixtureSeries("2019-01-04", true, 100, 110, 120, 130)
+	btc := []StockData{
+		{Date: "2019-01-04", AdjClose: 10},
+		{Date: "2019-01-05", AdjClose: 11},
+		{Date: "2019-01-06", AdjClose: 12},
+		{Date: "2019-01-07", AdjClose: 13},
+		{Date: "2019-01-09", AdjClose: 15},
+	}
+	series, err := blendIndex([][]StockData{voo, btc}, []float64{0, 1}, "2019-01-01", FillLast, false, nil)
+	if err != nil {
+		t.Fatalf("blendIndex: %v", err)
+	}
+	got := restrictToTradedDates(series, btc)
+	if len(got) != len(btc) {
+		t.Fatalf("restricted series = %+v, want one point per BTC date", got)
+	}
+	for i, point := range got {
+		if point.Date != btc[i].Date || !almostEqual(point.AdjClose, btc[i].AdjClose*10) {
+			t.Errorf("point %d = %+v, want BTC %+v unchanged", i, point, btc[i])
+		}
+	}
+
+	// VOO keeps Friday's close over the weekend.
+	series, err = blendIndex([][]StockData{voo, btc}, []float64{1, 0}, "2019-01-01", FillLast, false, nil)
+	if err != nil {
+		t.Fatalf("blendIndex: %v", err)
+	}
+	got = restrictToTradedDates(series, btc)
+	for _, point := range got[:3] {
+		if point.AdjClose != 100 {
+			t.Errorf("VOO on %s = %v, want Friday's 100", point.Date, point.AdjClose)
+		}
+	}
+}
+
+func TestHandlerInvalidCalendar(t *testing.T) {
+	app := newTestApp(t)
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://example.com/QUARTZ9?calendar=lunar", nil)
+	req = mux.SetURLVars(req, map[string]string{"symbol": "QUARTZ9"})
 	app.Handler(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Code = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandlerInvalidFillStrategy(t *testing.T) {
+	app := newTestApp(t)
+	for _, query := range []string{"fill_strategy=linear", "fill_strategy=zero&rebalance=monthly"} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://example.com/QUARTZ9?"+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"symbol": "QUARTZ9"})
+		app.Handler(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: Code = %d, want %d", query, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestHandlerInvalidFrequency(t *testing.T) {
+	app := newTestApp(t)
+	for _, query := range []string{"frequency=hourly", "frequency=weekly_last&group_by=year"} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://example.com/QUARTZ9?"+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"symbol": "QUARTZ9"})
+		app.Handler(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: Code = %d, want %d", query, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestHandlerOffsetDays(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101, 102, 103, 104))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 13, 14, 15, 16))
+
+	get := func(query string) string {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://example.com/QUARTZ9"+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"symbol": "QUARTZ9"})
+		app.Handler(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: Code = %d, want %d: %s", query, rr.Code, http.StatusOK, rr.Body.String())
+		}
+		return rr.Body.String()
+	}
+
+	if got, want := get("?offset_days=0"), get(""); got != want {
+		t.Errorf("offset_days=0 = %s, want the unshifted %s", got, want)
+	}
+
+	// BTC shifted by two days starts on 2019-01-04 and VOO ends on
+	// 2019-01-08, so the series covers the five days in between.
+	var got []IndexData
+	if err := json.Unmarshal([]byte(get("?offset_days=2")), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(got) != 5 || got[0].Date != "2019-01-04" || got[4].Date != "2019-01-08" {
+		t.Errorf("offset_days=2 = %+v, want 2019-01-04 to 2019-01-08", got)
+	}
+}
+
+func TestHandlerDateRange(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", false, 100, 101, 102, 103, 104, 105, 106))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 13, 14, 15, 16))
+
+	get := func(query string) (int, []IndexData) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://example.com/QUARTZ9"+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"symbol": "QUARTZ9"})
+		app.Handler(rr, req)
+		var series []IndexData
+		if rr.Code == http.StatusOK {
+			if err := json.Unmarshal(rr.Body.Bytes(), &series); err != nil {
+				t.Fatalf("json.Unmarshal: %v", err)
+			}
+		}
+		return rr.Code, series
+	}
+
+	_, all := get("")
+	code, got := get("?from=2019-01-04&to=2019-01-06")
+	if code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d", code, http.StatusOK)
+	}
+	if len(got) != 3 || got[0].Date != "2019-01-04" || got[2].Date != "2019-01-06" {
+		t.Fatalf("got %+v, want 2019-01-04 to 2019-01-06", got)
+	}
+	// The window keeps the values of the full index.
+	if got[0].AdjClose != all[2].AdjClose {
+		t.Errorf("AdjClose on 2019-01-04 = %v, want %v", got[0].AdjClose, all[2].AdjClose)
+	}
+
+	for _, query := range []string{"?from=2019-01-06&to=2019-01-04", "?to=2019-13-01"} {
+		if code, _ := get(query); code != http.StatusBadRequest {
+			t.Errorf("%s: Code = %d, want %d", query, code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestTruncateStockData(t *testing.T) {
+	data := fixtureSeries("2019-01-02", false, 1, 2, 3)
+	if got := truncateStockData(data, "2019-01-03"); len(got) != 2 || got[1].Date != "2019-01-03" {
+		t.Errorf("truncateStockData = %+v, want 2019-01-02 to 2019-01-03", got)
+	}
+	if got := truncateStockData(data, ""); len(got) != 3 {
+		t.Errorf("empty endDate: len = %d, want 3", len(got))
+	}
+}
+
+func TestShiftStockData(t *testing.T) {
+	data := fixtureSeries("2019-01-30", false, 1, 2)
+	got := shiftStockData(data, 3)
+	if got[0].Date != "2019-02-02" || got[1].Date != "2019-02-03" || got[1].AdjClose != 2 {
+		t.Errorf("shifted = %+v", got)
+	}
+	if back := shiftStockData(got, -3); back[0] != data[0] || back[1] != data[1] {
+		t.Errorf("shifted back = %+v, want %+v", back, data)
+	}
+	if data[0].Date != "2019-01-30" {
+		t.Error("shiftStockData modified its input")
+	}
+}
+
+func TestClampDailyReturn(t *testing.T) {
+	tests := []struct {
+		prev, curr, want float64
+	}{
+		{100, 110, 0.1},
+		{100, 140, 0.2},
+		{100, 60, -0.2},
+		{100, 120, 0.2},
+		{100, 80, -0.2},
+		{0, 50, 0},
+	}
+	for _, tc := range tests {
+		if got := clampDailyReturn(tc.prev, tc.curr, 0.2); !almostEqual(got, tc.want) {
+			t.Errorf("clampDailyReturn(%v, %v, 0.2) = %v, want %v", tc.prev, tc.curr, got, tc.want)
+		}
+	}
+
+	// A 40% fall and a 40% rise are capped alike, and the later days move
+	// by their own returns from the capped level.
+	data := fixtureSeries("2019-01-02", false, 100, 60, 66, 92.4)
+	got := clampStockData(data, 0.2)
+	want := []float64{100, 80, 88, 105.6}
+	for i, w := range want {
+		if !almostEqual(got[i].AdjClose, w) {
+			t.Errorf("%s: AdjClose = %v, want %v", got[i].Date, got[i].AdjClose, w)
+		}
+	}
+	if data[1].AdjClose != 60 {
+		t.Error("clampStockData modified its input")
+	}
+}
+
+func TestHandlerClampReturns(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", false, 100, 100, 100))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 5, 10))
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ5?"+query, nil))
+		return rr
+	}
+	rr := get("clamp_returns=0.2")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got []IndexData
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	// BTC falls 20% instead of 50%, then rises 20% instead of 100%.
+	want := []float64{100, (50 + 0.5*8) / 55 * 100, (50 + 0.5*9.6) / 55 * 100}
+	for i, w := range want {
+		if !almostEqual(got[i].AdjClose, w) {
+			t.Errorf("%s: AdjClose = %v, want %v", got[i].Date, got[i].AdjClose, w)
+		}
+	}
+
+	for _, query := range []string{"clamp_returns=0", "clamp_returns=-0.2", "clamp_returns=1.5", "clamp_returns=big"} {
+		if rr := get(query); rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: Code = %d, want %d", query, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestRebaseAt(t *testing.T) {
+	series := indexSeries("2021-01-01", 100, 120, 150, 90)
+	got, err := rebaseAt(series, "2021-01-03")
+	if err != nil {
+		t.Fatalf("rebaseAt: %v", err)
+	}
+	if got[2].AdjClose != 100 {
+		t.Errorf("value at base date = %v, want exactly 100", got[2].AdjClose)
+	}
+	if !almostEqual(got[0].AdjClose, 100.0/150*100) || !almostEqual(got[3].AdjClose, 60) {
+		t.Errorf("rebased series = %+v", got)
+	}
+	if series[2].AdjClose != 150 {
+		t.Error("rebaseAt modified its input")
+	}
+	for _, date := range []string{"2020-12-31", "2021-01-05"} {
+		if _, err := rebaseAt(series, date); err == nil {
+			t.Errorf("rebaseAt(%s) outside the series succeeded, want error", date)
+		}
+	}
+}
+
+func TestHandlerBaseDate(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101, 102, 103, 104))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 13, 14, 15, 16))
+
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ9?base_date=2019-01-05", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got []IndexData
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(got) != 7 || got[3].Date != "2019-01-05" || got[3].AdjClose != 100 {
+		t.Errorf("index = %+v, want 7 points equal to 100 on 2019-01-05", got)
+	}
+	if got[0].AdjClose >= 100 {
+		t.Errorf("index[0] = %v, want below 100", got[0].AdjClose)
+	}
+
+	for _, target := range []string{"/QUARTZ9?base_date=2018-12-31", "/QUARTZ9?base_date=2019-02-30"} {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: Code = %d, want %d", target, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestFetchSymbolsConcurrentlyPartialResults(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "BTC-USD.CC") {
+			http.Error(w, "upstream failure", http.StatusInternalServerError)
+			return
+		}
+		body, _ := json.Marshal(fixtureSeries("2019-01-02", true, 100, 101, 102))
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	app := newTestApp(t)
+	app.eodBaseURL = srv.URL
+
+	data, tickerErrors := app.FetchSymbolsConcurrently(context.Background(), fundComponents, fundInceptionDate, "")
+	if len(data["VOO.US"]) != 3 {
+		t.Errorf("len(data[VOO.US]) = %d, want 3", len(data["VOO.US"]))
+	}
+	if _, ok := data["BTC-USD.CC"]; ok {
+		t.Error("data contains the failed ticker")
+	}
+	if len(tickerErrors) != 1 || tickerErrors[0].Ticker != "BTC-USD.CC" || tickerErrors[0].Message == "" {
+		t.Fatalf("errors = %+v, want one error for BTC-USD.CC", tickerErrors)
+	}
+
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ9?include_raw_data=true", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got IndexResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(got.Errors) != 1 || got.Errors[0].Ticker != "BTC-USD.CC" {
+		t.Errorf("errors = %+v, want one error for BTC-USD.CC", got.Errors)
+	}
+	if len(got.Index) != 0 || len(got.Components["VOO.US"]) != 3 {
+		t.Errorf("index = %d points, VOO.US = %d points; want 0 and 3", len(got.Index), len(got.Components["VOO.US"]))
+	}
+}
+
+func TestIndexErrorsDoNotLeakAPIKey(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	app := newTestApp(t)
+	app.eodBaseURL = srv.URL
+	app.EODAPIKEY = "secret-api-key"
+
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ9?include_raw_data=true", nil))
+	if strings.Contains(rr.Body.String(), app.EODAPIKEY) {
+		t.Errorf("response contains the API key: %s", rr.Body)
+	}
+	var got IndexResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(got.Errors) == 0 {
+		t.Fatalf("errors = none, want the unreachable components: %s", rr.Body)
+	}
+	for _, e := range got.Errors {
+		if e.Message != errUpstreamUnavailable.Error() {
+			t.Errorf("error for %s = %q, want %q", e.Ticker, e.Message, errUpstreamUnavailable)
+		}
+	}
+
+	_, err := readDataFromURL(context.Background(), srv.URL+"/eod/VOO.US?fmt=json&api_token="+app.EODAPIKEY, app.retryPolicy)
+	if err == nil || strings.Contains(err.Error(), app.EODAPIKEY) {
+		t.Errorf("readDataFromURL error = %v, want an error without the API key", err)
+	}
+}
+
+func TestPrepareSymbolJSONDataCancelled(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		body, _ := json.Marshal(fixtureSeries("2019-01-02", true, 100, 101, 102))
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	app := newTestApp(t)
+	app.eodBaseURL = srv.URL
+
+	// The caller stops waiting when its request is cancelled, while the
+	// shared fetch completes and caches the data.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := app.PrepareSymbolJSONData(ctx, "VOO.US", fundInceptionDate, "")
+		done <- err
+	}()
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("PrepareSymbolJSONData = %v, want %v", err, context.Canceled)
+	}
+	close(release)
+	// A later caller joins the fetch still in flight, or reads its result.
+	if _, err := app.PrepareSymbolJSONData(context.Background(), "VOO.US", fundInceptionDate, ""); err != nil {
+		t.Fatalf("PrepareSymbolJSONData: %v", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("EOD API calls = %d, want 1", got)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := app.PrepareSplitData(ctx, "VOO.US"); !errors.Is(err, context.Canceled) {
+		t.Errorf("PrepareSplitData = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestPrepareSymbolJSONDataSingleFetch(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		body, _ := json.Marshal(fixtureSeries("2019-01-02", true, 100, 101, 102))
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	app := newTestApp(t)
+	app.eodBaseURL = srv.URL
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := app.PrepareSymbolJSONData(context.Background(), "VOO.US", fundInceptionDate, "")
+			if err == nil && len(data) != 3 {
+				err = fmt.Errorf("len(data) = %d, want 3", len(data))
+			}
+			errs <- err
+		}()
+	}
+	// Give every goroutine the time to join the ongoing fetch.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("EOD calls = %d, want 1", got)
+	}
+}
+
+// benchmarkSeries returns n daily points starting at the fund inception.
+func benchmarkSeries(n int, weekdaysOnly bool) []StockData {
+	closes := make([]float64, n)
+	for i := range closes {
+		closes[i] = 100 + float64(i%50)
+	}
+	return fixtureSeries(fundInceptionDate, weekdaysOnly, closes...)
+}
+
+func BenchmarkIndexComputation(b *testing.B) {
+	voo := benchmarkSeries(2000, true)
+	btc := benchmarkSeries(2000, false)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := blendIndex([][]StockData{voo, btc}, []float64{9, 1}, fundInceptionDate, FillLast, false, nil); err != nil {
+			b.Fatalf("blendIndex: %v", err)
+		}
+	}
+}
+
+// BenchmarkForwardFill reports the allocations of a fill, which should be
+// about one per day for the date string, plus the map and the growth of the
+// result slice.
+func BenchmarkForwardFill(b *testing.B) {
+	// Five years of weekday prices filled onto every calendar day.
+	data := benchmarkSeries(5*252, true)
+	end := data[len(data)-1].Date
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		forwardFillStockData(data, fundInceptionDate, end, FillLast, false)
+	}
+}
+
+func TestHandlerThresholdAlert(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 100, 100, 100, 100))
+	// BTC triples on 2019-01-04, moving QUARTZ5 by well over 5%.
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 10, 30, 30, 30, 30, 30))
+
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ5?threshold_alert=5", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got IndexResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(got.AlertDates) != 1 || got.AlertDates[0] != "2019-01-04" || !got.Index[2].Alert {
+		t.Errorf("alert_dates = %v, index[2] = %+v; want an alert on 2019-01-04", got.AlertDates, got.Index[2])
+	}
+
+	for _, target := range []string{"/QUARTZ5?threshold_alert=0", "/QUARTZ5?threshold_alert=x", "/QUARTZ5?threshold_alert=5&group_by=quarter"} {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: Code = %d, want %d", target, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestFillConfidence(t *testing.T) {
+	// Friday's price is carried over a long weekend, then Wednesday is real.
+	data := []StockData{
+		{Date: "2019-01-04", AdjClose: 1},
+		{Date: "2019-01-09", AdjClose: 2},
+	}
+	filled := forwardFillStockData(data, "2019-01-04", "2019-01-09", FillLast, false)
+	want := []float64{1, 0.9, 0.8, 0.7, 0.6, 1}
+	if len(filled) != len(want) {
+		t.Fatalf("len = %d, want %d", len(filled), len(want))
+	}
+	for i, w := range want {
+		if got := fillConfidence(filled[i].FillStreak); !almostEqual(got, w) {
+			t.Errorf("%s: confidence = %v, want %v", filled[i].Date, got, w)
+		}
+	}
+	if got := fillConfidence(30); got != 0.1 {
+		t.Errorf("fillConfidence(30) = %v, want floor of 0.1", got)
+	}
+}
+
+func TestHandlerFillConfidence(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101, 102, 103, 104))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 13, 14, 15, 16))
+
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ9?fill_confidence=true", nil))
 	if rr.Code != http.StatusOK {
-		t.Errorf("Code = %d, want %d", rr.Code, http.StatusOK)
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got []IndexData
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	// 2019-01-05 and 2019-01-06 are a weekend without VOO prices.
+	want := []float64{1, 1, 1, 0.9, 0.8, 1, 1}
+	for i, w := range want {
+		if !almostEqual(got[i].Confidence, w) {
+			t.Errorf("%s: confidence = %v, want %v", got[i].Date, got[i].Confidence, w)
+		}
+	}
+}
+
+func TestHandlerTaxJurisdiction(t *testing.T) {
+	app := newTestApp(t)
+	voo, btc := trendingComponents(120)
+	writeFixture(t, app, "VOO.US", voo)
+	writeFixture(t, app, "BTC-USD.CC", btc)
+
+	serve := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "http://example.com/QUARTZ5"+query, nil)
+		req = mux.SetURLVars(req, map[string]string{"symbol": "QUARTZ5"})
+		app.Handler(rr, req)
+		return rr
+	}
+	if rr := serve("?tax_jurisdiction=US"); rr.Code != http.StatusBadRequest {
+		t.Errorf("tax_jurisdiction without rebalance = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+	if rr := serve("?rebalance=monthly&tax_jurisdiction=XX"); rr.Code != http.StatusBadRequest {
+		t.Errorf("unknown tax_jurisdiction = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+
+	rr := serve("?rebalance=monthly&tax_jurisdiction=US")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got IndexResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if got.Summary == nil || got.Summary.AfterTaxReturnPct >= got.Summary.ReturnPct {
+		t.Errorf("summary = %+v, want an after-tax return below the untaxed return", got.Summary)
+	}
+}
+
+func TestHandlerJSONErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upstream failure", http.StatusBadGateway)
+	}))
+	t.Cleanup(srv.Close)
+	app := newTestApp(t)
+	app.eodBaseURL = srv.URL
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11))
+
+	tests := []struct {
+		query string
+		want  ErrorResponse
+	}{
+		{"/QUARTZ9?format=xml", ErrorResponse{Error: "Invalid format, supported values: json, parquet, msgpack, csv", Code: http.StatusBadRequest}},
+		// The split data cannot be fetched.
+		{"/QUARTZ9?split_only=true", ErrorResponse{Error: "upstream data unavailable", Code: http.StatusServiceUnavailable}},
+	}
+	for _, tc := range tests {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", tc.query, nil))
+		if rr.Code != tc.want.Code {
+			t.Errorf("%s: Code = %d, want %d", tc.query, rr.Code, tc.want.Code)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: Content-Type = %q, want application/json", tc.query, ct)
+		}
+		var got ErrorResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: json.Unmarshal(%s): %v", tc.query, rr.Body, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: body = %+v, want %+v", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestPrepareSymbolJSONDataReadError(t *testing.T) {
+	app := newTestApp(t)
+	// A directory in place of the cache file cannot be read.
+	path := filepath.Join(app.bucketCacheDirectory, "VOO.US", time.Now().UTC().Format(time.DateOnly)+".json")
+	if err := os.MkdirAll(path, os.ModePerm); err != nil {
+		t.Fatalf("os.MkdirAll: %v", err)
 	}
-	wantBody := "Hello World!\n"
-	if got := rr.Body.String(); got != wantBody {
-		t.Errorf("Body = %q, want %q", got, wantBody)
+	if _, err := app.PrepareSymbolJSONData(context.Background(), "VOO.US", fundInceptionDate, ""); err == nil {
+		t.Error("PrepareSymbolJSONData succeeded, want a read error")
 	}
 }
@@ -0,0 +1,144 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ProbeStatus is the body of the /health and /ready probes.
+type ProbeStatus struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// writeProbeStatus writes status as JSON with code.
+func writeProbeStatus(w http.ResponseWriter, status ProbeStatus, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
+
+// defaultHealthPort is the port of the load balancer health check unless
+// HEALTH_PORT is set.
+const defaultHealthPort = "8081"
+
+// loadBalancerHealthCheck answers load balancer probes with 200 OK without
+// touching any application state.
+func loadBalancerHealthCheck(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("OK"))
+}
+
+// newLoadBalancerHealthServer returns a server on port that only serves
+// GET / with loadBalancerHealthCheck.
+func newLoadBalancerHealthServer(port string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", loadBalancerHealthCheck)
+	return &http.Server{
+		Addr:              ":" + port,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+}
+
+// HealthHandler is the liveness probe. It succeeds as long as the process
+// serves requests.
+func (a *App) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	writeProbeStatus(w, ProbeStatus{Status: "ok"}, http.StatusOK)
+}
+
+// ReadyHandler is the readiness probe. It returns 503 when the cache
+// directory, e.g. the GCS volume mount, cannot be accessed or when logging
+// has not been set up. The directory is not checked with a bucket cache.
+func (a *App) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	_, fileCache := a.cache().(FileCacheBackend)
+	if _, err := os.Stat(a.bucketCacheDirectory); fileCache && err != nil {
+		writeProbeStatus(w, ProbeStatus{Status: "unavailable", Reason: "cache directory is not accessible"}, http.StatusServiceUnavailable)
+		return
+	}
+	if a.log == nil {
+		writeProbeStatus(w, ProbeStatus{Status: "unavailable", Reason: "logger is not initialized"}, http.StatusServiceUnavailable)
+		return
+	}
+	writeProbeStatus(w, ProbeStatus{Status: "ok"}, http.StatusOK)
+}
+
+// CacheStats describes the contents of the cache directory.
+type CacheStats struct {
+	TotalFiles     int            `json:"total_files"`
+	TotalSizeBytes int64          `json:"total_size_bytes"`
+	OldestFileDate string         `json:"oldest_file_date,omitempty"`
+	NewestFileDate string         `json:"newest_file_date,omitempty"`
+	Tickers        map[string]int `json:"tickers"`
+}
+
+// CacheHealthHandler reports statistics about the cache directory. It
+// returns 503 when the directory cannot be read, and 501 with a bucket cache.
+func (a *App) CacheHealthHandler(w http.ResponseWriter, r *http.Request) {
+	backend, ok := a.cache().(FileCacheBackend)
+	if !ok {
+		http.Error(w, "Cache statistics are only available for a cache directory", http.StatusNotImplemented)
+		return
+	}
+	stats, err := cacheStats(backend.Dir)
+	if err != nil {
+		http.Error(w, "Cache directory is unreadable", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// cacheStats walks the cache directory. Only data files named
+// {YYYY-MM-DD}.json are counted; checksum files are ignored. Tickers counts
+// the daily price files of each {symbol} directory.
+func cacheStats(dir string) (CacheStats, error) {
+	stats := CacheStats{Tickers: map[string]int{}}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		date, ok := strings.CutSuffix(d.Name(), ".json")
+		if d.IsDir() || !ok {
+			return nil
+		}
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		stats.TotalFiles++
+		stats.TotalSizeBytes += info.Size()
+		if stats.OldestFileDate == "" || minDateStr(date, stats.OldestFileDate) == date {
+			stats.OldestFileDate = date
+		}
+		stats.NewestFileDate = maxDateStr(date, stats.NewestFileDate)
+		if rel, err := filepath.Rel(dir, path); err == nil {
+			if ticker, _, ok := strings.Cut(rel, string(filepath.Separator)); ok && filepath.Dir(rel) == ticker {
+				stats.Tickers[ticker]++
+			}
+		}
+		return nil
+	})
+	return stats, err
+}
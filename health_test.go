@@ -0,0 +1,116 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCacheHealthHandler(t *testing.T) {
+	app := newTestApp(t)
+	for _, file := range []struct{ dir, name, data string }{
+		{"VOO.US", "2024-01-10.json", "[]"},
+		{"VOO.US", "2024-01-15.json", "[{}]"},
+		{"BTC-USD.CC", "2024-01-12.json", "[]"},
+		{filepath.Join("splits", "VOO.US"), "2024-01-15.json", "[]"},
+	} {
+		if err := writeWithChecksum(filepath.Join(app.bucketCacheDirectory, file.dir), file.name, []byte(file.data)); err != nil {
+			t.Fatalf("writeWithChecksum: %v", err)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/healthz/cache", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d", rr.Code, http.StatusOK)
+	}
+	var got CacheStats
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	want := CacheStats{
+		TotalFiles:     4,
+		TotalSizeBytes: 10,
+		OldestFileDate: "2024-01-10",
+		NewestFileDate: "2024-01-15",
+		Tickers:        map[string]int{"VOO.US": 2, "BTC-USD.CC": 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+
+	app.bucketCacheDirectory = filepath.Join(app.bucketCacheDirectory, "missing")
+	rr = httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/healthz/cache", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("missing directory: Code = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestHealthAndReadyHandlers(t *testing.T) {
+	app := newTestApp(t)
+	get := func(path string) (int, ProbeStatus) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		var status ProbeStatus
+		if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+			t.Fatalf("%s: json.Unmarshal: %v", path, err)
+		}
+		return rr.Code, status
+	}
+
+	for _, path := range []string{"/health", "/ready"} {
+		if code, status := get(path); code != http.StatusOK || status.Status != "ok" {
+			t.Errorf("%s = %d %+v, want 200 ok", path, code, status)
+		}
+	}
+
+	// A missing volume mount only fails readiness.
+	app.bucketCacheDirectory = filepath.Join(app.bucketCacheDirectory, "missing")
+	if code, _ := get("/health"); code != http.StatusOK {
+		t.Errorf("/health without cache directory: Code = %d, want %d", code, http.StatusOK)
+	}
+	if code, _ := get("/ready"); code != http.StatusServiceUnavailable {
+		t.Errorf("/ready without cache directory: Code = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestLoadBalancerHealthServer(t *testing.T) {
+	handler := newLoadBalancerHealthServer(defaultHealthPort).Handler
+	tests := []struct {
+		method, target string
+		want           int
+	}{
+		{"GET", "/", http.StatusOK},
+		{"GET", "/QUARTZ9", http.StatusNotFound},
+		{"POST", "/", http.StatusMethodNotAllowed},
+	}
+	for _, tc := range tests {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(tc.method, tc.target, nil))
+		if rr.Code != tc.want {
+			t.Errorf("%s %s: Code = %d, want %d", tc.method, tc.target, rr.Code, tc.want)
+		}
+		if tc.want == http.StatusOK && rr.Body.String() != "OK" {
+			t.Errorf("%s %s: body = %q, want OK", tc.method, tc.target, rr.Body)
+		}
+	}
+}
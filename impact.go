@@ -0,0 +1,132 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// ImpactResponse compares the fund with a variant where one component has a
+// different weight.
+type ImpactResponse struct {
+	Component             string      `json:"component"`
+	OriginalWeight        float64     `json:"original_weight"`
+	NewWeight             float64     `json:"new_weight"`
+	OriginalReturnPct     float64     `json:"original_return_pct"`
+	HypotheticalReturnPct float64     `json:"hypothetical_return_pct"`
+	DiffPct               float64     `json:"diff_pct"`
+	Index                 []IndexData `json:"index"`
+}
+
+// resolveComponent returns the component of fund named name, either its EOD
+// ticker or the ticker without exchange and currency, e.g. BTC for
+// BTC-USD.CC.
+func resolveComponent(fund FundDefinition, name string) (string, bool) {
+	name = strings.ToUpper(name)
+	for _, symbol := range fund.Symbols() {
+		short, _, _ := strings.Cut(symbol, ".")
+		short, _, _ = strings.Cut(short, "-")
+		if name == symbol || name == short {
+			return symbol, true
+		}
+	}
+	return "", false
+}
+
+// reweightFund returns fund with the weight of symbol set to weight. The
+// other components are scaled in proportion so that the weights still sum
+// to 1.
+func reweightFund(fund FundDefinition, symbol string, weight float64) (FundDefinition, error) {
+	rest := 1 - fund.Weight(symbol)
+	if rest <= 0 && weight < 1 {
+		return FundDefinition{}, fmt.Errorf("%s is the only component of %s", symbol, fund.Name)
+	}
+	reweighted := FundDefinition{Name: fund.Name, Components: make([]ComponentWeight, len(fund.Components))}
+	for i, c := range fund.Components {
+		if c.Symbol == symbol {
+			c.Weight = weight
+		} else {
+			c.Weight *= (1 - weight) / rest
+		}
+		reweighted.Components[i] = c
+	}
+	return reweighted, nil
+}
+
+// ImpactHandler shows how the fund would have performed with another weight
+// for one component, e.g.
+// /QUARTZ9/impact?component=BTC&new_weight=0.15&from=2020-01-01.
+func (a *App) ImpactHandler(w http.ResponseWriter, r *http.Request) {
+	symbol := strings.ToUpper(mux.Vars(r)["symbol"])
+	fund, ok := lookupFund(symbol)
+	if !ok {
+		http.Error(w, "Invalid symbol", http.StatusBadRequest)
+		return
+	}
+	name := r.URL.Query().Get("component")
+	component, ok := resolveComponent(fund, name)
+	if !ok {
+		http.Error(w, fmt.Sprintf("invalid 'component' value '%s', expected one of %s", name, strings.Join(fund.Symbols(), ", ")), http.StatusBadRequest)
+		return
+	}
+	v := r.URL.Query().Get("new_weight")
+	newWeight, err := strconv.ParseFloat(v, 64)
+	if err != nil || newWeight < 0 || newWeight > 1 {
+		http.Error(w, fmt.Sprintf("invalid 'new_weight' value '%s', expected a number between 0 and 1", v), http.StatusBadRequest)
+		return
+	}
+	from, err := optionalDateParam(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hypothetical, err := reweightFund(fund, component, newWeight)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	original, err := a.computeIndexSeries(r.Context(), fund, from, indexOptions{})
+	if err != nil {
+		http.Error(w, "Error computing index series", http.StatusInternalServerError)
+		return
+	}
+	series, err := a.computeIndexSeries(r.Context(), hypothetical, from, indexOptions{})
+	if err != nil {
+		http.Error(w, "Error computing index series", http.StatusInternalServerError)
+		return
+	}
+	if series == nil {
+		series = []IndexData{}
+	}
+	response := ImpactResponse{
+		Component:             component,
+		OriginalWeight:        fund.Weight(component),
+		NewWeight:             newWeight,
+		OriginalReturnPct:     totalReturnPct(original),
+		HypotheticalReturnPct: totalReturnPct(series),
+		Index:                 series,
+	}
+	response.DiffPct = response.HypotheticalReturnPct - response.OriginalReturnPct
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
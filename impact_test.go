@@ -0,0 +1,90 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReweightFund(t *testing.T) {
+	fund, _ := lookupFund("QUARTZ712")
+	got, err := reweightFund(fund, "ETH-USD.CC", 0.6)
+	if err != nil {
+		t.Fatalf("reweightFund: %v", err)
+	}
+	// The remaining 0.4 is split 7:1 between VOO and BTC.
+	want := map[string]float64{"VOO.US": 0.35, "BTC-USD.CC": 0.05, "ETH-USD.CC": 0.6}
+	for symbol, w := range want {
+		if !almostEqual(got.Weight(symbol), w) {
+			t.Errorf("weight of %s = %v, want %v", symbol, got.Weight(symbol), w)
+		}
+	}
+	if fund.Weight("ETH-USD.CC") != 0.2 {
+		t.Error("reweightFund modified its input")
+	}
+
+	single := FundDefinition{Name: "ALLVOO", Components: []ComponentWeight{{"VOO.US", 1}}}
+	if _, err := reweightFund(single, "VOO.US", 0.5); err == nil {
+		t.Error("reweightFund(single component) succeeded, want an error")
+	}
+}
+
+func TestImpactHandler(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", false, 100, 105, 110))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 15, 20))
+
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ9/impact?component=BTC&new_weight=0.15", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got ImpactResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	// 0.9/0.1: (0.9*110 + 0.1*20) / (0.9*100 + 0.1*10) = 101/91.
+	// 0.85/0.15: (0.85*110 + 0.15*20) / (0.85*100 + 0.15*10) = 96.5/86.5.
+	original, hypothetical := (101.0/91-1)*100, (96.5/86.5-1)*100
+	if got.Component != "BTC-USD.CC" || got.OriginalWeight != 0.1 || got.NewWeight != 0.15 {
+		t.Errorf("component = %s %v -> %v", got.Component, got.OriginalWeight, got.NewWeight)
+	}
+	if !almostEqual(got.OriginalReturnPct, original) || !almostEqual(got.HypotheticalReturnPct, hypothetical) {
+		t.Errorf("returns = %v, %v, want %v, %v", got.OriginalReturnPct, got.HypotheticalReturnPct, original, hypothetical)
+	}
+	if !almostEqual(got.DiffPct, hypothetical-original) {
+		t.Errorf("DiffPct = %v, want %v", got.DiffPct, hypothetical-original)
+	}
+	if len(got.Index) != 3 || !almostEqual(got.Index[1].AdjClose, (0.85*105+0.15*15)/86.5*100) {
+		t.Errorf("Index = %+v", got.Index)
+	}
+
+	for _, target := range []string{
+		"/QUARTZ9/impact?component=ETH&new_weight=0.15",
+		"/QUARTZ9/impact?component=BTC&new_weight=1.5",
+		"/QUARTZ9/impact?component=BTC",
+		"/QUARTZ9/impact?component=BTC&new_weight=0.15&from=soon",
+		"/QUARTZ1/impact?component=BTC&new_weight=0.15",
+	} {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: Code = %d, want %d", target, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
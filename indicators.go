@@ -0,0 +1,270 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// defaultSmoothingAlpha is the EMA smoothing factor used when smooth=ema is
+// requested without smoothing_alpha.
+const defaultSmoothingAlpha = 0.1
+
+const (
+	// regimeWindow is the moving average window used by ?regime=true.
+	regimeWindow = 200
+	// regimeNeutralBand is the relative distance from the moving average
+	// within which a date is classified as neutral.
+	regimeNeutralBand = 0.02
+)
+
+const (
+	// volRegimeShortWindow and volRegimeLongWindow are the rolling windows,
+	// in daily returns, compared by ?vol_regime=true.
+	volRegimeShortWindow = 10
+	volRegimeLongWindow  = 60
+)
+
+// volatility30DWindow is the number of daily returns in ?volatility_30d.
+const volatility30DWindow = 30
+
+// zscoreMinObservations is the number of points needed before
+// ?normalize=zscore reports a z-score.
+const zscoreMinObservations = 10
+
+// parseSmoothing reads the optional smooth and smoothing_alpha query
+// parameters and returns the EMA smoothing factor, or 0 when no smoothing was
+// requested.
+func parseSmoothing(r *http.Request) (float64, error) {
+	query := r.URL.Query()
+	smooth, v := query.Get("smooth"), query.Get("smoothing_alpha")
+	switch {
+	case smooth == "" && v == "":
+		return 0, nil
+	case smooth != "ema":
+		return 0, fmt.Errorf("invalid 'smooth' value '%s', supported values: ema", smooth)
+	case v == "":
+		return defaultSmoothingAlpha, nil
+	}
+	alpha, err := strconv.ParseFloat(v, 64)
+	if err != nil || !(alpha > 0 && alpha <= 1) {
+		return 0, fmt.Errorf("invalid 'smoothing_alpha' value '%s', expected a number in (0, 1]", v)
+	}
+	return alpha, nil
+}
+
+// applyEMA returns the exponential moving average of the series, seeded with
+// its first point. alpha is the weight of the newest point, in (0, 1]; an
+// alpha of 1 returns the series unchanged.
+func applyEMA(series []IndexData, alpha float64) []IndexData {
+	smoothed := make([]IndexData, len(series))
+	for i, data := range series {
+		if i > 0 {
+			data.AdjClose = alpha*data.AdjClose + (1-alpha)*smoothed[i-1].AdjClose
+		}
+		smoothed[i] = data
+	}
+	return smoothed
+}
+
+// classifyMarketRegime labels every point as "bull" when it is more than
+// regimeNeutralBand above its simple moving average over window points, "bear"
+// when it is more than regimeNeutralBand below it, and "neutral" otherwise.
+// Points without a full window of history are neutral.
+func classifyMarketRegime(series []IndexData, window int) []IndexData {
+	classified := make([]IndexData, len(series))
+	sum := 0.0
+	for i, data := range series {
+		sum += data.AdjClose
+		if i >= window {
+			sum -= series[i-window].AdjClose
+		}
+		data.Regime = "neutral"
+		if sma := sum / float64(window); i >= window-1 && sma != 0 {
+			switch deviation := data.AdjClose/sma - 1; {
+			case deviation > regimeNeutralBand:
+				data.Regime = "bull"
+			case deviation < -regimeNeutralBand:
+				data.Regime = "bear"
+			}
+		}
+		classified[i] = data
+	}
+	return classified
+}
+
+// RegimeGap is a run of dates left out by ?regime_filter.
+type RegimeGap struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// parseRegimeFilter reads the optional regime_filter query parameter.
+func parseRegimeFilter(r *http.Request) (string, error) {
+	switch v := r.URL.Query().Get("regime_filter"); v {
+	case "", "bull", "bear", "neutral":
+		return v, nil
+	default:
+		return "", fmt.Errorf("invalid 'regime_filter' value '%s', supported values: bull, bear, neutral", v)
+	}
+}
+
+// filterRegime keeps the points of a classified series in regime and returns
+// the runs of consecutive points left out. The returned series is
+// discontinuous wherever there is a gap.
+func filterRegime(series []IndexData, regime string) ([]IndexData, []RegimeGap) {
+	filtered := []IndexData{}
+	gaps := []RegimeGap{}
+	inGap := false
+	for _, data := range series {
+		if data.Regime == regime {
+			filtered = append(filtered, data)
+			inGap = false
+			continue
+		}
+		if inGap {
+			gaps[len(gaps)-1].To = data.Date
+			continue
+		}
+		gaps = append(gaps, RegimeGap{From: data.Date, To: data.Date})
+		inGap = true
+	}
+	return filtered, gaps
+}
+
+// annotateAlerts flags the points whose absolute change from the previous
+// point is at least thresholdPct percent.
+func annotateAlerts(series []IndexData, thresholdPct float64) []IndexData {
+	annotated := make([]IndexData, len(series))
+	for i, data := range series {
+		if i > 0 && series[i-1].AdjClose != 0 {
+			move := math.Abs(data.AdjClose/series[i-1].AdjClose-1) * 100
+			// Tolerate rounding so that a move of exactly the threshold counts.
+			data.Alert = move >= thresholdPct-1e-9
+		}
+		annotated[i] = data
+	}
+	return annotated
+}
+
+// detectVolatilityRegimes labels every point by comparing the volatility of
+// the last shortWindow daily returns with that of the last longWindow daily
+// returns: "low" below 50%, "high" above 150% and "medium" in between. Points
+// without longWindow returns of history are left unlabelled.
+func detectVolatilityRegimes(series []IndexData, shortWindow, longWindow int) []IndexData {
+	labelled := make([]IndexData, len(series))
+	copy(labelled, series)
+	returns := make([]float64, len(series))
+	for i := 1; i < len(series); i++ {
+		if series[i-1].AdjClose != 0 {
+			returns[i] = series[i].AdjClose/series[i-1].AdjClose - 1
+		}
+	}
+	for i := longWindow; i < len(series); i++ {
+		longVol := stdDev(returns[i-longWindow+1 : i+1])
+		shortVol := stdDev(returns[i-shortWindow+1 : i+1])
+		switch ratio := shortVol / longVol; {
+		case longVol == 0:
+			labelled[i].VolatilityRegime = "medium"
+		case ratio < 0.5:
+			labelled[i].VolatilityRegime = "low"
+		case ratio > 1.5:
+			labelled[i].VolatilityRegime = "high"
+		default:
+			labelled[i].VolatilityRegime = "medium"
+		}
+	}
+	return labelled
+}
+
+// computeVolatility30D sets the standard deviation of the last
+// volatility30DWindow daily returns on every point, in percent, and with
+// annualise also the annualised volatility using √252 trading days. Points
+// without enough history are left unset.
+func computeVolatility30D(series []IndexData, annualise bool) []IndexData {
+	annotated := make([]IndexData, len(series))
+	copy(annotated, series)
+	returns := make([]float64, len(series))
+	for i := 1; i < len(series); i++ {
+		if series[i-1].AdjClose != 0 {
+			returns[i] = series[i].AdjClose/series[i-1].AdjClose - 1
+		}
+	}
+	for i := volatility30DWindow; i < len(series); i++ {
+		vol := stdDev(returns[i-volatility30DWindow+1:i+1]) * 100
+		annotated[i].Volatility30D = vol
+		if annualise {
+			annotated[i].AnnualisedVol30D = vol * math.Sqrt(tradingDaysPerYear)
+		}
+	}
+	return annotated
+}
+
+// computeExpandingZScore replaces each value with its z-score relative to
+// the mean and standard deviation of the series up to and including that
+// point. Points with fewer than zscoreMinObservations observations, or no
+// variation yet, are set to NaN.
+func computeExpandingZScore(series []IndexData) []IndexData {
+	normalized := make([]IndexData, len(series))
+	// Welford's algorithm keeps the running variance numerically stable.
+	m, m2 := 0.0, 0.0
+	for i, data := range series {
+		n := float64(i + 1)
+		delta := data.AdjClose - m
+		m += delta / n
+		m2 += delta * (data.AdjClose - m)
+		value := math.NaN()
+		if i+1 >= zscoreMinObservations && m2 > 0 {
+			value = (data.AdjClose - m) / math.Sqrt(m2/(n-1))
+		}
+		data.AdjClose = value
+		normalized[i] = data
+	}
+	return normalized
+}
+
+// computeDrawdown sets the decline in percent of every point from the highest
+// value of the series up to that point.
+func computeDrawdown(series []IndexData) []IndexData {
+	annotated := make([]IndexData, len(series))
+	runningMax := math.Inf(-1)
+	for i, data := range series {
+		runningMax = max(runningMax, data.AdjClose)
+		if runningMax > 0 {
+			data.DrawdownPct = (data.AdjClose - runningMax) / runningMax * 100
+		}
+		annotated[i] = data
+	}
+	return annotated
+}
+
+// computeRunup sets the gain in percent of every point from the lowest value
+// of the series up to that point. It mirrors the drawdown from the running
+// peak.
+func computeRunup(series []IndexData) []IndexData {
+	annotated := make([]IndexData, len(series))
+	runningMin := math.Inf(1)
+	for i, data := range series {
+		runningMin = min(runningMin, data.AdjClose)
+		if runningMin > 0 {
+			data.RunupPct = (data.AdjClose - runningMin) / runningMin * 100
+		}
+		annotated[i] = data
+	}
+	return annotated
+}
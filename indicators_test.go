@@ -0,0 +1,312 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestApplyEMA(t *testing.T) {
+	series := indexSeries("2021-01-01", 100, 140, 90, 160, 80, 120)
+
+	unchanged := applyEMA(series, 1)
+	for i := range series {
+		if unchanged[i] != series[i] {
+			t.Errorf("alpha=1: point %d = %+v, want %+v", i, unchanged[i], series[i])
+		}
+	}
+
+	smooth := applyEMA(series, 0.01)
+	if smooth[0].AdjClose != 100 {
+		t.Errorf("seed = %v, want 100", smooth[0].AdjClose)
+	}
+	for i := 1; i < len(smooth); i++ {
+		if step := smooth[i].AdjClose - smooth[i-1].AdjClose; step > 1 || step < -1 {
+			t.Errorf("alpha=0.01: step %d = %v, want within ±1", i, step)
+		}
+	}
+
+	half := applyEMA(series, 0.5)
+	if !almostEqual(half[1].AdjClose, 120) || !almostEqual(half[2].AdjClose, 105) {
+		t.Errorf("alpha=0.5: %v, %v, want 120, 105", half[1].AdjClose, half[2].AdjClose)
+	}
+}
+
+func TestParseSmoothing(t *testing.T) {
+	tests := []struct {
+		query string
+		alpha float64
+		ok    bool
+	}{
+		{"", 0, true},
+		{"smooth=ema", defaultSmoothingAlpha, true},
+		{"smooth=ema&smoothing_alpha=0.25", 0.25, true},
+		{"smooth=ema&smoothing_alpha=1", 1, true},
+		{"smooth=ema&smoothing_alpha=0", 0, false},
+		{"smooth=ema&smoothing_alpha=1.5", 0, false},
+		{"smooth=ema&smoothing_alpha=NaN", 0, false},
+		{"smooth=sma", 0, false},
+		{"smoothing_alpha=0.1", 0, false},
+	}
+	for _, tc := range tests {
+		alpha, err := parseSmoothing(httptest.NewRequest("GET", "/QUARTZ9?"+tc.query, nil))
+		if (err == nil) != tc.ok || alpha != tc.alpha {
+			t.Errorf("parseSmoothing(%q) = %v, %v", tc.query, alpha, err)
+		}
+	}
+}
+
+func TestClassifyMarketRegime(t *testing.T) {
+	values := make([]float64, 0, 450)
+	for i := range 250 {
+		values = append(values, 100+float64(i))
+	}
+	// A 50% drawdown after the rally.
+	for range regimeWindow {
+		values = append(values, 175)
+	}
+	got := classifyMarketRegime(indexSeries("2021-01-01", values...), regimeWindow)
+
+	if got[0].Regime != "neutral" || got[regimeWindow-2].Regime != "neutral" {
+		t.Errorf("regime before a full window = %q, %q, want neutral", got[0].Regime, got[regimeWindow-2].Regime)
+	}
+	if got[regimeWindow-1].Regime != "bull" || got[249].Regime != "bull" {
+		t.Errorf("regime of the rally = %q, %q, want bull", got[regimeWindow-1].Regime, got[249].Regime)
+	}
+	if got[250].Regime != "bear" {
+		t.Errorf("regime after the drawdown = %q, want bear", got[250].Regime)
+	}
+	if got[len(got)-1].Regime != "neutral" {
+		t.Errorf("regime after a flat window = %q, want neutral", got[len(got)-1].Regime)
+	}
+}
+
+func TestFilterRegime(t *testing.T) {
+	series := indexSeries("2022-01-03", 100, 110, 90, 80, 85, 120, 130, 125)
+	regimes := []string{"bull", "bull", "bear", "bear", "neutral", "bull", "bull", "neutral"}
+	for i := range series {
+		series[i].Regime = regimes[i]
+	}
+	got, gaps := filterRegime(series, "bull")
+
+	var dates []string
+	for _, data := range got {
+		dates = append(dates, data.Date)
+	}
+	if want := []string{"2022-01-03", "2022-01-04", "2022-01-08", "2022-01-09"}; !slices.Equal(dates, want) {
+		t.Errorf("dates = %v, want %v", dates, want)
+	}
+	wantGaps := []RegimeGap{{From: "2022-01-05", To: "2022-01-07"}, {From: "2022-01-10", To: "2022-01-10"}}
+	if !slices.Equal(gaps, wantGaps) {
+		t.Errorf("gaps = %+v, want %+v", gaps, wantGaps)
+	}
+	// The return of the filtered series spans the gaps: 100 -> 130.
+	if r := totalReturnPct(got); !almostEqual(r, 30) {
+		t.Errorf("return of the bull points = %v, want 30", r)
+	}
+
+	if got, gaps := filterRegime(series, "bear"); len(got) != 2 || len(gaps) != 2 || gaps[0].From != "2022-01-03" {
+		t.Errorf("bear points = %+v, gaps = %+v", got, gaps)
+	}
+}
+
+func TestHandlerRegimeFilter(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", false, 100, 101, 102))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12))
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ9?"+query, nil))
+		return rr
+	}
+	// Without a full window of history every point is neutral.
+	rr := get("regime_filter=bull")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got IndexResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal(%s): %v", rr.Body, err)
+	}
+	if len(got.Index) != 0 || !slices.Equal(got.Gaps, []RegimeGap{{From: "2019-01-02", To: "2019-01-04"}}) {
+		t.Errorf("response = %s, want no points and one gap", rr.Body)
+	}
+
+	for _, query := range []string{"regime_filter=sideways", "regime_filter=bull&group_by=year"} {
+		if rr := get(query); rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: Code = %d, want %d", query, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestAnnotateAlerts(t *testing.T) {
+	// Moves: +5% (exactly the threshold), +4.99%, -5%, -5.01%.
+	series := []IndexData{
+		{Date: "2021-01-01", AdjClose: 100},
+		{Date: "2021-01-02", AdjClose: 105},
+		{Date: "2021-01-03", AdjClose: 105 * 1.0499},
+		{Date: "2021-01-04", AdjClose: 105 * 1.0499 * 0.95},
+		{Date: "2021-01-05", AdjClose: 105 * 1.0499 * 0.95 * 0.9499},
+	}
+	got := annotateAlerts(series, 5)
+	want := []bool{false, true, false, true, true}
+	for i, w := range want {
+		if got[i].Alert != w {
+			t.Errorf("%s: Alert = %v, want %v", got[i].Date, got[i].Alert, w)
+		}
+	}
+	if series[1].Alert {
+		t.Error("annotateAlerts modified its input")
+	}
+}
+
+func TestDetectVolatilityRegimes(t *testing.T) {
+	// 60 days alternating ±1%, then 10 days alternating ±5%, then 60 quiet
+	// days alternating ±0.1%.
+	values := []float64{100}
+	move := func(days int, pct float64) {
+		for i := range days {
+			sign := 1.0
+			if i%2 == 1 {
+				sign = -1
+			}
+			values = append(values, values[len(values)-1]*(1+sign*pct/100))
+		}
+	}
+	move(60, 1)
+	move(10, 5)
+	move(60, 1)
+	move(10, 0.1)
+	got := detectVolatilityRegimes(indexSeries("2021-01-01", values...), volRegimeShortWindow, volRegimeLongWindow)
+
+	if got[volRegimeLongWindow-1].VolatilityRegime != "" {
+		t.Errorf("regime without a full window = %q, want none", got[volRegimeLongWindow-1].VolatilityRegime)
+	}
+	if r := got[60].VolatilityRegime; r != "medium" {
+		t.Errorf("steady regime = %q, want medium", r)
+	}
+	if r := got[70].VolatilityRegime; r != "high" {
+		t.Errorf("regime after the volatile days = %q, want high", r)
+	}
+	if r := got[len(got)-1].VolatilityRegime; r != "low" {
+		t.Errorf("regime after the quiet days = %q, want low", r)
+	}
+}
+
+func TestComputeExpandingZScore(t *testing.T) {
+	series := indexSeries("2021-01-01", 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 20)
+	got := computeExpandingZScore(series)
+	for i := range zscoreMinObservations - 1 {
+		if !math.IsNaN(got[i].AdjClose) {
+			t.Errorf("z-score %d = %v, want NaN before %d observations", i, got[i].AdjClose, zscoreMinObservations)
+		}
+	}
+	// 1..10 has mean 5.5 and sample standard deviation sqrt(55/6).
+	if want := 4.5 / math.Sqrt(55.0/6); !almostEqual(got[9].AdjClose, want) {
+		t.Errorf("z-score 9 = %v, want %v", got[9].AdjClose, want)
+	}
+	if got[10].AdjClose <= got[9].AdjClose {
+		t.Errorf("z-score after a jump = %v, want above %v", got[10].AdjClose, got[9].AdjClose)
+	}
+	if series[9].AdjClose != 10 {
+		t.Error("computeExpandingZScore modified its input")
+	}
+
+	flat := computeExpandingZScore(indexSeries("2021-01-01", 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5))
+	if !math.IsNaN(flat[10].AdjClose) {
+		t.Errorf("z-score of a flat series = %v, want NaN", flat[10].AdjClose)
+	}
+}
+
+func TestIndexDataMarshalJSONNaN(t *testing.T) {
+	got, err := json.Marshal([]IndexData{{Date: "2021-01-01", AdjClose: math.NaN(), Regime: "bull"}, {Date: "2021-01-02", AdjClose: 1.5}})
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	var points []map[string]any
+	if err := json.Unmarshal(got, &points); err != nil {
+		t.Fatalf("json.Unmarshal(%s): %v", got, err)
+	}
+	if v, ok := points[0]["adjusted_close"]; !ok || v != nil {
+		t.Errorf("NaN point = %s, want adjusted_close null", got)
+	}
+	if points[0]["regime"] != "bull" || points[1]["adjusted_close"] != 1.5 {
+		t.Errorf("json.Marshal = %s, want the other fields unchanged", got)
+	}
+}
+
+func TestComputeRunup(t *testing.T) {
+	// A 50% drawdown followed by a full recovery to a new high.
+	series := indexSeries("2021-01-01", 100, 80, 50, 75, 100)
+	got := computeRunup(series)
+	want := []float64{0, 0, 0, 50, 100}
+	for i := range want {
+		if !almostEqual(got[i].RunupPct, want[i]) {
+			t.Errorf("runup[%d] = %v, want %v", i, got[i].RunupPct, want[i])
+		}
+	}
+	if series[4].RunupPct != 0 {
+		t.Error("computeRunup modified its input")
+	}
+}
+
+func TestComputeDrawdown(t *testing.T) {
+	series := indexSeries("2021-01-01", 100, 80, 50, 75, 120)
+	got := computeDrawdown(series)
+	want := []float64{0, -20, -50, -25, 0}
+	for i := range want {
+		if !almostEqual(got[i].DrawdownPct, want[i]) {
+			t.Errorf("drawdown[%d] = %v, want %v", i, got[i].DrawdownPct, want[i])
+		}
+	}
+	if series[2].DrawdownPct != 0 {
+		t.Error("computeDrawdown modified its input")
+	}
+}
+
+func TestComputeVolatility30D(t *testing.T) {
+	values := []float64{100}
+	for i := range 40 {
+		values = append(values, values[len(values)-1]*(1+float64(i%3-1)/100))
+	}
+	series := indexSeries("2021-01-01", values...)
+
+	daily := computeVolatility30D(series, false)
+	if daily[volatility30DWindow-1].Volatility30D != 0 {
+		t.Errorf("volatility without a full window = %v, want 0", daily[volatility30DWindow-1].Volatility30D)
+	}
+	last := len(series) - 1
+	want := stdDev(dailyReturns(series[last-volatility30DWindow:])) * 100
+	if got := daily[last].Volatility30D; !almostEqual(got, want) {
+		t.Errorf("volatility_30d = %v, want %v", got, want)
+	}
+	if daily[last].AnnualisedVol30D != 0 {
+		t.Errorf("annualised volatility without annualise = %v, want 0", daily[last].AnnualisedVol30D)
+	}
+
+	annualised := computeVolatility30D(series, true)
+	for i := volatility30DWindow; i < len(series); i++ {
+		got, want := annualised[i].AnnualisedVol30D, annualised[i].Volatility30D*math.Sqrt(252)
+		if math.Round(got*1e6) != math.Round(want*1e6) {
+			t.Errorf("annualised[%d] = %.6f, want %.6f", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+)
+
+// keyThrottleDuration is how long a key is skipped after EODHD rejects it
+// with 429 Too Many Requests.
+const keyThrottleDuration = 60 * time.Second
+
+// errAllKeysThrottled is returned when every API key is rate limited.
+var errAllKeysThrottled = errors.New("all EODHD API keys are throttled")
+
+// KeyRotator hands out EODHD API keys round-robin, skipping keys that were
+// recently rate limited.
+type KeyRotator struct {
+	mu        sync.Mutex
+	keys      []string
+	next      int
+	calls     map[string]int
+	throttled map[string]time.Time
+	now       func() time.Time
+}
+
+// NewKeyRotator returns a rotator over keys.
+func NewKeyRotator(keys []string) *KeyRotator {
+	return &KeyRotator{
+		keys:      keys,
+		calls:     make(map[string]int),
+		throttled: make(map[string]time.Time),
+		now:       time.Now,
+	}
+}
+
+// Len returns the number of keys managed by the rotator.
+func (k *KeyRotator) Len() int {
+	return len(k.keys)
+}
+
+// Next returns the next key that is not throttled and counts a call against
+// it.
+func (k *KeyRotator) Next() (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	now := k.now()
+	for range k.keys {
+		key := k.keys[k.next]
+		k.next = (k.next + 1) % len(k.keys)
+		if until, ok := k.throttled[key]; ok && now.Before(until) {
+			continue
+		}
+		k.calls[key]++
+		return key, nil
+	}
+	return "", errAllKeysThrottled
+}
+
+// Throttle marks key as rate limited for keyThrottleDuration.
+func (k *KeyRotator) Throttle(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.throttled[key] = k.now().Add(keyThrottleDuration)
+}
+
+// CallCounts returns the number of calls made with each key.
+func (k *KeyRotator) CallCounts() map[string]int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	counts := make(map[string]int, len(k.calls))
+	for key, n := range k.calls {
+		counts[key] = n
+	}
+	return counts
+}
+
+// fetchEOD reads an EODHD API URL, appending an API key from the key
+// rotator. A rate limited key is not retried while other keys remain: the
+// request moves on to the next key, and only the last one waits out 429
+// responses with the retries of readDataFromURL.
+func (a *App) fetchEOD(ctx context.Context, url string) ([]byte, error) {
+	rotator := a.keyRotator
+	if rotator == nil {
+		rotator = NewKeyRotator([]string{a.EODAPIKEY})
+	}
+	for i := range rotator.Len() {
+		key, err := rotator.Next()
+		if err != nil {
+			return nil, err
+		}
+		policy := a.retryPolicy
+		policy.NoRetryTooManyRequests = i+1 < rotator.Len()
+		body, err := readDataFromURL(ctx, url+"&api_token="+key, policy)
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests {
+			rotator.Throttle(key)
+			continue
+		}
+		return body, err
+	}
+	return nil, errAllKeysThrottled
+}
+
+// SecretAccessor reads the payload of a secret version.
+type SecretAccessor interface {
+	AccessSecret(ctx context.Context, name string) ([]byte, error)
+}
+
+// secretManagerAccessor reads secrets from Secret Manager.
+type secretManagerAccessor struct {
+	client *secretmanager.Client
+}
+
+// newSecretManagerAccessor returns a SecretAccessor backed by Secret Manager.
+func newSecretManagerAccessor(ctx context.Context) (*secretManagerAccessor, error) {
+	client, err := secretmanager.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &secretManagerAccessor{client: client}, nil
+}
+
+// AccessSecret implements SecretAccessor.
+func (s *secretManagerAccessor) AccessSecret(ctx context.Context, name string) ([]byte, error) {
+	resp, err := s.client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetPayload().GetData(), nil
+}
+
+// secretVersionName expands a bare secret ID to the latest version of the
+// secret in projectID. Full resource names are returned unchanged.
+func secretVersionName(projectID, secret string) string {
+	if strings.HasPrefix(secret, "projects/") {
+		return secret
+	}
+	return fmt.Sprintf("projects/%s/secrets/%s/versions/latest", projectID, secret)
+}
+
+// eodAPIKeySecret is the Secret Manager secret holding the EODHD API key.
+const eodAPIKeySecret = "EOD_API_KEY"
+
+// loadSecret reads the latest version of secretName in projectID.
+func loadSecret(ctx context.Context, accessor SecretAccessor, projectID, secretName string) (string, error) {
+	payload, err := accessor.AccessSecret(ctx, secretVersionName(projectID, secretName))
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSpace(string(payload))
+	if value == "" {
+		return "", fmt.Errorf("secret %s is empty", secretName)
+	}
+	return value, nil
+}
+
+// loadAPIKeys reads a list of API keys from a secret. The secret holds either
+// a JSON array of keys or one key per line.
+func loadAPIKeys(ctx context.Context, accessor SecretAccessor, name string) ([]string, error) {
+	payload, err := accessor.AccessSecret(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	if trimmed := strings.TrimSpace(string(payload)); strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal([]byte(trimmed), &keys); err != nil {
+			return nil, fmt.Errorf("invalid API key list: %w", err)
+		}
+	} else {
+		keys = strings.Split(trimmed, "\n")
+	}
+	var valid []string
+	for _, key := range keys {
+		if key = strings.TrimSpace(key); key != "" {
+			valid = append(valid, key)
+		}
+	}
+	if len(valid) == 0 {
+		return nil, fmt.Errorf("secret %s does not contain any API keys", name)
+	}
+	return valid, nil
+}
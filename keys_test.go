@@ -0,0 +1,136 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fakeSecretAccessor struct {
+	secrets map[string]string
+}
+
+func (f *fakeSecretAccessor) AccessSecret(ctx context.Context, name string) ([]byte, error) {
+	payload, ok := f.secrets[name]
+	if !ok {
+		return nil, errors.New("secret not found")
+	}
+	return []byte(payload), nil
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	accessor := &fakeSecretAccessor{secrets: map[string]string{
+		"projects/p/secrets/json/versions/latest":  `["key-a", "key-b"]`,
+		"projects/p/secrets/lines/versions/latest": "key-a\n\nkey-b\n",
+		"projects/p/secrets/empty/versions/latest": "\n",
+	}}
+	for _, secret := range []string{"json", "lines"} {
+		keys, err := loadAPIKeys(context.Background(), accessor, secretVersionName("p", secret))
+		if err != nil || !reflect.DeepEqual(keys, []string{"key-a", "key-b"}) {
+			t.Errorf("%s: loadAPIKeys = %v, %v", secret, keys, err)
+		}
+	}
+	for _, secret := range []string{"empty", "missing"} {
+		if _, err := loadAPIKeys(context.Background(), accessor, secretVersionName("p", secret)); err == nil {
+			t.Errorf("%s: loadAPIKeys succeeded, want error", secret)
+		}
+	}
+}
+
+func TestLoadSecret(t *testing.T) {
+	accessor := &fakeSecretAccessor{secrets: map[string]string{
+		"projects/p/secrets/EOD_API_KEY/versions/latest": "key-a\n",
+		"projects/p/secrets/empty/versions/latest":       " ",
+	}}
+	if got, err := loadSecret(context.Background(), accessor, "p", eodAPIKeySecret); err != nil || got != "key-a" {
+		t.Errorf("loadSecret = %q, %v, want key-a", got, err)
+	}
+	for _, secret := range []string{"empty", "missing"} {
+		if _, err := loadSecret(context.Background(), accessor, "p", secret); err == nil {
+			t.Errorf("%s: loadSecret succeeded, want error", secret)
+		}
+	}
+}
+
+func TestKeyRotator(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rotator := NewKeyRotator([]string{"a", "b", "c"})
+	rotator.now = func() time.Time { return now }
+
+	var got []string
+	for range 4 {
+		key, err := rotator.Next()
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		got = append(got, key)
+	}
+	if want := []string{"a", "b", "c", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("keys = %v, want %v", got, want)
+	}
+
+	rotator.Throttle("b")
+	if key, _ := rotator.Next(); key != "c" {
+		t.Errorf("Next after throttling b = %q, want c", key)
+	}
+	rotator.Throttle("a")
+	rotator.Throttle("c")
+	if _, err := rotator.Next(); err != errAllKeysThrottled {
+		t.Errorf("Next with all keys throttled: err = %v, want %v", err, errAllKeysThrottled)
+	}
+
+	now = now.Add(keyThrottleDuration)
+	if key, err := rotator.Next(); err != nil || key != "a" {
+		t.Errorf("Next after throttle expiry = %q, %v, want a", key, err)
+	}
+	if want := map[string]int{"a": 3, "b": 1, "c": 2}; !reflect.DeepEqual(rotator.CallCounts(), want) {
+		t.Errorf("CallCounts = %v, want %v", rotator.CallCounts(), want)
+	}
+}
+
+func TestFetchEODRotatesOnTooManyRequests(t *testing.T) {
+	var tokens []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("api_token")
+		tokens = append(tokens, token)
+		if token == "exhausted" {
+			http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("[]"))
+	}))
+	t.Cleanup(srv.Close)
+
+	app := newTestApp(t)
+	app.keyRotator = NewKeyRotator([]string{"exhausted", "fresh"})
+	app.retryPolicy = testRetryPolicy
+	for range 2 {
+		body, err := app.fetchEOD(context.Background(), srv.URL+"/eod/VOO.US?fmt=json")
+		if err != nil || string(body) != "[]" {
+			t.Fatalf("fetchEOD = %q, %v", body, err)
+		}
+	}
+	// The exhausted key is tried once without retries, then skipped while
+	// throttled.
+	if want := []string{"exhausted", "fresh", "fresh"}; !reflect.DeepEqual(tokens, want) {
+		t.Errorf("tokens = %v, want %v", tokens, want)
+	}
+}
@@ -16,16 +16,22 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"time"
+	_ "time/tzdata" // output_timezone must not depend on the image having tzdata
 
 	"cloud.google.com/go/logging"
 	"example.com/micro/metadata"
 	"github.com/gorilla/mux"
+	"golang.org/x/sync/singleflight"
 	"google.golang.org/api/option"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -36,10 +42,49 @@ type App struct {
 	projectID            string
 	log                  *logging.Logger
 	bucketCacheDirectory string
+	cacheBackend         CacheBackend
 	EODAPIKEY            string
+	adminToken           string
+	yahooBaseURL         string
+	eodBaseURL           string
+	cachePublisher       CacheEventPublisher
+	maxRawDataSeries     int
+	keyRotator           *KeyRotator
+	adminHMACSecret      []byte
+	shareSigningKey      []byte
+	shareBaseURL         string
+	memCache             *memoryCache
+	rateLimiter          RateLimiter
+	rateLimitAPIKeys     map[string]bool
+	trustedProxyHops     int
+	fundamentals         *fundamentalsCache
+	metrics              *TrackedMetrics
+	errorBudget          *ErrorBudget
+	snapshotStore        SnapshotStore
+	snapshots            *indexSnapshots
+	retryPolicy          retryPolicy
+	eodBreaker           *circuitBreaker
+	promMetrics          *promMetrics
+	cacheLocks           symbolLocks
+	fetches              singleflight.Group
+	staleThreshold       time.Duration
+	refreshes            backgroundRefreshes
+	retention            retentionPolicy
+	cacheMountBucket     *GCSCacheBackend
+	prewarmAt            time.Duration
+	rawComparisonEnabled bool
 }
 
 func main() {
+	exportSpec := flag.Bool("export-openapi", false, "write the OpenAPI spec to stdout and exit")
+	flag.Parse()
+	if *exportSpec {
+		if err := exportOpenAPI(os.Stdout); err != nil {
+			log.Fatalf("unable to export OpenAPI spec: %v", err)
+		}
+		return
+	}
+
 	ctx := context.Background()
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -51,6 +96,15 @@ func main() {
 	if err != nil {
 		log.Fatalf("unable to initialize application: %v", err)
 	}
+
+	// Listen for SIGINT to gracefully shutdown. Requests can detect the
+	// shutdown through their context.
+	nctx, stop := signal.NotifyContext(ctx, os.Interrupt, os.Kill)
+	defer stop()
+	app.BaseContext = func(net.Listener) context.Context { return nctx }
+	timeout := shutdownTimeout(os.Getenv("SHUTDOWN_TIMEOUT_SECONDS"))
+	log.Printf("graceful shutdown timeout is %s", timeout)
+
 	log.Println("starting HTTP server")
 	go func() {
 		if err := app.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -58,18 +112,43 @@ func main() {
 		}
 	}()
 
-	// Listen for SIGINT to gracefully shutdown.
-	nctx, stop := signal.NotifyContext(ctx, os.Interrupt, os.Kill)
-	defer stop()
+	// Load balancer probes get their own server on HEALTH_PORT, so that they
+	// never depend on the service itself.
+	healthPort := os.Getenv("HEALTH_PORT")
+	if healthPort == "" {
+		healthPort = defaultHealthPort
+	}
+	healthServer := newLoadBalancerHealthServer(healthPort)
+	log.Printf("serving load balancer health checks on port %s", healthPort)
+	go func() {
+		if err := healthServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Health server closed: %v", err)
+		}
+	}()
+
+	// Expire the cache files of previous days in the background. The
+	// objects of a bucket cache, including the bucket mounted as the cache
+	// directory, are archived before they are deleted.
+	if bucket := app.retentionBucket(); bucket != nil {
+		go app.runCacheRetention(nctx, bucket, cacheEvictionInterval)
+	} else {
+		go app.runCacheEviction(nctx, cacheEvictionInterval)
+	}
+
+	// Fetch the data of every fund component ahead of the first request.
+	go app.runCachePrewarm(nctx, app.prewarmAt)
+
+	// Forget the token buckets of clients that have gone quiet.
+	if limiter, ok := app.rateLimiter.(*tokenBucketRateLimiter); ok {
+		go limiter.runCleanup(nctx, time.Minute)
+	}
+
 	<-nctx.Done()
 	log.Println("shutdown initiated")
 
-	// Cloud Run gives apps 10 seconds to shutdown. See
-	// https://cloud.google.com/blog/topics/developers-practitioners/graceful-shutdowns-cloud-run-deep-dive
-	// for more details.
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-	app.Shutdown(ctx)
+	if err := shutdownServers(timeout, app.Server, healthServer); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
 	log.Println("shutdown")
 }
 
@@ -113,14 +192,314 @@ func newApp(ctx context.Context, port, projectID string) (*App, error) {
 		app.bucketCacheDirectory = "./gcs-fund-service-cache" // Use a local directory for testing
 	}
 
-	// Set EODAPIKEY
-	app.EODAPIKEY = "67d249e65f7402.22787178"
+	// Price data is cached in the directory above unless CACHE_BACKEND=gcs,
+	// which reads and writes CACHE_BUCKET directly. With the file backend,
+	// CACHE_BUCKET names the bucket mounted as the directory, whose objects
+	// are then archived and deleted by the retention policy instead of
+	// being evicted after a day.
+	switch backend := os.Getenv("CACHE_BACKEND"); backend {
+	case "", "file":
+		app.cacheBackend = FileCacheBackend{Dir: app.bucketCacheDirectory}
+		if bucket := os.Getenv("CACHE_BUCKET"); bucket != "" {
+			gcs, err := newGCSCacheBackend(ctx, bucket)
+			if err != nil {
+				return nil, fmt.Errorf("unable to initialize Cloud Storage cache: %w", err)
+			}
+			app.cacheMountBucket = gcs
+		}
+	case "gcs":
+		bucket := os.Getenv("CACHE_BUCKET")
+		if bucket == "" {
+			return nil, fmt.Errorf("CACHE_BACKEND=gcs requires CACHE_BUCKET")
+		}
+		gcs, err := newGCSCacheBackend(ctx, bucket)
+		if err != nil {
+			return nil, fmt.Errorf("unable to initialize Cloud Storage cache: %w", err)
+		}
+		app.cacheBackend = gcs
+	default:
+		return nil, fmt.Errorf("invalid CACHE_BACKEND %q, expected file or gcs", backend)
+	}
+
+	// Objects of a bucket cache are moved to Nearline after
+	// ARCHIVE_AFTER_DAYS and deleted after DELETE_AFTER_DAYS.
+	app.retention = retentionPolicy{ArchiveAfterDays: defaultArchiveAfterDays, DeleteAfterDays: defaultDeleteAfterDays}
+	if v := os.Getenv("ARCHIVE_AFTER_DAYS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid ARCHIVE_AFTER_DAYS %q", v)
+		}
+		app.retention.ArchiveAfterDays = n
+	}
+	if v := os.Getenv("DELETE_AFTER_DAYS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid DELETE_AFTER_DAYS %q", v)
+		}
+		app.retention.DeleteAfterDays = n
+	}
+	if app.retention.DeleteAfterDays <= app.retention.ArchiveAfterDays {
+		return nil, fmt.Errorf("DELETE_AFTER_DAYS must be greater than ARCHIVE_AFTER_DAYS")
+	}
 
-	// Setup request router.
-	r := mux.NewRouter()
+	app.eodBaseURL = "https://eodhd.com/api"
+
+	// Retry transient upstream failures, up to FETCH_RETRY_ATTEMPTS attempts.
+	app.retryPolicy = defaultRetryPolicy
+	app.eodBreaker = newCircuitBreaker(eodBreakerThreshold, eodBreakerCooldown)
+	if v := os.Getenv("FETCH_RETRY_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid FETCH_RETRY_ATTEMPTS %q", v)
+		}
+		app.retryPolicy.Attempts = n
+	}
+
+	// The EODHD API key comes from EOD_API_KEY for local development and
+	// from Secret Manager otherwise, unless a key list secret replaces it.
+	app.EODAPIKEY = os.Getenv("EOD_API_KEY")
+	keysSecret := os.Getenv("EOD_API_KEYS_SECRET")
+	var accessor SecretAccessor
+	if app.EODAPIKEY == "" || keysSecret != "" {
+		secretManager, err := newSecretManagerAccessor(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to initialize Secret Manager client: %w", err)
+		}
+		accessor = secretManager
+	}
+	if app.EODAPIKEY == "" && keysSecret == "" {
+		if app.EODAPIKEY, err = loadSecret(ctx, accessor, app.projectID, eodAPIKeySecret); err != nil {
+			return nil, fmt.Errorf("unable to load EODHD API key: %w", err)
+		}
+	}
+
+	// Rotate across several API keys when a key list secret is configured.
+	app.keyRotator = NewKeyRotator([]string{app.EODAPIKEY})
+	if keysSecret != "" {
+		keys, err := loadAPIKeys(ctx, accessor, secretVersionName(app.projectID, keysSecret))
+		if err != nil {
+			return nil, fmt.Errorf("unable to load EODHD API keys: %w", err)
+		}
+		app.keyRotator = NewKeyRotator(keys)
+	}
+
+	// Cache update notifications are only sent when a topic is configured.
+	if topicID := os.Getenv("CACHE_UPDATE_TOPIC"); topicID != "" {
+		publisher, err := newPubSubPublisher(ctx, app.projectID, topicID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to initialize Pub/Sub publisher: %w", err)
+		}
+		app.cachePublisher = publisher
+	}
 
-	r.HandleFunc("/{symbol}", app.Handler).Methods("GET")
-	app.Server.Handler = r
+	// Cap the number of component series returned with include_raw_data.
+	app.maxRawDataSeries = defaultMaxRawDataSeries
+	if v := os.Getenv("MAX_RAW_DATA_SERIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid MAX_RAW_DATA_SERIES %q", v)
+		}
+		app.maxRawDataSeries = n
+	}
+
+	// Keep recently read price series in memory, up to MAX_MEMORY_CACHE_MB
+	// and MAX_MEMORY_CACHE_ENTRIES series (0 for no entry limit).
+	maxMemoryCacheMB := defaultMaxMemoryCacheMB
+	if v := os.Getenv("MAX_MEMORY_CACHE_MB"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid MAX_MEMORY_CACHE_MB %q", v)
+		}
+		maxMemoryCacheMB = n
+	}
+	maxMemoryCacheEntries := defaultMaxMemoryCacheEntries
+	if v := os.Getenv("MAX_MEMORY_CACHE_ENTRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid MAX_MEMORY_CACHE_ENTRIES %q", v)
+		}
+		maxMemoryCacheEntries = n
+	}
+	if maxMemoryCacheMB > 0 {
+		app.memCache = newMemoryCache(maxMemoryCacheMB<<20, maxMemoryCacheEntries)
+	}
+
+	// Requests are only rate limited when a limit is configured. With Redis
+	// the limit is shared by every instance.
+	if v := os.Getenv("RATE_LIMIT_PER_MINUTE"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid RATE_LIMIT_PER_MINUTE %q", v)
+		}
+		app.rateLimiter = newMemoryRateLimiter(limit)
+		if redisURL := os.Getenv("REDIS_URL"); redisURL != "" {
+			limiter, err := newRedisRateLimiter(redisURL, limit)
+			if err != nil {
+				return nil, err
+			}
+			app.rateLimiter = limiter
+		}
+	}
+	// Alternatively, RATE_LIMIT_RPS gives every client a token bucket of
+	// RATE_LIMIT_BURST requests, refilled at that many requests per second.
+	if v := os.Getenv("RATE_LIMIT_RPS"); v != "" {
+		if app.rateLimiter != nil {
+			return nil, fmt.Errorf("RATE_LIMIT_RPS cannot be combined with RATE_LIMIT_PER_MINUTE")
+		}
+		rps, err := strconv.ParseFloat(v, 64)
+		if err != nil || !(rps > 0) {
+			return nil, fmt.Errorf("invalid RATE_LIMIT_RPS %q", v)
+		}
+		burst := int(math.Ceil(rps))
+		if v := os.Getenv("RATE_LIMIT_BURST"); v != "" {
+			if burst, err = strconv.Atoi(v); err != nil || burst < 1 {
+				return nil, fmt.Errorf("invalid RATE_LIMIT_BURST %q", v)
+			}
+		}
+		app.rateLimiter = newTokenBucketRateLimiter(rps, burst)
+	}
+	// Clients sending one of the comma separated RATE_LIMIT_API_KEYS in
+	// X-API-Key are limited by key rather than by IP address.
+	app.rateLimitAPIKeys = parseRateLimitAPIKeys(os.Getenv("RATE_LIMIT_API_KEYS"))
+	// Clients are identified by the X-Forwarded-For entry appended by Cloud
+	// Run, or TRUSTED_PROXY_HOPS entries before the end when more proxies,
+	// such as a load balancer, are in front of the service.
+	if v := os.Getenv("TRUSTED_PROXY_HOPS"); v != "" {
+		hops, err := strconv.Atoi(v)
+		if err != nil || hops < 0 {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXY_HOPS %q", v)
+		}
+		app.trustedProxyHops = hops
+	}
+
+	// With STALE_WHILE_REVALIDATE_THRESHOLD_HOURS set, serve the most
+	// recent cached data right away, even the previous day's, and refresh
+	// it in the background once it is older than the threshold. It is off
+	// by default, when every symbol is fetched once a day.
+	if v := os.Getenv("STALE_WHILE_REVALIDATE_THRESHOLD_HOURS"); v != "" {
+		hours, err := strconv.ParseFloat(v, 64)
+		if err != nil || !(hours >= 0) {
+			return nil, fmt.Errorf("invalid STALE_WHILE_REVALIDATE_THRESHOLD_HOURS %q", v)
+		}
+		app.staleThreshold = time.Duration(hours * float64(time.Hour))
+	}
+
+	// The funds are read from SYMBOLS_CONFIG_PATH, the built-in funds if unset.
+	if path := os.Getenv("SYMBOLS_CONFIG_PATH"); path != "" {
+		funds, err := loadSymbolConfig(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SYMBOLS_CONFIG_PATH: %w", err)
+		}
+		if err := setFundDefinitions(funds); err != nil {
+			return nil, err
+		}
+	}
+
+	// The cache is warmed at startup and every day at PREWARM_TIME UTC.
+	prewarmTime := os.Getenv("PREWARM_TIME")
+	if prewarmTime == "" {
+		prewarmTime = defaultPrewarmTime
+	}
+	if app.prewarmAt, err = parsePrewarmTime(prewarmTime); err != nil {
+		return nil, err
+	}
+
+	// Admin endpoints are only enabled when a bearer token is configured.
+	app.adminToken = os.Getenv("ADMIN_TOKEN")
+	// Admin requests must also be signed when an HMAC secret is configured.
+	app.adminHMACSecret = []byte(os.Getenv("ADMIN_HMAC_SECRET"))
+	app.yahooBaseURL = "https://query1.finance.yahoo.com"
+	app.fundamentals = newFundamentalsCache()
+	app.metrics = &TrackedMetrics{}
+	app.errorBudget = &ErrorBudget{}
+	app.promMetrics = newPromMetrics()
+
+	// Index snapshots are only enabled when a bucket is configured. They
+	// can be loaded before the server accepts traffic.
+	app.snapshots = newIndexSnapshots()
+	if bucket := os.Getenv("SNAPSHOT_BUCKET"); bucket != "" {
+		store, err := newGCSSnapshotStore(ctx, bucket)
+		if err != nil {
+			return nil, fmt.Errorf("unable to initialize Cloud Storage client: %w", err)
+		}
+		app.snapshotStore = store
+		if os.Getenv("LOAD_SNAPSHOT_ON_BOOT") == "true" {
+			if err := app.loadSnapshots(ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Comparing raw tickers is disabled unless explicitly enabled.
+	app.rawComparisonEnabled = os.Getenv("RAW_COMPARISON_ENABLED") == "true"
+
+	// Share links are only enabled when a signing key is configured.
+	app.shareSigningKey = []byte(os.Getenv("SHARE_SIGNING_KEY"))
+	app.shareBaseURL = os.Getenv("SHARE_BASE_URL")
+
+	// Browsers may call the service from any origin unless
+	// CORS_ALLOWED_ORIGINS lists the allowed ones.
+	cors := defaultCORSConfig
+	cors.AllowedOrigins = parseCORSOrigins(os.Getenv("CORS_ALLOWED_ORIGINS"))
+	cors.AllowCredentials = os.Getenv("CORS_ALLOW_CREDENTIALS") == "true"
+	if err := cors.validate(); err != nil {
+		return nil, err
+	}
+
+	// Setup request router, compressing the responses for clients that accept gzip.
+	app.Server.Handler = gzipMiddleware(corsMiddleware(cors, app.newRouter()))
 
 	return app, nil
 }
+
+// newRouter registers the service endpoints on a new request router.
+func (a *App) newRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.Use(requestID)
+	if a.promMetrics != nil {
+		r.Use(a.promMetrics.instrument)
+	}
+	if a.metrics != nil {
+		r.Use(a.trackMetrics)
+	}
+	if a.errorBudget != nil {
+		r.Use(a.trackErrorBudget)
+	}
+	if a.rateLimiter != nil {
+		r.Use(a.rateLimit)
+	}
+
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(a.requireAdmin)
+	admin.HandleFunc("/reconcile/{ticker}", a.ReconcileHandler).Methods("GET")
+	admin.HandleFunc("/share", a.ShareHandler).Methods("GET")
+	admin.HandleFunc("/snapshot", a.SnapshotHandler).Methods("POST")
+	admin.HandleFunc("/error-budget", a.ErrorBudgetHandler).Methods("GET")
+
+	r.HandleFunc("/routes", RoutesHandler(r)).Methods("GET")
+	r.HandleFunc("/health", a.HealthHandler).Methods("GET")
+	r.HandleFunc("/ready", a.ReadyHandler).Methods("GET")
+	r.HandleFunc("/status", a.StatusHandler).Methods("GET")
+	if a.promMetrics != nil {
+		r.Handle("/metrics", a.promMetrics.handler()).Methods("GET")
+	}
+	r.HandleFunc("/healthz/cache", a.CacheHealthHandler).Methods("GET")
+	r.HandleFunc("/blend", a.BlendHandler).Methods("GET")
+	r.HandleFunc("/compare", a.CompareHandler).Methods("GET")
+	r.HandleFunc("/universe", a.UniverseHandler).Methods("GET")
+	r.HandleFunc("/chart-data", a.ChartDataHandler).Methods("GET")
+	r.HandleFunc("/raw-comparison", a.RawComparisonHandler).Methods("GET")
+	r.HandleFunc("/fundamentals/{symbol}", a.FundamentalsHandler).Methods("GET")
+	r.HandleFunc("/quality/{symbol}", a.QualityHandler).Methods("GET")
+	r.HandleFunc("/{symbol}/backtest/period", a.BacktestPeriodHandler).Methods("GET")
+	r.HandleFunc("/{symbol}/mom", a.MultipleOfMoneyHandler).Methods("GET")
+	r.HandleFunc("/{symbol}/crossings", a.CrossingsHandler).Methods("GET")
+	r.HandleFunc("/{symbol}/stats", a.StatsHandler).Methods("GET")
+	r.HandleFunc("/{symbol}/model", a.ModelHandler).Methods("GET")
+	r.HandleFunc("/{symbol}/montecarlo", a.MonteCarloHandler).Methods("GET")
+	r.HandleFunc("/{symbol}/impact", a.ImpactHandler).Methods("GET")
+	r.HandleFunc("/{symbol}/dca", a.ContributionsHandler).Methods("GET")
+	r.Handle("/{symbol}/cache", a.requireAdmin(http.HandlerFunc(a.CacheInvalidateHandler))).Methods("DELETE")
+	r.Handle("/{symbol}", a.requireValidShareToken(http.HandlerFunc(a.Handler))).Methods("GET")
+	return r
+}
@@ -0,0 +1,157 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// defaultMaxMemoryCacheMB is the in-memory cache size used when
+// MAX_MEMORY_CACHE_MB is not set.
+const defaultMaxMemoryCacheMB = 256
+
+// defaultMaxMemoryCacheEntries is the number of series kept in memory when
+// MAX_MEMORY_CACHE_ENTRIES is not set.
+const defaultMaxMemoryCacheEntries = 128
+
+// stockDataEntryBytes is the approximate memory footprint of one cached data
+// point: 8 fields of 8 bytes each.
+const stockDataEntryBytes = 64
+
+// memoryCache is an LRU cache of parsed price series that keeps the
+// approximate size of its entries below a byte limit and, when maxEntries is
+// set, their number below maxEntries. Every entry is dropped when the UTC date
+// changes, since the price files are refreshed daily. A nil cache is valid
+// and never holds any entries. Cached series are shared between callers and
+// must not be modified.
+type memoryCache struct {
+	mu         sync.Mutex
+	maxBytes   int
+	maxEntries int
+	bytes      int
+	order      *list.List // most recently used at the front
+	entries    map[string]*list.Element
+	day        string
+	now        func() time.Time
+}
+
+type memoryCacheEntry struct {
+	key  string
+	data []StockData
+	size int
+}
+
+// newMemoryCache returns an empty cache holding at most maxBytes and, unless
+// maxEntries is 0, at most maxEntries series.
+func newMemoryCache(maxBytes, maxEntries int) *memoryCache {
+	return &memoryCache{
+		maxBytes:   maxBytes,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+		now:        time.Now,
+	}
+}
+
+// seriesFootprint returns the approximate memory footprint of data.
+func seriesFootprint(data []StockData) int {
+	return len(data) * stockDataEntryBytes
+}
+
+// Get returns the series cached under key.
+func (c *memoryCache) Get(key string) ([]StockData, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evictStaleDay()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*memoryCacheEntry).data, true
+}
+
+// Add caches data under key, evicting the least recently used entries until
+// the cache fits within its limit. Series larger than the limit are not
+// cached.
+func (c *memoryCache) Add(key string, data []StockData) {
+	if c == nil {
+		return
+	}
+	size := seriesFootprint(data)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evictStaleDay()
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	if size > c.maxBytes {
+		return
+	}
+	for c.bytes+size > c.maxBytes || (c.maxEntries > 0 && c.order.Len() >= c.maxEntries) {
+		c.remove(c.order.Back())
+	}
+	c.entries[key] = c.order.PushFront(&memoryCacheEntry{key: key, data: data, size: size})
+	c.bytes += size
+}
+
+// Remove drops the series cached under key and reports whether there was
+// one.
+func (c *memoryCache) Remove(key string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if ok {
+		c.remove(elem)
+	}
+	return ok
+}
+
+// Size returns the approximate footprint of the cached entries in bytes.
+func (c *memoryCache) Size() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bytes
+}
+
+// evictStaleDay drops every entry when the UTC date has changed since the
+// last access.
+func (c *memoryCache) evictStaleDay() {
+	today := c.now().UTC().Format(time.DateOnly)
+	if today == c.day {
+		return
+	}
+	c.day = today
+	c.order.Init()
+	clear(c.entries)
+	c.bytes = 0
+}
+
+func (c *memoryCache) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*memoryCacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
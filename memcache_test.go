@@ -0,0 +1,145 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheLimit(t *testing.T) {
+	const limit = 10 * stockDataEntryBytes
+	cache := newMemoryCache(limit, 0)
+	for i := range 20 {
+		cache.Add(fmt.Sprintf("key-%d", i), make([]StockData, i%4+1))
+		if cache.Size() > limit {
+			t.Fatalf("after %d adds Size() = %d, want at most %d", i+1, cache.Size(), limit)
+		}
+	}
+
+	cache.Add("too-big", make([]StockData, 11))
+	if _, ok := cache.Get("too-big"); ok {
+		t.Error("series larger than the limit was cached")
+	}
+}
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newMemoryCache(3*stockDataEntryBytes, 0)
+	cache.Add("a", make([]StockData, 1))
+	cache.Add("b", make([]StockData, 1))
+	cache.Add("c", make([]StockData, 1))
+	cache.Get("a")
+	cache.Add("d", make([]StockData, 1))
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("least recently used entry b was not evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("entry %s was evicted", key)
+		}
+	}
+
+	cache.Add("a", make([]StockData, 2))
+	if got, want := cache.Size(), 3*stockDataEntryBytes; got != want {
+		t.Errorf("Size() after replacing a = %d, want %d", got, want)
+	}
+}
+
+func TestMemoryCacheMaxEntries(t *testing.T) {
+	cache := newMemoryCache(100*stockDataEntryBytes, 2)
+	cache.Add("a", make([]StockData, 1))
+	cache.Add("b", make([]StockData, 1))
+	cache.Add("c", make([]StockData, 1))
+	if _, ok := cache.Get("a"); ok {
+		t.Error("entry a was not evicted beyond the entry limit")
+	}
+	if _, ok := cache.Get("c"); !ok {
+		t.Error("entry c was evicted")
+	}
+}
+
+func TestMemoryCacheEvictsOnNewDay(t *testing.T) {
+	now := time.Date(2024, 3, 1, 23, 59, 0, 0, time.UTC)
+	cache := newMemoryCache(100*stockDataEntryBytes, 0)
+	cache.now = func() time.Time { return now }
+	cache.Add("a", make([]StockData, 1))
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatal("entry a was not cached")
+	}
+	now = now.Add(2 * time.Minute)
+	if _, ok := cache.Get("a"); ok {
+		t.Error("entry a survived the change of UTC date")
+	}
+	if cache.Size() != 0 {
+		t.Errorf("Size() = %d after the change of date, want 0", cache.Size())
+	}
+}
+
+func TestNilMemoryCache(t *testing.T) {
+	var cache *memoryCache
+	cache.Add("a", make([]StockData, 1))
+	if _, ok := cache.Get("a"); ok || cache.Size() != 0 {
+		t.Error("nil cache holds entries")
+	}
+}
+
+func TestPrepareSymbolJSONDataMemoryCache(t *testing.T) {
+	app := newTestApp(t)
+	app.memCache = newMemoryCache(defaultMaxMemoryCacheMB<<20, defaultMaxMemoryCacheEntries)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101))
+
+	first, err := app.PrepareSymbolJSONData(context.Background(), "VOO.US", fundInceptionDate, "")
+	if err != nil {
+		t.Fatalf("PrepareSymbolJSONData: %v", err)
+	}
+	if err := os.RemoveAll(filepath.Join(app.bucketCacheDirectory, "VOO.US")); err != nil {
+		t.Fatalf("os.RemoveAll: %v", err)
+	}
+	second, err := app.PrepareSymbolJSONData(context.Background(), "VOO.US", fundInceptionDate, "")
+	if err != nil {
+		t.Fatalf("PrepareSymbolJSONData: %v", err)
+	}
+	if len(second) != len(first) || second[1] != first[1] {
+		t.Errorf("second call = %+v, want the in-memory %+v", second, first)
+	}
+}
+
+// BenchmarkPrepareSymbolJSONDataMemoryCache measures same-day calls for a
+// cached symbol. The cache file is removed and the EOD API is unreachable
+// after the first call, so any disk read or fetch fails the benchmark.
+func BenchmarkPrepareSymbolJSONDataMemoryCache(b *testing.B) {
+	app := newTestApp(b)
+	app.memCache = newMemoryCache(defaultMaxMemoryCacheMB<<20, defaultMaxMemoryCacheEntries)
+	app.eodBaseURL = "http://127.0.0.1:0"
+	writeFixture(b, app, "VOO.US", benchmarkSeries(5*252, true))
+	if _, err := app.PrepareSymbolJSONData(context.Background(), "VOO.US", fundInceptionDate, ""); err != nil {
+		b.Fatalf("PrepareSymbolJSONData: %v", err)
+	}
+	if err := os.RemoveAll(filepath.Join(app.bucketCacheDirectory, "VOO.US")); err != nil {
+		b.Fatalf("os.RemoveAll: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := app.PrepareSymbolJSONData(context.Background(), "VOO.US", fundInceptionDate, ""); err != nil {
+			b.Fatalf("PrepareSymbolJSONData read past the memory cache: %v", err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// latencyBufferSize is the number of recent request durations kept for the
+// latency percentiles.
+const latencyBufferSize = 1000
+
+// TrackedMetrics counts the requests served and keeps the durations of the
+// most recent ones in a ring buffer. It is safe for concurrent use.
+type TrackedMetrics struct {
+	mu        sync.Mutex
+	requests  int64
+	latencies [latencyBufferSize]time.Duration
+	// next is the position of the next duration in latencies, and filled
+	// whether the buffer has wrapped around.
+	next   int
+	filled bool
+}
+
+// Record counts a request that took d.
+func (m *TrackedMetrics) Record(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests++
+	m.latencies[m.next] = d
+	m.next = (m.next + 1) % latencyBufferSize
+	if m.next == 0 {
+		m.filled = true
+	}
+}
+
+// snapshot returns the request count and a copy of the recorded durations.
+func (m *TrackedMetrics) snapshot() (int64, []time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := m.next
+	if m.filled {
+		n = latencyBufferSize
+	}
+	return m.requests, slices.Clone(m.latencies[:n])
+}
+
+// computePercentiles returns the p50, p95 and p99 of buf in milliseconds,
+// using the nearest rank. All are zero when buf is empty.
+func computePercentiles(buf []time.Duration) map[string]float64 {
+	sorted := slices.Clone(buf)
+	slices.Sort(sorted)
+	percentiles := map[string]float64{"p50": 0, "p95": 0, "p99": 0}
+	if len(sorted) == 0 {
+		return percentiles
+	}
+	for name, p := range map[string]float64{"p50": 50, "p95": 95, "p99": 99} {
+		rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+		percentiles[name] = float64(sorted[max(rank-1, 0)]) / float64(time.Millisecond)
+	}
+	return percentiles
+}
+
+// StatusResponse is the body of the /status endpoint.
+type StatusResponse struct {
+	RequestCount int64              `json:"request_count"`
+	LatencyMs    map[string]float64 `json:"latency_ms"`
+}
+
+// trackMetrics records the duration of every request.
+func (a *App) trackMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		a.metrics.Record(time.Since(start))
+	})
+}
+
+// StatusHandler reports the number of requests served and the latency
+// percentiles of the most recent ones.
+func (a *App) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	var status StatusResponse
+	var latencies []time.Duration
+	if a.metrics != nil {
+		status.RequestCount, latencies = a.metrics.snapshot()
+	}
+	status.LatencyMs = computePercentiles(latencies)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestComputePercentiles(t *testing.T) {
+	buf := make([]time.Duration, 100)
+	for i := range buf {
+		// 100ms down to 1ms, so that the input is not sorted.
+		buf[i] = time.Duration(100-i) * time.Millisecond
+	}
+	got := computePercentiles(buf)
+	want := map[string]float64{"p50": 50, "p95": 95, "p99": 99}
+	for name, w := range want {
+		if got[name] != w {
+			t.Errorf("%s = %v, want %v", name, got[name], w)
+		}
+	}
+	if buf[0] != 100*time.Millisecond {
+		t.Errorf("computePercentiles modified its input")
+	}
+	if got := computePercentiles(nil); got["p50"] != 0 || got["p99"] != 0 {
+		t.Errorf("empty buffer = %v, want zeros", got)
+	}
+}
+
+func TestTrackedMetricsRingBuffer(t *testing.T) {
+	var m TrackedMetrics
+	var wg sync.WaitGroup
+	for i := range latencyBufferSize + 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Record(time.Duration(i))
+		}()
+	}
+	wg.Wait()
+	count, latencies := m.snapshot()
+	if count != latencyBufferSize+10 {
+		t.Errorf("count = %d, want %d", count, latencyBufferSize+10)
+	}
+	if len(latencies) != latencyBufferSize {
+		t.Errorf("len(latencies) = %d, want %d", len(latencies), latencyBufferSize)
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	app := newTestApp(t)
+	app.metrics = &TrackedMetrics{}
+	router := app.newRouter()
+	for range 3 {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/routes", nil))
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/status", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d", rr.Code, http.StatusOK)
+	}
+	var got StatusResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if got.RequestCount != 3 {
+		t.Errorf("RequestCount = %d, want 3", got.RequestCount)
+	}
+	for _, name := range []string{"p50", "p95", "p99"} {
+		if _, ok := got.LatencyMs[name]; !ok {
+			t.Errorf("latency_ms has no %s", name)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// confidenceZ95 is the standard normal quantile of a two-sided 95% interval.
+const confidenceZ95 = 1.959963984540054
+
+// GBMParams are the annualised parameters of a geometric Brownian motion
+// fitted to a series, with 95% confidence intervals.
+type GBMParams struct {
+	Mu    float64 `json:"mu"`
+	Sigma float64 `json:"sigma"`
+	// RSquared measures how well the daily log returns follow a normal
+	// distribution, from the normal Q-Q plot. 1 is a perfect fit.
+	RSquared     float64    `json:"r_squared"`
+	MuCI95       [2]float64 `json:"mu_ci_95"`
+	SigmaCI95    [2]float64 `json:"sigma_ci_95"`
+	Observations int        `json:"observations"`
+}
+
+// fitGBM estimates the drift and volatility of a geometric Brownian motion
+// from daily log returns, annualised over tradingDaysPerYear days. Under the
+// model the log returns are normal with mean (mu - sigma²/2)dt and standard
+// deviation sigma√dt. Fewer than two returns give zero parameters.
+func fitGBM(returns []float64) GBMParams {
+	n := len(returns)
+	params := GBMParams{Observations: n}
+	if n < 2 {
+		return params
+	}
+	m, sd := mean(returns), stdDev(returns)
+	params.Sigma = sd * math.Sqrt(tradingDaysPerYear)
+	params.Mu = m*tradingDaysPerYear + params.Sigma*params.Sigma/2
+
+	// The drift interval comes from the standard error of the mean, and the
+	// volatility interval from the large-sample standard error of sd.
+	muMargin := confidenceZ95 * sd / math.Sqrt(float64(n)) * tradingDaysPerYear
+	params.MuCI95 = [2]float64{params.Mu - muMargin, params.Mu + muMargin}
+	sigmaMargin := confidenceZ95 / math.Sqrt(2*float64(n-1))
+	params.SigmaCI95 = [2]float64{params.Sigma * (1 - sigmaMargin), params.Sigma * (1 + sigmaMargin)}
+
+	params.RSquared = normalQQRSquared(returns)
+	return params
+}
+
+// normalQQRSquared returns the squared correlation between the sorted values
+// and the matching quantiles of the standard normal distribution.
+func normalQQRSquared(values []float64) float64 {
+	n := len(values)
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	quantiles := make([]float64, n)
+	for i := range quantiles {
+		// Blom's plotting positions.
+		p := (float64(i+1) - 0.375) / (float64(n) + 0.25)
+		quantiles[i] = math.Sqrt2 * math.Erfinv(2*p-1)
+	}
+	ms, mq := mean(sorted), mean(quantiles)
+	var sxy, sxx, syy float64
+	for i := range sorted {
+		dx, dy := sorted[i]-ms, quantiles[i]-mq
+		sxy += dx * dy
+		sxx += dx * dx
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0
+	}
+	return sxy * sxy / (sxx * syy)
+}
+
+// ModelHandler fits a geometric Brownian motion to the index series of a
+// fund, e.g. /QUARTZ9/model?from=2021-01-01.
+func (a *App) ModelHandler(w http.ResponseWriter, r *http.Request) {
+	symbol := strings.ToUpper(mux.Vars(r)["symbol"])
+	fund, ok := lookupFund(symbol)
+	if !ok {
+		http.Error(w, "Invalid symbol", http.StatusBadRequest)
+		return
+	}
+	from, err := optionalDateParam(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	series, err := a.computeIndexSeries(r.Context(), fund, from, indexOptions{})
+	if err != nil {
+		http.Error(w, "Error computing index series", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fitGBM(dailyLogReturns(series)))
+}
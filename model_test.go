@@ -0,0 +1,93 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFitGBM(t *testing.T) {
+	const mu, sigma, years = 0.18, 0.24, 50
+	rng := rand.New(rand.NewPCG(1, 2))
+	dt := 1.0 / tradingDaysPerYear
+	returns := make([]float64, years*tradingDaysPerYear)
+	for i := range returns {
+		returns[i] = (mu-sigma*sigma/2)*dt + sigma*math.Sqrt(dt)*rng.NormFloat64()
+	}
+
+	got := fitGBM(returns)
+	// The drift is only known to sigma/√years, the volatility much better.
+	if tol := 3 * sigma / math.Sqrt(years); math.Abs(got.Mu-mu) > tol {
+		t.Errorf("Mu = %v, want %v ± %v", got.Mu, mu, tol)
+	}
+	if math.Abs(got.Sigma-sigma) > 0.01 {
+		t.Errorf("Sigma = %v, want %v ± 0.01", got.Sigma, sigma)
+	}
+	if got.MuCI95[0] > mu || got.MuCI95[1] < mu {
+		t.Errorf("MuCI95 = %v, want it to contain %v", got.MuCI95, mu)
+	}
+	if got.SigmaCI95[0] > sigma || got.SigmaCI95[1] < sigma {
+		t.Errorf("SigmaCI95 = %v, want it to contain %v", got.SigmaCI95, sigma)
+	}
+	if got.RSquared < 0.99 {
+		t.Errorf("RSquared = %v, want close to 1 for normal returns", got.RSquared)
+	}
+	if got.Observations != len(returns) {
+		t.Errorf("Observations = %d, want %d", got.Observations, len(returns))
+	}
+
+	if got := fitGBM(returns[:1]); got != (GBMParams{Observations: 1}) {
+		t.Errorf("fitGBM(single return) = %+v, want zero parameters", got)
+	}
+}
+
+func TestModelHandler(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101, 99, 103, 104))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 9, 14, 15, 16))
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/QUARTZ9/model", http.StatusOK},
+		{"/quartz5/model?from=2019-01-03", http.StatusOK},
+		{"/QUARTZ9/model?from=soon", http.StatusBadRequest},
+		{"/QUARTZ1/model", http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", tc.target, nil))
+		if rr.Code != tc.want {
+			t.Errorf("GET %s: Code = %d, want %d", tc.target, rr.Code, tc.want)
+			continue
+		}
+		if rr.Code != http.StatusOK {
+			continue
+		}
+		var got GBMParams
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatalf("GET %s: json.Unmarshal: %v", tc.target, err)
+		}
+		if got.Observations == 0 || got.Sigma <= 0 {
+			t.Errorf("GET %s: %+v, want a fitted model", tc.target, got)
+		}
+	}
+}
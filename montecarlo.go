@@ -0,0 +1,143 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultSimulations and maxSimulations bound ?simulations.
+	defaultSimulations = 1000
+	maxSimulations     = 10000
+	// defaultHorizon and maxHorizon bound ?horizon, in trading days.
+	defaultHorizon = tradingDaysPerYear
+	maxHorizon     = 5 * tradingDaysPerYear
+)
+
+// MonteCarloResult holds the 10th, 50th and 90th percentile of the simulated
+// index value on each of the next days.
+type MonteCarloResult struct {
+	P10 []float64 `json:"p10"`
+	P50 []float64 `json:"p50"`
+	P90 []float64 `json:"p90"`
+}
+
+// runMonteCarlo simulates simulations paths of a geometric Brownian motion
+// with annualised drift mu and volatility sigma starting at startVal, and
+// returns the percentiles of the paths on each of the next horizon trading
+// days.
+func runMonteCarlo(mu, sigma, startVal float64, horizon, simulations int, rng *rand.Rand) MonteCarloResult {
+	result := MonteCarloResult{
+		P10: make([]float64, 0, horizon),
+		P50: make([]float64, 0, horizon),
+		P90: make([]float64, 0, horizon),
+	}
+	if simulations < 1 {
+		return result
+	}
+	dt := 1.0 / tradingDaysPerYear
+	drift, diffusion := (mu-sigma*sigma/2)*dt, sigma*math.Sqrt(dt)
+	paths := make([]float64, simulations)
+	for i := range paths {
+		paths[i] = startVal
+	}
+	sorted := make([]float64, simulations)
+	for range horizon {
+		for i := range paths {
+			paths[i] *= math.Exp(drift + diffusion*rng.NormFloat64())
+		}
+		copy(sorted, paths)
+		slices.Sort(sorted)
+		result.P10 = append(result.P10, sorted[percentileIndex(simulations, 0.1)])
+		result.P50 = append(result.P50, sorted[percentileIndex(simulations, 0.5)])
+		result.P90 = append(result.P90, sorted[percentileIndex(simulations, 0.9)])
+	}
+	return result
+}
+
+// positiveIntParam reads an optional positive integer query parameter,
+// capped at limit.
+func positiveIntParam(r *http.Request, name string, fallback, limit int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid '%s' value '%s', expected a positive integer", name, v)
+	}
+	return min(n, limit), nil
+}
+
+// MonteCarloHandler projects the index of a fund with the geometric Brownian
+// motion fitted to its history, e.g.
+// /QUARTZ9/montecarlo?simulations=1000&horizon=252&seed=42. Simulations are
+// capped at maxSimulations and the horizon at maxHorizon days.
+func (a *App) MonteCarloHandler(w http.ResponseWriter, r *http.Request) {
+	symbol := strings.ToUpper(mux.Vars(r)["symbol"])
+	fund, ok := lookupFund(symbol)
+	if !ok {
+		http.Error(w, "Invalid symbol", http.StatusBadRequest)
+		return
+	}
+	simulations, err := positiveIntParam(r, "simulations", defaultSimulations, maxSimulations)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	horizon, err := positiveIntParam(r, "horizon", defaultHorizon, maxHorizon)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	seed := rand.Uint64()
+	if v := r.URL.Query().Get("seed"); v != "" {
+		if seed, err = strconv.ParseUint(v, 10, 64); err != nil {
+			http.Error(w, fmt.Sprintf("invalid 'seed' value '%s', expected a non-negative integer", v), http.StatusBadRequest)
+			return
+		}
+	}
+	from, err := optionalDateParam(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	series, err := a.computeIndexSeries(r.Context(), fund, from, indexOptions{})
+	if err != nil {
+		http.Error(w, "Error computing index series", http.StatusInternalServerError)
+		return
+	}
+	if len(series) < 3 {
+		http.Error(w, "Not enough history to fit the model", http.StatusBadRequest)
+		return
+	}
+	params := fitGBM(dailyLogReturns(series))
+	rng := rand.New(rand.NewPCG(seed, 0))
+	result := runMonteCarlo(params.Mu, params.Sigma, series[len(series)-1].AdjClose, horizon, simulations, rng)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
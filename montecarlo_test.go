@@ -0,0 +1,84 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRunMonteCarlo(t *testing.T) {
+	const mu, sigma = 0.1, 0.2
+	got := runMonteCarlo(mu, sigma, 100, tradingDaysPerYear, 5000, rand.New(rand.NewPCG(42, 0)))
+	if len(got.P10) != tradingDaysPerYear || len(got.P50) != tradingDaysPerYear || len(got.P90) != tradingDaysPerYear {
+		t.Fatalf("lengths = %d, %d, %d, want %d", len(got.P10), len(got.P50), len(got.P90), tradingDaysPerYear)
+	}
+	for i := range got.P50 {
+		if got.P10[i] > got.P50[i] || got.P50[i] > got.P90[i] {
+			t.Fatalf("day %d: p10 %v, p50 %v, p90 %v, want increasing", i, got.P10[i], got.P50[i], got.P90[i])
+		}
+	}
+	// After a year the median of a GBM is S0 * exp(mu - sigma²/2).
+	last := len(got.P50) - 1
+	if want := 100 * math.Exp(mu-sigma*sigma/2); math.Abs(got.P50[last]-want) > 1.5 {
+		t.Errorf("median after a year = %v, want about %v", got.P50[last], want)
+	}
+
+	again := runMonteCarlo(mu, sigma, 100, tradingDaysPerYear, 5000, rand.New(rand.NewPCG(42, 0)))
+	if !reflect.DeepEqual(got, again) {
+		t.Error("runMonteCarlo is not reproducible with the same seed")
+	}
+}
+
+func TestMonteCarloHandler(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101, 99, 103, 104))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 9, 14, 15, 16))
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ9/montecarlo?"+query, nil))
+		return rr
+	}
+
+	rr := get("simulations=200&horizon=20&seed=42")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got MonteCarloResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(got.P50) != 20 {
+		t.Errorf("len(p50) = %d, want 20", len(got.P50))
+	}
+	if again := get("simulations=200&horizon=20&seed=42"); again.Body.String() != rr.Body.String() {
+		t.Error("same seed returned a different projection")
+	}
+	if rr := get("simulations=1000000&horizon=2"); rr.Code != http.StatusOK {
+		t.Errorf("simulations above the cap: Code = %d, want %d", rr.Code, http.StatusOK)
+	}
+
+	for _, query := range []string{"simulations=0", "simulations=many", "horizon=-1", "seed=-1", "from=2019-01-08"} {
+		if rr := get(query); rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: Code = %d, want %d", query, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"regexp"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+// pathVariablePattern matches the variables of a route path template, e.g.
+// {symbol} or {id:[0-9]+}.
+var pathVariablePattern = regexp.MustCompile(`\{([^}:]+)(?::[^}]*)?\}`)
+
+// openAPISchema returns the schema of a RouteParam type.
+func openAPISchema(paramType string) *openapi3.Schema {
+	switch paramType {
+	case "boolean":
+		return openapi3.NewBoolSchema()
+	case "integer":
+		return openapi3.NewIntegerSchema()
+	case "number":
+		return openapi3.NewFloat64Schema()
+	case "date":
+		return openapi3.NewStringSchema().WithFormat("date")
+	default:
+		return openapi3.NewStringSchema()
+	}
+}
+
+// openAPISpec builds an OpenAPI 3.0 document describing the routes of router
+// with the parameters documented in reg.
+func openAPISpec(router *mux.Router, reg EndpointRegistry) (*openapi3.T, error) {
+	manifest, err := routeManifest(router, reg)
+	if err != nil {
+		return nil, err
+	}
+	doc := &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info:    &openapi3.Info{Title: "Fund index service", Version: "1.0.0"},
+		Paths:   openapi3.NewPaths(),
+	}
+	for _, e := range manifest {
+		operation := openapi3.NewOperation()
+		operation.Summary = e.Description
+		for _, match := range pathVariablePattern.FindAllStringSubmatch(e.Path, -1) {
+			operation.AddParameter(openapi3.NewPathParameter(match[1]).WithSchema(openapi3.NewStringSchema()))
+		}
+		for _, p := range e.Params {
+			operation.AddParameter(openapi3.NewQueryParameter(p.Name).WithRequired(p.Required).WithSchema(openAPISchema(p.Type)))
+		}
+		operation.Responses = openapi3.NewResponses(openapi3.WithStatus(http.StatusOK,
+			&openapi3.ResponseRef{Value: openapi3.NewResponse().WithDescription("OK")}))
+		// OpenAPI path templates do not allow mux regular expressions.
+		path := pathVariablePattern.ReplaceAllString(e.Path, "{$1}")
+		doc.AddOperation(path, e.Method, operation)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// exportOpenAPI writes the OpenAPI document of the service to w as YAML.
+func exportOpenAPI(w io.Writer) error {
+	doc, err := openAPISpec((&App{}).newRouter(), endpoints)
+	if err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
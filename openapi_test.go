@@ -0,0 +1,52 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+func TestExportOpenAPI(t *testing.T) {
+	var buf bytes.Buffer
+	if err := exportOpenAPI(&buf); err != nil {
+		t.Fatalf("exportOpenAPI: %v", err)
+	}
+	doc, err := openapi3.NewLoader().LoadFromData(buf.Bytes())
+	if err != nil {
+		t.Fatalf("LoadFromData: %v", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	index := doc.Paths.Find("/{symbol}")
+	if index == nil || index.Get == nil {
+		t.Fatal("spec has no GET /{symbol}")
+	}
+	if index.Get.Summary != "Returns blended fund index" {
+		t.Errorf("summary = %q", index.Get.Summary)
+	}
+	if p := index.Get.Parameters.GetByInAndName("query", "base_date"); p == nil || p.Schema.Value.Format != "date" {
+		t.Errorf("base_date parameter = %+v, want a date", p)
+	}
+	reconcile := doc.Paths.Find("/admin/reconcile/{ticker}")
+	if reconcile == nil || reconcile.Get.Parameters.GetByInAndName("path", "ticker") == nil {
+		t.Error("spec has no ticker path parameter for /admin/reconcile/{ticker}")
+	}
+}
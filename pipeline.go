@@ -0,0 +1,75 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Transform derives a new index series from series. It must not modify
+// series.
+type Transform func(series []IndexData) []IndexData
+
+// Pipeline is a list of transforms applied in order.
+type Pipeline []Transform
+
+// Apply returns series transformed by every transform of the pipeline.
+func (p Pipeline) Apply(series []IndexData) []IndexData {
+	for _, transform := range p {
+		series = transform(series)
+	}
+	return series
+}
+
+// namedTransforms are the transforms that can be chained with ?transforms.
+var namedTransforms = map[string]Transform{
+	"smooth":     func(series []IndexData) []IndexData { return applyEMA(series, defaultSmoothingAlpha) },
+	"drawdown":   computeDrawdown,
+	"volatility": func(series []IndexData) []IndexData { return computeVolatility30D(series, false) },
+	"runup":      computeRunup,
+	"zscore":     computeExpandingZScore,
+}
+
+// parseTransforms parses ?transforms, a comma separated list of
+// namedTransforms, into a pipeline applying them in the order given.
+func parseTransforms(r *http.Request) (Pipeline, error) {
+	v := r.URL.Query().Get("transforms")
+	if v == "" {
+		return nil, nil
+	}
+	var pipeline Pipeline
+	for _, name := range strings.Split(v, ",") {
+		transform, ok := namedTransforms[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("invalid 'transforms' value '%s', supported values: %s", name, strings.Join(slices.Sorted(maps.Keys(namedTransforms)), ", "))
+		}
+		pipeline = append(pipeline, transform)
+	}
+	return pipeline, nil
+}
+
+// annotateConfidence sets the fillConfidence of every point.
+func annotateConfidence(series []IndexData) []IndexData {
+	annotated := make([]IndexData, len(series))
+	for i, data := range series {
+		data.Confidence = fillConfidence(data.FillStreak)
+		annotated[i] = data
+	}
+	return annotated
+}
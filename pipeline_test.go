@@ -0,0 +1,101 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPipelineApply(t *testing.T) {
+	double := func(series []IndexData) []IndexData {
+		out := make([]IndexData, len(series))
+		for i, data := range series {
+			data.AdjClose *= 2
+			out[i] = data
+		}
+		return out
+	}
+	series := indexSeries("2021-01-01", 100, 50)
+
+	// The drawdown is computed after doubling, so it is unchanged.
+	got := Pipeline{double, computeDrawdown}.Apply(series)
+	if got[1].AdjClose != 100 || !almostEqual(got[1].DrawdownPct, -50) {
+		t.Errorf("Apply = %+v, want 100 at -50%%", got[1])
+	}
+	if got := Pipeline(nil).Apply(series); len(got) != 2 || got[1].AdjClose != 50 {
+		t.Errorf("empty pipeline: %+v, want the series unchanged", got)
+	}
+}
+
+func TestParseTransforms(t *testing.T) {
+	for _, v := range []string{"smooth,drawdown,volatility", "zscore, runup"} {
+		p, err := parseTransforms(httptest.NewRequest("GET", "/QUARTZ9?transforms="+strings.ReplaceAll(v, " ", "%20"), nil))
+		if err != nil || len(p) != len(strings.Split(v, ",")) {
+			t.Errorf("parseTransforms(%q) = %d transforms, %v", v, len(p), err)
+		}
+	}
+	for _, v := range []string{"sma", "smooth,,drawdown"} {
+		if _, err := parseTransforms(httptest.NewRequest("GET", "/QUARTZ9?transforms="+v, nil)); err == nil {
+			t.Errorf("parseTransforms(%q) succeeded, want an error", v)
+		}
+	}
+}
+
+func TestHandlerTransforms(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 90, 95, 110, 100))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 9, 9.5, 9.5, 9.5, 11, 10))
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/QUARTZ9?transforms=drawdown,volatility", http.StatusOK},
+		{"/QUARTZ9?transforms=sma", http.StatusBadRequest},
+		{"/QUARTZ9?transforms=drawdown&group_by=year", http.StatusBadRequest},
+		{"/QUARTZ9?transforms=drawdown&format=csv", http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", tc.target, nil))
+		if rr.Code != tc.want {
+			t.Errorf("GET %s: Code = %d, want %d: %s", tc.target, rr.Code, tc.want, rr.Body)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ9?transforms=drawdown", nil))
+	var got []IndexData
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	want := computeDrawdown(got)
+	drawdowns := 0
+	for i := range got {
+		if !almostEqual(got[i].DrawdownPct, want[i].DrawdownPct) {
+			t.Errorf("%s: drawdown_pct = %v, want %v", got[i].Date, got[i].DrawdownPct, want[i].DrawdownPct)
+		}
+		if got[i].DrawdownPct < 0 {
+			drawdowns++
+		}
+	}
+	if drawdowns == 0 {
+		t.Error("no drawdown_pct in the response, want the declines annotated")
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// defaultPrewarmTime is the UTC time of day the cache is warmed at unless
+// PREWARM_TIME is set.
+const defaultPrewarmTime = "00:05"
+
+// prewarmConcurrency caps the EOD API calls made while warming the cache.
+const prewarmConcurrency = 2
+
+// parsePrewarmTime parses a UTC time of day in the HH:MM format into the
+// time elapsed since midnight.
+func parsePrewarmTime(v string) (time.Duration, error) {
+	t, err := time.Parse("15:04", v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid PREWARM_TIME %q, expected HH:MM", v)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// nextPrewarm returns the first time after now that is at the given time of
+// day in UTC.
+func nextPrewarm(now time.Time, at time.Duration) time.Time {
+	now = now.UTC()
+	next := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).Add(at)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// prewarmCache reads today's data of every symbol into the cache and the
+// memory cache, fetching it from the EOD API when it is missing, and returns
+// the number of symbols that are now cached. Today's data is read directly,
+// as stale-while-revalidate would serve the previous day's data instead.
+func (a *App) prewarmCache(ctx context.Context, symbols []string) int {
+	today := time.Now().UTC().Format(time.DateOnly)
+	sem := make(chan struct{}, prewarmConcurrency)
+	var refreshed atomic.Int32
+	var wg sync.WaitGroup
+	for _, symbol := range symbols {
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+			wg.Add(1)
+			go func() {
+				defer func() { <-sem; wg.Done() }()
+				_, err, _ := a.fetches.Do(symbol, func() (any, error) {
+					return a.loadSymbolData(ctx, symbol, componentHistoryStart, today)
+				})
+				if err != nil {
+					a.log.Log(logging.Entry{
+						Severity: logging.Warning,
+						Payload:  fmt.Sprintf("cache prewarm of %s: %v", symbol, err),
+					})
+					return
+				}
+				refreshed.Add(1)
+			}()
+		}
+	}
+	wg.Wait()
+	return int(refreshed.Load())
+}
+
+// runCachePrewarm warms the cache with the data of every fund component at
+// startup and then every day at the given time of day, until ctx is done.
+func (a *App) runCachePrewarm(ctx context.Context, at time.Duration) {
+	for {
+		refreshed := a.prewarmCache(ctx, fundComponents)
+		a.log.Log(logging.Entry{
+			Severity: logging.Info,
+			Payload:  fmt.Sprintf("cache prewarm refreshed %d of %d symbols", refreshed, len(fundComponents)),
+		})
+
+		timer := time.NewTimer(time.Until(nextPrewarm(time.Now(), at)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
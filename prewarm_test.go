@@ -0,0 +1,89 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPrewarmSchedule(t *testing.T) {
+	at, err := parsePrewarmTime(defaultPrewarmTime)
+	if err != nil || at != 5*time.Minute {
+		t.Fatalf("parsePrewarmTime(%q) = %s, %v, want 5m", defaultPrewarmTime, at, err)
+	}
+	if _, err := parsePrewarmTime("25:00"); err == nil {
+		t.Error("parsePrewarmTime(25:00) succeeded, want an error")
+	}
+
+	tests := []struct {
+		now, want string
+	}{
+		{"2024-03-01T00:00:00Z", "2024-03-01T00:05:00Z"},
+		{"2024-03-01T00:05:00Z", "2024-03-02T00:05:00Z"},
+		{"2024-03-01T23:59:00Z", "2024-03-02T00:05:00Z"},
+		{"2024-03-01T01:00:00+02:00", "2024-03-01T00:05:00Z"},
+	}
+	for _, tt := range tests {
+		now, _ := time.Parse(time.RFC3339, tt.now)
+		want, _ := time.Parse(time.RFC3339, tt.want)
+		if got := nextPrewarm(now, at); !got.Equal(want) {
+			t.Errorf("nextPrewarm(%s) = %s, want %s", tt.now, got, want)
+		}
+	}
+}
+
+func TestPrewarmCache(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		json.NewEncoder(w).Encode(fixtureSeries("2019-01-02", true, 100, 101))
+	}))
+	t.Cleanup(srv.Close)
+
+	app := newTestApp(t)
+	app.eodBaseURL = srv.URL
+	app.memCache = newMemoryCache(1<<20, 0)
+	symbols := []string{"VOO.US", "BTC-USD.CC", "ETH-USD.CC", "BND.US"}
+
+	if got := app.prewarmCache(context.Background(), symbols); got != len(symbols) {
+		t.Errorf("prewarmCache = %d, want %d", got, len(symbols))
+	}
+	if got := maxInFlight.Load(); got > prewarmConcurrency {
+		t.Errorf("%d concurrent EOD API calls, want at most %d", got, prewarmConcurrency)
+	}
+	today := time.Now().UTC().Format(time.DateOnly)
+	for _, symbol := range symbols {
+		if _, err := app.cache().Read(symbol, today); err != nil {
+			t.Errorf("%s is not cached: %v", symbol, err)
+		}
+		if _, ok := app.memCache.Get(cacheObjectName(symbol, today)); !ok {
+			t.Errorf("%s is not in the memory cache", symbol)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// promMetrics holds the Prometheus metrics of the service. A nil value is
+// valid and records nothing.
+type promMetrics struct {
+	registry      *prometheus.Registry
+	requests      *prometheus.CounterVec
+	cacheHits     *prometheus.CounterVec
+	cacheMisses   *prometheus.CounterVec
+	eodCalls      *prometheus.CounterVec
+	indexDuration *prometheus.HistogramVec
+}
+
+// newPromMetrics registers the service metrics on a new registry.
+func newPromMetrics() *promMetrics {
+	m := &promMetrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "fund_http_requests_total",
+			Help: "HTTP requests served, by fund symbol and status code.",
+		}, []string{"symbol", "status_code"}),
+		cacheHits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "fund_cache_hits_total",
+			Help: "Price series served from the memory or file cache.",
+		}, []string{"symbol"}),
+		cacheMisses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "fund_cache_misses_total",
+			Help: "Price series that had to be fetched from the EOD API.",
+		}, []string{"symbol"}),
+		eodCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "fund_eod_api_calls_total",
+			Help: "Calls to the EOD API, by result.",
+		}, []string{"symbol", "result"}),
+		indexDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "fund_index_calculation_duration_seconds",
+			Help:    "Time taken to compute the fund index.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"symbol"}),
+	}
+	m.registry.MustRegister(m.requests, m.cacheHits, m.cacheMisses, m.eodCalls, m.indexDuration)
+	return m
+}
+
+// requestSymbol returns the fund symbol of the route that served r. Other
+// path values are reported as "other" to keep the number of series bounded.
+func requestSymbol(r *http.Request) string {
+	symbol, ok := mux.Vars(r)["symbol"]
+	if !ok {
+		return ""
+	}
+	if _, ok := lookupFund(symbol); !ok {
+		return "other"
+	}
+	return symbol
+}
+
+// cacheResult counts a price series served from the cache, or fetched when
+// hit is false.
+func (m *promMetrics) cacheResult(symbol string, hit bool) {
+	if m == nil {
+		return
+	}
+	if hit {
+		m.cacheHits.WithLabelValues(symbol).Inc()
+	} else {
+		m.cacheMisses.WithLabelValues(symbol).Inc()
+	}
+}
+
+// eodCall counts a call to the EOD API that failed with err, if not nil.
+func (m *promMetrics) eodCall(symbol string, err error) {
+	if m == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.eodCalls.WithLabelValues(symbol, result).Inc()
+}
+
+// observeIndexDuration records the time taken to compute the index of symbol
+// since start.
+func (m *promMetrics) observeIndexDuration(symbol string, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.indexDuration.WithLabelValues(symbol).Observe(time.Since(start).Seconds())
+}
+
+// statusRecorder remembers the status code written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// instrument counts every request by fund symbol and status code.
+func (m *promMetrics) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		m.requests.WithLabelValues(requestSymbol(r), strconv.Itoa(rec.status)).Inc()
+	})
+}
+
+// handler serves the metrics in the Prometheus text format.
+func (m *promMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,66 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := json.Marshal(fixtureSeries("2019-01-02", false, 100, 101, 102))
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	app := newTestApp(t)
+	app.eodBaseURL = srv.URL
+	app.promMetrics = newPromMetrics()
+	router := app.newRouter()
+
+	for _, path := range []string{"/QUARTZ9", "/QUARTZ9", "/UNKNOWN"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d", rr.Code, http.StatusOK)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{
+		`fund_http_requests_total{status_code="200",symbol="QUARTZ9"} 2`,
+		`fund_http_requests_total{status_code="400",symbol="other"} 1`,
+		// The first request fetches both components, the second reads the
+		// files written by the first.
+		`fund_cache_misses_total{symbol="VOO.US"} 1`,
+		`fund_cache_hits_total{symbol="VOO.US"} 1`,
+		`fund_eod_api_calls_total{result="success",symbol="BTC-USD.CC"} 1`,
+		`fund_index_calculation_duration_seconds_count{symbol="QUARTZ9"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestNilPromMetrics(t *testing.T) {
+	var m *promMetrics
+	m.cacheResult("VOO.US", true)
+	m.eodCall("VOO.US", nil)
+}
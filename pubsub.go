@@ -0,0 +1,79 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"cloud.google.com/go/pubsub"
+)
+
+// WrittenToCacheEvent is published whenever fresh upstream data has been
+// written to the cache.
+type WrittenToCacheEvent struct {
+	Ticker    string `json:"ticker"`
+	Date      string `json:"date"`
+	FilePath  string `json:"file_path"`
+	SizeBytes int    `json:"size_bytes"`
+}
+
+// CacheEventPublisher notifies other services about cache updates.
+type CacheEventPublisher interface {
+	PublishCacheWrite(ctx context.Context, event WrittenToCacheEvent) error
+}
+
+// pubSubPublisher publishes cache events to a Cloud Pub/Sub topic.
+type pubSubPublisher struct {
+	topic *pubsub.Topic
+}
+
+func newPubSubPublisher(ctx context.Context, projectID, topicID string) (*pubSubPublisher, error) {
+	client, err := pubsub.NewClient(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return &pubSubPublisher{topic: client.Topic(topicID)}, nil
+}
+
+// PublishCacheWrite publishes the event and waits for the server to
+// acknowledge it.
+func (p *pubSubPublisher) PublishCacheWrite(ctx context.Context, event WrittenToCacheEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = p.topic.Publish(ctx, &pubsub.Message{Data: data}).Get(ctx)
+	return err
+}
+
+// publishCacheWrite sends the event when a publisher is configured. Failures
+// are logged but never fail the request that refreshed the cache.
+func (a *App) publishCacheWrite(ctx context.Context, event WrittenToCacheEvent) {
+	if a.cachePublisher == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if err := a.cachePublisher.PublishCacheWrite(ctx, event); err != nil {
+		a.logRequest(ctx, logging.Entry{
+			Severity: logging.Warning,
+			Payload:  fmt.Sprintf("unable to publish cache update for %s: %v", event.Ticker, err),
+		})
+	}
+}
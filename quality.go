@@ -0,0 +1,110 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"cloud.google.com/go/logging"
+	"github.com/gorilla/mux"
+)
+
+// survivorshipBiasThresholdDays is how long after the fund inception a
+// component may start before the fund is flagged for survivorship bias.
+// Inception dates falling on a weekend or holiday are well within it.
+const survivorshipBiasThresholdDays = 30
+
+// ComponentData is the price series of one component of a fund.
+type ComponentData struct {
+	Ticker string
+	Data   []StockData
+}
+
+// BiasWarning flags a component that may bias the fund history.
+type BiasWarning struct {
+	Ticker             string `json:"ticker"`
+	FirstDate          string `json:"first_date"`
+	InceptionDate      string `json:"inception_date"`
+	DaysAfterInception int    `json:"days_after_inception"`
+	Message            string `json:"message"`
+}
+
+// QualityReport describes data quality issues of a fund.
+type QualityReport struct {
+	Symbol       string        `json:"symbol"`
+	BiasWarnings []BiasWarning `json:"bias_warnings"`
+}
+
+// detectSurvivorshipBias flags the components whose first price is more than
+// survivorshipBiasThresholdDays after the fund inception. Such a component was
+// only added to the history because it is known to have survived, so the
+// backfilled index overstates what an investor could have known.
+func detectSurvivorshipBias(components []ComponentData, inceptionDate string) []BiasWarning {
+	warnings := []BiasWarning{}
+	for _, component := range components {
+		if len(component.Data) == 0 {
+			continue
+		}
+		first := component.Data[0].Date
+		days, err := daysBetween(inceptionDate, first)
+		if err != nil || days <= survivorshipBiasThresholdDays {
+			continue
+		}
+		warnings = append(warnings, BiasWarning{
+			Ticker:             component.Ticker,
+			FirstDate:          first,
+			InceptionDate:      inceptionDate,
+			DaysAfterInception: days,
+			Message: fmt.Sprintf("%s has no data until %s, %d days after the fund inception on %s",
+				component.Ticker, first, days, inceptionDate),
+		})
+	}
+	return warnings
+}
+
+// QualityHandler reports data quality issues of a fund, e.g. /quality/QUARTZ9.
+func (a *App) QualityHandler(w http.ResponseWriter, r *http.Request) {
+	symbol := strings.ToUpper(mux.Vars(r)["symbol"])
+	fund, ok := lookupFund(symbol)
+	if !ok {
+		http.Error(w, "Invalid symbol", http.StatusBadRequest)
+		return
+	}
+
+	symbols := fund.Symbols()
+	data, tickerErrors := a.FetchSymbolsConcurrently(r.Context(), symbols, fundInceptionDate, "")
+	if len(tickerErrors) > 0 {
+		http.Error(w, (&componentError{Errors: tickerErrors}).Error(), http.StatusInternalServerError)
+		return
+	}
+	components := make([]ComponentData, 0, len(symbols))
+	for _, ticker := range symbols {
+		components = append(components, ComponentData{Ticker: ticker, Data: data[ticker]})
+	}
+
+	report := QualityReport{Symbol: symbol, BiasWarnings: detectSurvivorshipBias(components, fundInceptionDate)}
+	for _, warning := range report.BiasWarnings {
+		a.logRequest(r.Context(), logging.Entry{
+			Severity: logging.Info,
+			Payload:  fmt.Sprintf("survivorship bias in %s: %s", symbol, warning.Message),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
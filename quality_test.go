@@ -0,0 +1,58 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDetectSurvivorshipBias(t *testing.T) {
+	components := []ComponentData{
+		{Ticker: "VOO.US", Data: fixtureSeries("2019-01-02", true, 100)},
+		{Ticker: "LATE.US", Data: fixtureSeries("2019-03-01", true, 10)},
+		// Starting within the threshold, e.g. after a holiday, is fine.
+		{Ticker: "SOON.US", Data: fixtureSeries("2019-01-31", true, 10)},
+		{Ticker: "EMPTY.US"},
+	}
+	got := detectSurvivorshipBias(components, "2019-01-02")
+	if len(got) != 1 {
+		t.Fatalf("warnings = %+v, want only LATE.US", got)
+	}
+	if got[0].Ticker != "LATE.US" || got[0].FirstDate != "2019-03-01" || got[0].DaysAfterInception != 58 {
+		t.Errorf("warning = %+v, want LATE.US 58 days after inception", got[0])
+	}
+}
+
+func TestQualityHandler(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-06-01", false, 10, 11))
+
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/quality/QUARTZ9", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got QualityReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(got.BiasWarnings) != 1 || got.BiasWarnings[0].Ticker != "BTC-USD.CC" {
+		t.Errorf("report = %+v, want a BTC-USD.CC warning", got)
+	}
+}
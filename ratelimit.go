@@ -0,0 +1,251 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/time/rate"
+)
+
+// rateLimitWindow is the fixed window over which requests are counted.
+const rateLimitWindow = time.Minute
+
+// RateLimiter decides whether a client may make another request in the
+// current window.
+type RateLimiter interface {
+	// Allow counts a request for key and reports whether it is within the
+	// limit. retryAfter is the time until the window resets.
+	Allow(ctx context.Context, key string) (ok bool, retryAfter time.Duration, err error)
+}
+
+// windowStart returns the start of the rate limit window containing t.
+func windowStart(t time.Time) time.Time {
+	return t.Truncate(rateLimitWindow)
+}
+
+// memoryRateLimiter counts requests per key in memory. Each instance keeps
+// its own counts, so the limit applies per instance.
+type memoryRateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Time
+	counts map[string]int
+	now    func() time.Time
+}
+
+// newMemoryRateLimiter allows limit requests per key and window.
+func newMemoryRateLimiter(limit int) *memoryRateLimiter {
+	return &memoryRateLimiter{limit: limit, counts: make(map[string]int), now: time.Now}
+}
+
+// Allow implements RateLimiter.
+func (m *memoryRateLimiter) Allow(_ context.Context, key string) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if start := windowStart(now); !start.Equal(m.window) {
+		// Counts from earlier windows are no longer needed.
+		m.window = start
+		clear(m.counts)
+	}
+	m.counts[key]++
+	return m.counts[key] <= m.limit, m.window.Add(rateLimitWindow).Sub(now), nil
+}
+
+// redisRateLimiter counts requests per key in Redis so that the limit is
+// shared by every instance. When Redis cannot be reached it falls back to
+// counting in memory.
+type redisRateLimiter struct {
+	client   *redis.Client
+	limit    int
+	fallback RateLimiter
+	now      func() time.Time
+}
+
+// newRedisRateLimiter connects to the Redis server at redisURL, e.g.
+// redis://host:6379/0, and allows limit requests per key and window.
+func newRedisRateLimiter(redisURL string, limit int) (*redisRateLimiter, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	return &redisRateLimiter{
+		client:   redis.NewClient(opts),
+		limit:    limit,
+		fallback: newMemoryRateLimiter(limit),
+		now:      time.Now,
+	}, nil
+}
+
+// Allow implements RateLimiter.
+func (l *redisRateLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	now := l.now()
+	start := windowStart(now)
+	redisKey := fmt.Sprintf("ratelimit:%s:%d", key, start.Unix())
+
+	pipe := l.client.TxPipeline()
+	count := pipe.Incr(ctx, redisKey)
+	pipe.ExpireNX(ctx, redisKey, rateLimitWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		ok, retryAfter, _ := l.fallback.Allow(ctx, key)
+		return ok, retryAfter, fmt.Errorf("redis unavailable, limited in memory: %w", err)
+	}
+	return count.Val() <= int64(l.limit), start.Add(rateLimitWindow).Sub(now), nil
+}
+
+// tokenBucketIdleTimeout is how long the token bucket of a client is kept
+// after its last request. A full bucket is recreated identically, so only
+// buckets that have had time to refill are dropped.
+const tokenBucketIdleTimeout = 10 * time.Minute
+
+// tokenBucketRateLimiter gives every key a token bucket refilled at rps
+// tokens per second and holding at most burst tokens. Unlike the fixed
+// window limiters it smooths out bursts at window boundaries. Each instance
+// keeps its own buckets.
+type tokenBucketRateLimiter struct {
+	rps     rate.Limit
+	burst   int
+	buckets sync.Map // key -> *tokenBucket
+	now     func() time.Time
+}
+
+type tokenBucket struct {
+	limiter  *rate.Limiter
+	lastSeen atomic.Int64 // Unix nanoseconds
+}
+
+// newTokenBucketRateLimiter allows rps requests per second and key on
+// average, and bursts of up to burst requests.
+func newTokenBucketRateLimiter(rps float64, burst int) *tokenBucketRateLimiter {
+	return &tokenBucketRateLimiter{rps: rate.Limit(rps), burst: burst, now: time.Now}
+}
+
+// Allow implements RateLimiter.
+func (l *tokenBucketRateLimiter) Allow(_ context.Context, key string) (bool, time.Duration, error) {
+	now := l.now()
+	v, ok := l.buckets.Load(key)
+	if !ok {
+		v, _ = l.buckets.LoadOrStore(key, &tokenBucket{limiter: rate.NewLimiter(l.rps, l.burst)})
+	}
+	bucket := v.(*tokenBucket)
+	bucket.lastSeen.Store(now.UnixNano())
+
+	reservation := bucket.limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return false, rateLimitWindow, nil
+	}
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay, nil
+	}
+	return true, 0, nil
+}
+
+// removeIdle drops the buckets of the keys without a request since before.
+func (l *tokenBucketRateLimiter) removeIdle(before time.Time) {
+	l.buckets.Range(func(key, v any) bool {
+		if v.(*tokenBucket).lastSeen.Load() < before.UnixNano() {
+			l.buckets.Delete(key)
+		}
+		return true
+	})
+}
+
+// runCleanup drops idle buckets every interval until ctx is done.
+func (l *tokenBucketRateLimiter) runCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		l.removeIdle(l.now().Add(-tokenBucketIdleTimeout))
+	}
+}
+
+// parseRateLimitAPIKeys splits the comma separated RATE_LIMIT_API_KEYS value
+// into a set, ignoring empty entries.
+func parseRateLimitAPIKeys(v string) map[string]bool {
+	keys := make(map[string]bool)
+	for _, key := range strings.Split(v, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// rateLimitKey identifies the client of r by its X-API-Key header when it is
+// one of the configured keys, or by its IP address otherwise. Unknown keys
+// are ignored, as clients could otherwise send a new key on every request.
+func (a *App) rateLimitKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" && a.rateLimitAPIKeys[key] {
+		return "key:" + key
+	}
+	return "ip:" + clientIP(r, a.trustedProxyHops)
+}
+
+// clientIP returns the address of the client that sent r. Every proxy
+// appends the address it received the request from to X-Forwarded-For, so
+// the entries before those of the proxies in front of the service are set by
+// the client and cannot be trusted. Cloud Run appends the client address
+// last; hops is the number of further trusted proxies, such as a load
+// balancer, that append an entry after it.
+func clientIP(r *http.Request, hops int) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		entries := strings.Split(forwarded, ",")
+		i := max(len(entries)-1-hops, 0)
+		return strings.TrimSpace(entries[i])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimit rejects requests over the limit of the client with 429 Too Many
+// Requests.
+func (a *App) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, retryAfter, err := a.rateLimiter.Allow(r.Context(), a.rateLimitKey(r))
+		if err != nil {
+			a.logRequest(r.Context(), logging.Entry{
+				Severity: logging.Warning,
+				Payload:  fmt.Sprintf("rate limiter: %v", err),
+			})
+		}
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
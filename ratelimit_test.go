@@ -0,0 +1,227 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestMemoryRateLimiter(t *testing.T) {
+	limiter := newMemoryRateLimiter(2)
+	now := time.Date(2024, 1, 15, 10, 0, 15, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i, want := range []bool{true, true, false} {
+		if ok, _, _ := limiter.Allow(ctx, "ip:1.2.3.4"); ok != want {
+			t.Errorf("request %d allowed = %v, want %v", i+1, ok, want)
+		}
+	}
+	if ok, _, _ := limiter.Allow(ctx, "ip:5.6.7.8"); !ok {
+		t.Error("another client was limited")
+	}
+	_, retryAfter, _ := limiter.Allow(ctx, "ip:1.2.3.4")
+	if retryAfter != 45*time.Second {
+		t.Errorf("retryAfter = %v, want 45s", retryAfter)
+	}
+
+	now = now.Add(time.Minute)
+	if ok, _, _ := limiter.Allow(ctx, "ip:1.2.3.4"); !ok {
+		t.Error("request in the next window was limited")
+	}
+}
+
+func TestRedisRateLimiter(t *testing.T) {
+	server := miniredis.RunT(t)
+	limiter, err := newRedisRateLimiter("redis://"+server.Addr(), 2)
+	if err != nil {
+		t.Fatalf("newRedisRateLimiter: %v", err)
+	}
+	// A second limiter stands in for another instance sharing the limit.
+	other, err := newRedisRateLimiter("redis://"+server.Addr(), 2)
+	if err != nil {
+		t.Fatalf("newRedisRateLimiter: %v", err)
+	}
+	ctx := context.Background()
+
+	for i, l := range []*redisRateLimiter{limiter, other} {
+		if ok, _, err := l.Allow(ctx, "key:abc"); !ok || err != nil {
+			t.Errorf("request %d = %v, %v, want allowed", i+1, ok, err)
+		}
+	}
+	if ok, _, err := limiter.Allow(ctx, "key:abc"); ok || err != nil {
+		t.Errorf("third request = %v, %v, want limited across instances", ok, err)
+	}
+	for _, key := range server.Keys() {
+		if ttl := server.TTL(key); ttl <= 0 || ttl > rateLimitWindow {
+			t.Errorf("TTL(%s) = %v, want at most %v", key, ttl, rateLimitWindow)
+		}
+	}
+}
+
+func TestRedisRateLimiterFallback(t *testing.T) {
+	server := miniredis.RunT(t)
+	limiter, err := newRedisRateLimiter("redis://"+server.Addr(), 1)
+	if err != nil {
+		t.Fatalf("newRedisRateLimiter: %v", err)
+	}
+	server.Close()
+	ctx := context.Background()
+
+	ok, _, err := limiter.Allow(ctx, "ip:1.2.3.4")
+	if !ok || err == nil {
+		t.Errorf("first request = %v, %v, want allowed in memory with an error", ok, err)
+	}
+	if ok, _, _ := limiter.Allow(ctx, "ip:1.2.3.4"); ok {
+		t.Error("second request was allowed, want the in-memory limit")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	app := newTestApp(t)
+	app.rateLimiter = newMemoryRateLimiter(1)
+	app.rateLimitAPIKeys = parseRateLimitAPIKeys(" abc, ,def")
+	router := app.newRouter()
+
+	get := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/routes", nil)
+		req.Header.Set(header, value)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	if rr := get("X-Forwarded-For", "10.0.0.1, 1.2.3.4"); rr.Code != http.StatusOK {
+		t.Fatalf("first request = %d, want 200", rr.Code)
+	}
+	// A spoofed first entry does not change the client.
+	rr := get("X-Forwarded-For", "10.0.0.2, 1.2.3.4")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request = %d, want 429", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("429 response has no Retry-After header")
+	}
+	if rr := get("X-API-Key", "abc"); rr.Code != http.StatusOK {
+		t.Errorf("request with an API key = %d, want 200", rr.Code)
+	}
+
+	// Unknown keys are limited by IP address, whatever the key.
+	if rr := get("X-API-Key", "random-1"); rr.Code != http.StatusOK {
+		t.Fatalf("first request with an unknown key = %d, want 200", rr.Code)
+	}
+	if rr := get("X-API-Key", "random-2"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("second request with another unknown key = %d, want 429", rr.Code)
+	}
+}
+
+func TestTokenBucketRateLimiter(t *testing.T) {
+	// 20 requests per second from one IP against 2 per second with bursts of 5.
+	limiter := newTokenBucketRateLimiter(2, 5)
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+	app := newTestApp(t)
+	app.rateLimiter = limiter
+	router := app.newRouter()
+
+	var codes []int
+	for range 20 {
+		req := httptest.NewRequest("GET", "/routes", nil)
+		req.Header.Set("X-Forwarded-For", "1.2.3.4")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		codes = append(codes, rr.Code)
+		if rr.Code == http.StatusTooManyRequests && rr.Header().Get("Retry-After") != "1" {
+			t.Errorf("Retry-After = %q, want 1", rr.Header().Get("Retry-After"))
+		}
+		now = now.Add(50 * time.Millisecond)
+	}
+	allowed := 0
+	for i, code := range codes {
+		if code == http.StatusOK {
+			allowed++
+		}
+		if i < 5 && code != http.StatusOK {
+			t.Errorf("request %d within the burst = %d, want 200", i+1, code)
+		}
+	}
+	if codes[5] != http.StatusTooManyRequests {
+		t.Errorf("request after the burst = %d, want 429", codes[5])
+	}
+	// The burst and one token refilled after 500ms.
+	if allowed != 6 {
+		t.Errorf("allowed %d of 20 requests, want 6", allowed)
+	}
+
+	ctx := context.Background()
+	if ok, _, _ := limiter.Allow(ctx, "ip:5.6.7.8"); !ok {
+		t.Error("another client was limited")
+	}
+	now = now.Add(tokenBucketIdleTimeout)
+	limiter.Allow(ctx, "ip:5.6.7.8")
+	limiter.removeIdle(now.Add(-time.Minute))
+	if _, ok := limiter.buckets.Load("ip:1.2.3.4"); ok {
+		t.Error("idle bucket was not removed")
+	}
+	if _, ok := limiter.buckets.Load("ip:5.6.7.8"); !ok {
+		t.Error("active bucket was removed")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	if got := clientIP(req, 0); got != "192.0.2.1" {
+		t.Errorf("clientIP = %q, want 192.0.2.1", got)
+	}
+
+	// The client sent a spoofed X-Forwarded-For, Cloud Run appended its
+	// address and a load balancer appended Cloud Run's.
+	req.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.7, 10.0.0.1")
+	tests := map[int]string{0: "10.0.0.1", 1: "203.0.113.7", 5: "198.51.100.1"}
+	for hops, want := range tests {
+		if got := clientIP(req, hops); got != want {
+			t.Errorf("clientIP(%d hops) = %q, want %q", hops, got, want)
+		}
+	}
+}
+
+func TestRateLimitSpoofedForwardedFor(t *testing.T) {
+	app := newTestApp(t)
+	app.rateLimiter = newTokenBucketRateLimiter(1, 2)
+	router := app.newRouter()
+	var codes []int
+	for i := range 5 {
+		req := httptest.NewRequest("GET", "/routes", nil)
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d, 203.0.113.7", i))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		codes = append(codes, rr.Code)
+	}
+	if codes[2] != http.StatusTooManyRequests {
+		t.Errorf("codes = %v, want spoofed entries limited as one client after the burst", codes)
+	}
+	n := 0
+	app.rateLimiter.(*tokenBucketRateLimiter).buckets.Range(func(_, _ any) bool { n++; return true })
+	if n != 1 {
+		t.Errorf("buckets = %d, want 1", n)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "fmt"
+
+// Rebalancing modes accepted by ?rebalance.
+const (
+	// rebalanceMonthly restores the value weights of the fund inception.
+	rebalanceMonthly = "monthly"
+	// rebalanceRiskParity weights the components inversely to their
+	// volatility.
+	rebalanceRiskParity = "risk_parity"
+)
+
+// riskParityVolWindow is the number of trailing days used to estimate the
+// volatility of each component on a rebalance date.
+const riskParityVolWindow = 30
+
+// longTermHoldingDays is the holding period after which US capital gains are
+// taxed at the long-term rate.
+const longTermHoldingDays = 365
+
+// RebalanceConfig configures a rebalanced index. The zero value keeps fixed
+// units of each component.
+type RebalanceConfig struct {
+	// Mode is rebalanceMonthly or rebalanceRiskParity.
+	Mode string
+	// TaxRate is the tax on gains realised on lots held less than a year.
+	TaxRate float64
+	// LongTermTaxRate is the tax on gains realised on lots held longer.
+	LongTermTaxRate float64
+}
+
+// taxJurisdictions maps ?tax_jurisdiction values to capital gains tax rates.
+var taxJurisdictions = map[string]RebalanceConfig{
+	"US": {TaxRate: 0.37, LongTermTaxRate: 0.20},
+}
+
+// computeRiskParityWeights returns weights inversely proportional to the
+// volatility of each component, so that the more volatile BTC gets the lower
+// weight. Equal weights are returned when either volatility is unknown.
+func computeRiskParityWeights(vooVol, btcVol float64) (wVOO, wBTC float64) {
+	if vooVol <= 0 || btcVol <= 0 {
+		return 0.5, 0.5
+	}
+	total := 1/vooVol + 1/btcVol
+	return (1 / vooVol) / total, (1 / btcVol) / total
+}
+
+// deductCapitalGainsTax returns the gain left after tax at rate. Losses are
+// returned unchanged.
+func deductCapitalGainsTax(gain, rate float64) float64 {
+	if gain <= 0 {
+		return gain
+	}
+	return gain * (1 - rate)
+}
+
+// trailingVolatility returns the standard deviation of the daily returns over
+// the window days up to and including data[i].
+func trailingVolatility(data []StockData, i, window int) float64 {
+	start := max(i-window, 0)
+	returns := make([]float64, 0, i-start)
+	for j := start + 1; j <= i; j++ {
+		if data[j-1].AdjClose != 0 {
+			returns = append(returns, data[j].AdjClose/data[j-1].AdjClose-1)
+		}
+	}
+	return stdDev(returns)
+}
+
+// taxLot is a purchase of units of a component.
+type taxLot struct {
+	date  string
+	units float64
+	price float64
+}
+
+// sellLots sells units from lots, oldest first, at price on date. It returns
+// the remaining lots and the capital gains tax due. lots is not modified.
+func sellLots(lots []taxLot, units, price float64, date string, cfg RebalanceConfig) ([]taxLot, float64) {
+	remaining := append([]taxLot(nil), lots...)
+	tax := 0.0
+	for units > 0 && len(remaining) > 0 {
+		lot := &remaining[0]
+		sold := min(units, lot.units)
+		gain := sold * (price - lot.price)
+		rate := cfg.TaxRate
+		if days, err := daysBetween(lot.date, date); err == nil && days >= longTermHoldingDays {
+			rate = cfg.LongTermTaxRate
+		}
+		tax += gain - deductCapitalGainsTax(gain, rate)
+		lot.units -= sold
+		units -= sold
+		if lot.units <= 0 {
+			remaining = remaining[1:]
+		}
+	}
+	return remaining, tax
+}
+
+// rebalancedIndex blends VOO and BTC into an index that equals 100 on the
+// first date both have a price, rebalancing on the first day of every month.
+// Monthly rebalancing restores the value weights that units give on the start
+// date. Risk parity uses the trailing riskParityVolWindow day volatility of
+// each component instead; the first month uses equal weights since there is
+// no history yet.
+//
+// When cfg has tax rates, the capital gains tax on the sales needed to reach
+// the target weights is deducted from the portfolio at each rebalance.
+func rebalancedIndex(voo, btc []StockData, units [2]float64, startDate string, cfg RebalanceConfig) ([]IndexData, error) {
+	if len(voo) == 0 || len(btc) == 0 {
+		return nil, fmt.Errorf("no component data available")
+	}
+	start := maxDateStr(startDate, maxDateStr(voo[0].Date, btc[0].Date))
+	end := maxDateStr(voo[len(voo)-1].Date, btc[len(btc)-1].Date)
+	filled := [2][]StockData{forwardFillStockData(voo, start, end, FillLast, false), forwardFillStockData(btc, start, end, FillLast, false)}
+	if len(filled[0]) == 0 || len(filled[0]) != len(filled[1]) {
+		return nil, fmt.Errorf("no component data available since %s", start)
+	}
+
+	var held [2]float64
+	var lots [2][]taxLot
+	series := make([]IndexData, 0, len(filled[0]))
+	for i := range filled[0] {
+		date := filled[0][i].Date
+		prices := [2]float64{filled[0][i].AdjClose, filled[1][i].AdjClose}
+		value := 100.0
+		if i > 0 {
+			value = held[0]*prices[0] + held[1]*prices[1]
+		}
+
+		if i == 0 || date[:7] != filled[0][i-1].Date[:7] {
+			if prices[0] == 0 || prices[1] == 0 {
+				return nil, fmt.Errorf("no component price on %s", date)
+			}
+			var weights [2]float64
+			if cfg.Mode == rebalanceRiskParity {
+				weights[0], weights[1] = computeRiskParityWeights(
+					trailingVolatility(filled[0], i, riskParityVolWindow),
+					trailingVolatility(filled[1], i, riskParityVolWindow))
+			} else {
+				initial := units[0]*filled[0][0].AdjClose + units[1]*filled[1][0].AdjClose
+				if initial == 0 {
+					return nil, fmt.Errorf("index value is zero on %s", start)
+				}
+				weights = [2]float64{units[0] * filled[0][0].AdjClose / initial, units[1] * filled[1][0].AdjClose / initial}
+			}
+
+			tax := 0.0
+			for c := range held {
+				if target := value * weights[c] / prices[c]; target < held[c] {
+					_, t := sellLots(lots[c], held[c]-target, prices[c], date, cfg)
+					tax += t
+				}
+			}
+			value -= tax
+
+			for c := range held {
+				target := value * weights[c] / prices[c]
+				if target < held[c] {
+					lots[c], _ = sellLots(lots[c], held[c]-target, prices[c], date, cfg)
+				} else if target > held[c] {
+					lots[c] = append(lots[c], taxLot{date: date, units: target - held[c], price: prices[c]})
+				}
+				held[c] = target
+			}
+		}
+
+		series = append(series, IndexData{
+			Date:       date,
+			AdjClose:   value,
+			FillStreak: max(filled[0][i].FillStreak, filled[1][i].FillStreak),
+		})
+	}
+	return series, nil
+}
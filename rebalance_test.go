@@ -0,0 +1,159 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestComputeRiskParityWeights(t *testing.T) {
+	wVOO, wBTC := computeRiskParityWeights(0.01, 0.04)
+	if wBTC >= wVOO {
+		t.Errorf("weights = %v, %v, want a lower BTC weight for a higher BTC vol", wVOO, wBTC)
+	}
+	if !almostEqual(wVOO, 0.8) || !almostEqual(wBTC, 0.2) {
+		t.Errorf("weights = %v, %v, want 0.8, 0.2", wVOO, wBTC)
+	}
+
+	_, lowerBTC := computeRiskParityWeights(0.01, 0.08)
+	if lowerBTC >= wBTC {
+		t.Errorf("BTC weight = %v at a higher vol, want below %v", lowerBTC, wBTC)
+	}
+
+	if wVOO, wBTC := computeRiskParityWeights(0, 0.04); wVOO != 0.5 || wBTC != 0.5 {
+		t.Errorf("weights without a VOO vol = %v, %v, want 0.5, 0.5", wVOO, wBTC)
+	}
+}
+
+func TestRiskParityIndex(t *testing.T) {
+	// Both components alternate daily, BTC far more than VOO.
+	var voo, btc []StockData
+	date := "2021-01-01"
+	for i := range 70 {
+		vooPrice, btcPrice := 100.0, 10.0
+		if i%2 == 1 {
+			vooPrice, btcPrice = 101, 12
+		}
+		voo = append(voo, StockData{Date: date, AdjClose: vooPrice})
+		btc = append(btc, StockData{Date: date, AdjClose: btcPrice})
+		date = incrementDate(date)
+	}
+
+	series, err := rebalancedIndex(voo, btc, [2]float64{}, "2021-01-01", RebalanceConfig{Mode: rebalanceRiskParity})
+	if err != nil {
+		t.Fatalf("rebalancedIndex: %v", err)
+	}
+	if len(series) != 70 || series[0].AdjClose != 100 {
+		t.Fatalf("series = %+v, want 70 points starting at 100", series)
+	}
+	// January has no history, so half the portfolio is in each component.
+	if !almostEqual(series[1].AdjClose, 100*(0.5*1.01+0.5*1.2)) {
+		t.Errorf("value on %s = %v, want equal weights", series[1].Date, series[1].AdjClose)
+	}
+	// The February rebalance moves most of the portfolio into VOO, which
+	// damps the daily swings.
+	if series[31].Date != "2021-02-01" {
+		t.Fatalf("series[31].Date = %s, want 2021-02-01", series[31].Date)
+	}
+	january := series[1].AdjClose/series[0].AdjClose - 1
+	february := series[32].AdjClose/series[31].AdjClose - 1
+	if math.Abs(february) >= math.Abs(january)/2 {
+		t.Errorf("daily return after rebalance = %v, want well below January's %v", february, january)
+	}
+}
+
+func TestDeductCapitalGainsTax(t *testing.T) {
+	if got := deductCapitalGainsTax(100, 0.37); !almostEqual(got, 63) {
+		t.Errorf("deductCapitalGainsTax(100, 0.37) = %v, want 63", got)
+	}
+	if got := deductCapitalGainsTax(-50, 0.37); got != -50 {
+		t.Errorf("deductCapitalGainsTax(-50, 0.37) = %v, want the loss unchanged", got)
+	}
+}
+
+// trendingComponents returns days of VOO and BTC prices, with BTC rising
+// faster so that every rebalance sells BTC at a gain.
+func trendingComponents(days int) (voo, btc []StockData) {
+	date := "2021-01-01"
+	for i := range days {
+		voo = append(voo, StockData{Date: date, AdjClose: 100 + float64(i)*0.05})
+		btc = append(btc, StockData{Date: date, AdjClose: 10 + float64(i)*0.05})
+		date = incrementDate(date)
+	}
+	return voo, btc
+}
+
+func TestRebalancedIndexMonthly(t *testing.T) {
+	voo, btc := trendingComponents(70)
+	// 1 VOO at 100 and 10 BTC at 10 give equal value weights.
+	series, err := rebalancedIndex(voo, btc, [2]float64{1, 10}, "2021-01-01", RebalanceConfig{Mode: rebalanceMonthly})
+	if err != nil {
+		t.Fatalf("rebalancedIndex: %v", err)
+	}
+	fixed, err := blendIndex([][]StockData{voo, btc}, []float64{1, 10}, "2021-01-01", FillLast, false, nil)
+	if err != nil {
+		t.Fatalf("blendIndex: %v", err)
+	}
+	// Both start at 100 and match until the first rebalance.
+	if series[0].AdjClose != 100 || !almostEqual(series[30].AdjClose, fixed[30].AdjClose) {
+		t.Errorf("rebalanced = %v, %v, want fixed %v, %v", series[0].AdjClose, series[30].AdjClose, fixed[0].AdjClose, fixed[30].AdjClose)
+	}
+	// Selling the faster rising BTC lags the fixed units afterwards.
+	if last := len(series) - 1; series[last].AdjClose >= fixed[last].AdjClose {
+		t.Errorf("rebalanced = %v, want below fixed units %v", series[last].AdjClose, fixed[last].AdjClose)
+	}
+}
+
+func TestRebalancedIndexTax(t *testing.T) {
+	voo, btc := trendingComponents(500)
+	for _, mode := range []string{rebalanceMonthly, rebalanceRiskParity} {
+		untaxed, err := rebalancedIndex(voo, btc, [2]float64{1, 10}, "2021-01-01", RebalanceConfig{Mode: mode})
+		if err != nil {
+			t.Fatalf("rebalancedIndex: %v", err)
+		}
+		cfg := taxJurisdictions["US"]
+		cfg.Mode = mode
+		taxed, err := rebalancedIndex(voo, btc, [2]float64{1, 10}, "2021-01-01", cfg)
+		if err != nil {
+			t.Fatalf("rebalancedIndex: %v", err)
+		}
+		for i := range untaxed {
+			if taxed[i].AdjClose > untaxed[i].AdjClose+1e-9 {
+				t.Fatalf("%s: taxed %v on %s, want at most untaxed %v", mode, taxed[i].AdjClose, taxed[i].Date, untaxed[i].AdjClose)
+			}
+		}
+		if got, want := totalReturnPct(taxed), totalReturnPct(untaxed); got >= want {
+			t.Errorf("%s: taxed return %v%%, want below untaxed %v%%", mode, got, want)
+		}
+	}
+}
+
+func TestSellLots(t *testing.T) {
+	lots := []taxLot{{date: "2020-01-01", units: 2, price: 10}, {date: "2021-01-01", units: 2, price: 20}}
+	cfg := RebalanceConfig{TaxRate: 0.5, LongTermTaxRate: 0.1}
+	remaining, tax := sellLots(lots, 3, 30, "2021-06-01", cfg)
+	// 2 long-term units gain 40 taxed at 10% and 1 short-term unit gains 10
+	// taxed at 50%.
+	if !almostEqual(tax, 9) {
+		t.Errorf("tax = %v, want 9", tax)
+	}
+	if len(remaining) != 1 || remaining[0].units != 1 || remaining[0].price != 20 {
+		t.Errorf("remaining = %+v, want 1 unit of the 2021 lot", remaining)
+	}
+	if lots[0].units != 2 {
+		t.Error("sellLots modified its input")
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	handler := requestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestIDFrom(r.Context())
+	}))
+
+	// The ID set by the load balancer is kept.
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/QUARTZ9", nil)
+	req.Header.Set(requestIDHeader, "lb-1234")
+	handler.ServeHTTP(rr, req)
+	if got := rr.Header().Get(requestIDHeader); got != "lb-1234" || seen != "lb-1234" {
+		t.Errorf("request ID = %q in the response and %q in the context, want lb-1234", got, seen)
+	}
+
+	// Otherwise every request gets a new ID.
+	ids := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ9", nil))
+		got := rr.Header().Get(requestIDHeader)
+		if !regexp.MustCompile(`^[0-9a-f]{32}$`).MatchString(got) || seen != got {
+			t.Errorf("request ID = %q in the response and %q in the context, want the same 32 hex digits", got, seen)
+		}
+		ids[got] = true
+	}
+	if len(ids) != 2 {
+		t.Errorf("generated IDs %v, want two different IDs", ids)
+	}
+}
+
+func TestRouterSetsRequestID(t *testing.T) {
+	app := newTestApp(t)
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/health", nil))
+	if rr.Header().Get(requestIDHeader) == "" {
+		t.Errorf("%s header missing", requestIDHeader)
+	}
+}
@@ -0,0 +1,310 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/parquet-go/parquet-go"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// indexRow is the Parquet schema of an index data point.
+type indexRow struct {
+	Date     string  `parquet:"date"`
+	AdjClose float64 `parquet:"adjusted_close"`
+}
+
+// encodeParquet encodes the index series as an Apache Parquet file.
+func encodeParquet(series []IndexData) ([]byte, error) {
+	rows := make([]indexRow, len(series))
+	for i, data := range series {
+		rows[i] = indexRow{Date: data.Date, AdjClose: data.AdjClose}
+	}
+	var buf bytes.Buffer
+	if err := parquet.Write(&buf, rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeCSV encodes the index series as CSV with a date,adj_close header.
+func encodeCSV(series []IndexData) ([]byte, error) {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	cw.Write([]string{"date", "adj_close"})
+	for _, data := range series {
+		cw.Write([]string{data.Date, strconv.FormatFloat(data.AdjClose, 'f', -1, 64)})
+	}
+	cw.Flush()
+	return buf.Bytes(), cw.Error()
+}
+
+// responseFormat returns the output format requested by ?format or, when it
+// is not set, csv for an Accept header asking for text/csv before JSON. The
+// empty string stands for JSON.
+func responseFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(accept))
+		switch mediaType {
+		case "text/csv":
+			return "csv"
+		case "application/json":
+			return ""
+		}
+	}
+	return ""
+}
+
+// writeResponse writes the index series as a file download in the format
+// requested by r, see responseFormat. Formats holding the whole response
+// envelope, JSON and MessagePack, are written by the handler.
+func writeResponse(w http.ResponseWriter, r *http.Request, data []IndexData) error {
+	symbol := strings.ToUpper(mux.Vars(r)["symbol"])
+	var body []byte
+	var err error
+	switch format := responseFormat(r); format {
+	case "parquet":
+		if body, err = encodeParquet(data); err != nil {
+			return err
+		}
+		fileName := symbol + ".parquet"
+		if len(data) > 0 {
+			fileName = symbol + "_" + data[0].Date + ".parquet"
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", "attachment; filename="+fileName)
+	case "csv":
+		if body, err = encodeCSV(data); err != nil {
+			return err
+		}
+		fileName := symbol + ".csv"
+		if len(data) > 0 {
+			year, _, _ := strings.Cut(data[len(data)-1].Date, "-")
+			fileName = symbol + "-" + year + ".csv"
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+fileName+`"`)
+	default:
+		return fmt.Errorf("unsupported download format '%s'", format)
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+// defaultMaxRawDataSeries is the default number of component series that may
+// be returned with include_raw_data.
+const defaultMaxRawDataSeries = 3
+
+// maxFilledDates is the largest number of dates listed by include_date_gaps.
+const maxFilledDates = 100
+
+// encodeMsgpack encodes v as MessagePack, using the same field names as the
+// JSON responses.
+func encodeMsgpack(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 5000
+)
+
+// IndexResponse is the response envelope of the index endpoint. Callers that
+// do not ask for any of the optional sections receive the bare index array.
+type IndexResponse struct {
+	Index       []IndexData            `json:"index"`
+	Pagination  *Pagination            `json:"pagination,omitempty"`
+	Components  map[string][]IndexData `json:"components,omitempty"`
+	FilledDates []string               `json:"filled_dates,omitempty"`
+	AlertDates  []string               `json:"alert_dates,omitempty"`
+	Gaps        []RegimeGap            `json:"gaps,omitempty"`
+	Summary     *IndexSummary          `json:"summary,omitempty"`
+	DebugTrace  []string               `json:"debug_trace,omitempty"`
+	Errors      []TickerError          `json:"errors,omitempty"`
+	// DataHash is the computeResponseHash of the JSON encoding of Index, as
+	// found in the response.
+	DataHash string `json:"data_hash,omitempty"`
+}
+
+// ErrorResponse is the JSON body of an error response.
+type ErrorResponse struct {
+	Error string `json:"error"`
+	Code  int    `json:"code"`
+}
+
+// writeJSONError replies with message and code as an ErrorResponse.
+func writeJSONError(w http.ResponseWriter, message string, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: message, Code: code})
+}
+
+// IndexSummary compares the return of a taxed rebalanced index with the
+// same index without tax.
+type IndexSummary struct {
+	ReturnPct         float64 `json:"return_pct"`
+	AfterTaxReturnPct float64 `json:"after_tax_return_pct"`
+}
+
+// totalReturnPct returns the return from the first to the last point of
+// series in percent.
+func totalReturnPct(series []IndexData) float64 {
+	if len(series) == 0 || series[0].AdjClose == 0 {
+		return 0
+	}
+	return (series[len(series)-1].AdjClose/series[0].AdjClose - 1) * 100
+}
+
+// computeResponseHash returns the SHA-256 of data as "sha256:" followed by
+// the hash in hex, for clients to verify the data they received.
+func computeResponseHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// payload returns the value to encode for the response.
+func (r IndexResponse) payload() any {
+	if r.Pagination == nil && r.Components == nil && r.FilledDates == nil && r.AlertDates == nil && r.Gaps == nil && r.Summary == nil && r.DebugTrace == nil && r.Errors == nil && r.DataHash == "" {
+		return r.Index
+	}
+	return r
+}
+
+// componentSeries returns the unblended adjusted closes of the components of
+// fund over the dates covered by series, or all dates when the series is
+// empty. Days without a price, such as weekends for VOO, are left out rather
+// than forward filled. Components that cannot be fetched are omitted.
+func (a *App) componentSeries(ctx context.Context, fund FundDefinition, series []IndexData) map[string][]IndexData {
+	data, _ := a.FetchSymbolsConcurrently(ctx, fund.Symbols(), fundInceptionDate, "")
+	components := make(map[string][]IndexData, len(data))
+	for ticker, stockData := range data {
+		raw := []IndexData{}
+		for _, point := range stockData {
+			if len(series) > 0 && (maxDateStr(point.Date, series[0].Date) != point.Date || minDateStr(point.Date, series[len(series)-1].Date) != point.Date) {
+				continue
+			}
+			raw = append(raw, IndexData{Date: point.Date, AdjClose: point.AdjClose})
+		}
+		components[ticker] = raw
+	}
+	return components
+}
+
+// filledDates lists the first limit dates of the series on which at least one
+// component price was forward filled.
+func filledDates(series []IndexData, limit int) []string {
+	dates := []string{}
+	for _, data := range series {
+		if len(dates) == limit {
+			break
+		}
+		if data.FillStreak > 0 {
+			dates = append(dates, data.Date)
+		}
+	}
+	return dates
+}
+
+// parseTimezone loads an IANA timezone such as America/New_York.
+func parseTimezone(name string) (*time.Location, error) {
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "Local" {
+		return nil, fmt.Errorf("invalid timezone: '%s'", name)
+	}
+	return loc, nil
+}
+
+// applyOutputTimezone sets the timestamp of every point to the start of its
+// date in loc. Dates are trading days and are not shifted.
+func applyOutputTimezone(series []IndexData, loc *time.Location) []IndexData {
+	converted := make([]IndexData, len(series))
+	for i, data := range series {
+		if day, err := time.Parse(time.DateOnly, data.Date); err == nil {
+			data.Timestamp = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc).Format(time.RFC3339)
+		}
+		converted[i] = data
+	}
+	return converted
+}
+
+// Pagination describes the page of the series returned to the caller.
+type Pagination struct {
+	Page         int `json:"page"`
+	PageSize     int `json:"page_size"`
+	TotalPages   int `json:"total_pages"`
+	TotalRecords int `json:"total_records"`
+}
+
+// parsePagination reads the optional page and page_size query parameters.
+// paginated is false when neither parameter is present.
+func parsePagination(r *http.Request) (page, pageSize int, paginated bool, err error) {
+	query := r.URL.Query()
+	page, pageSize = 1, defaultPageSize
+	if v := query.Get("page"); v != "" {
+		paginated = true
+		if page, err = strconv.Atoi(v); err != nil || page < 1 {
+			return 0, 0, false, fmt.Errorf("invalid 'page' value '%s', expected a positive integer", v)
+		}
+	}
+	if v := query.Get("page_size"); v != "" {
+		paginated = true
+		if pageSize, err = strconv.Atoi(v); err != nil || pageSize < 1 || pageSize > maxPageSize {
+			return 0, 0, false, fmt.Errorf("invalid 'page_size' value '%s', expected an integer between 1 and %d", v, maxPageSize)
+		}
+	}
+	return page, pageSize, paginated, nil
+}
+
+// paginate returns the requested page of the series, oldest points first.
+// Pages past the end of the series are empty.
+func paginate(series []IndexData, page, pageSize int) ([]IndexData, Pagination) {
+	pagination := Pagination{
+		Page:         page,
+		PageSize:     pageSize,
+		TotalPages:   (len(series) + pageSize - 1) / pageSize,
+		TotalRecords: len(series),
+	}
+	// Compare with the number of pages first, as (page-1)*pageSize may
+	// overflow for large pages.
+	if page-1 >= pagination.TotalPages {
+		return []IndexData{}, pagination
+	}
+	start := (page - 1) * pageSize
+	end := min(start+pageSize, len(series))
+	return series[start:end], pagination
+}
@@ -0,0 +1,195 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPaginate(t *testing.T) {
+	series := make([]IndexData, 1825)
+	for i := range series {
+		series[i].AdjClose = float64(i)
+	}
+	tests := []struct {
+		page, pageSize int
+		wantLen        int
+		wantFirst      float64
+	}{
+		{1, 100, 100, 0},
+		{2, 100, 100, 100},
+		{19, 100, 25, 1800},
+		{20, 100, 0, 0},
+		{1, 5000, 1825, 0},
+		{math.MaxInt, 2, 0, 0},
+	}
+	for _, tc := range tests {
+		got, pagination := paginate(series, tc.page, tc.pageSize)
+		if len(got) != tc.wantLen {
+			t.Errorf("page %d/%d: len = %d, want %d", tc.page, tc.pageSize, len(got), tc.wantLen)
+			continue
+		}
+		if len(got) > 0 && got[0].AdjClose != tc.wantFirst {
+			t.Errorf("page %d/%d: first = %v, want %v", tc.page, tc.pageSize, got[0].AdjClose, tc.wantFirst)
+		}
+		if pagination.TotalRecords != 1825 || pagination.TotalPages != (1825+tc.pageSize-1)/tc.pageSize {
+			t.Errorf("page %d/%d: pagination = %+v", tc.page, tc.pageSize, pagination)
+		}
+	}
+	if _, pagination := paginate(series, 2, 100); pagination.TotalPages != 19 {
+		t.Errorf("TotalPages = %d, want 19", pagination.TotalPages)
+	}
+}
+
+func TestParsePagination(t *testing.T) {
+	tests := []struct {
+		query         string
+		page, size    int
+		paginated, ok bool
+	}{
+		{"", 1, 100, false, true},
+		{"page=2", 2, 100, true, true},
+		{"page_size=50", 1, 50, true, true},
+		{"page=0", 0, 0, false, false},
+		{"page=two", 0, 0, false, false},
+		{"page_size=100000", 0, 0, false, false},
+	}
+	for _, tc := range tests {
+		page, size, paginated, err := parsePagination(httptest.NewRequest("GET", "/QUARTZ9?"+tc.query, nil))
+		if (err == nil) != tc.ok || page != tc.page || size != tc.size || paginated != tc.paginated {
+			t.Errorf("parsePagination(%q) = %d, %d, %v, %v", tc.query, page, size, paginated, err)
+		}
+	}
+}
+
+func TestFilledDates(t *testing.T) {
+	series := indexSeries("2021-01-01", make([]float64, 300)...)
+	for i := range series {
+		series[i].FillStreak = i % 2
+	}
+	got := filledDates(series, maxFilledDates)
+	if len(got) != maxFilledDates {
+		t.Fatalf("len = %d, want %d", len(got), maxFilledDates)
+	}
+	if got[0] != series[1].Date {
+		t.Errorf("first filled date = %s, want %s", got[0], series[1].Date)
+	}
+	if got := filledDates(series[:1], maxFilledDates); got == nil || len(got) != 0 {
+		t.Errorf("filledDates without gaps = %#v, want empty", got)
+	}
+}
+
+func TestApplyOutputTimezone(t *testing.T) {
+	loc, err := parseTimezone("America/New_York")
+	if err != nil {
+		t.Fatalf("parseTimezone: %v", err)
+	}
+	got := applyOutputTimezone(indexSeries("2021-01-04", 100), loc)
+	if got[0].Date != "2021-01-04" || got[0].Timestamp != "2021-01-04T00:00:00-05:00" {
+		t.Errorf("point = %+v, want 2021-01-04T00:00:00-05:00", got[0])
+	}
+	for _, name := range []string{"Mars/Central", "Local", "+05:30"} {
+		if _, err := parseTimezone(name); err == nil || err.Error() != "invalid timezone: '"+name+"'" {
+			t.Errorf("parseTimezone(%q) error = %v", name, err)
+		}
+	}
+}
+
+func TestComputeResponseHash(t *testing.T) {
+	series := indexSeries("2021-01-04", 100, 101, 102)
+	data, _ := json.Marshal(series)
+	hash := computeResponseHash(data)
+	if !strings.HasPrefix(hash, "sha256:") || len(hash) != len("sha256:")+64 {
+		t.Fatalf("computeResponseHash = %q, want sha256: and 64 hex digits", hash)
+	}
+	if again := computeResponseHash(data); again != hash {
+		t.Errorf("hash of the same data = %q, want %q", again, hash)
+	}
+	series[1].AdjClose = 101.0001
+	modified, _ := json.Marshal(series)
+	if got := computeResponseHash(modified); got == hash {
+		t.Errorf("hash unchanged after modifying a data point: %q", got)
+	}
+}
+
+func TestHandlerFieldsHash(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101, 102))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 13))
+
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ9?fields_hash=true", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	// Clients hash the index as they received it.
+	var got struct {
+		Index    json.RawMessage `json:"index"`
+		DataHash string          `json:"data_hash"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal(%s): %v", rr.Body, err)
+	}
+	if want := computeResponseHash(got.Index); got.DataHash != want {
+		t.Errorf("data_hash = %q, want %q", got.DataHash, want)
+	}
+
+	for _, target := range []string{"/QUARTZ9?fields_hash=maybe", "/QUARTZ9?fields_hash=true&group_by=year", "/QUARTZ9?fields_hash=true&format=csv"} {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: Code = %d, want %d", target, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func benchmarkIndexSeries() []IndexData {
+	series := indexSeries(fundInceptionDate, make([]float64, 2000)...)
+	for i := range series {
+		series[i].AdjClose = 100 + float64(i)*0.37
+	}
+	return series
+}
+
+func BenchmarkEncodeJSON(b *testing.B) {
+	series := benchmarkIndexSeries()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data, err := json.Marshal(series)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(len(data)))
+	}
+}
+
+func BenchmarkEncodeMsgpack(b *testing.B) {
+	series := benchmarkIndexSeries()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data, err := encodeMsgpack(series)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(len(data)))
+	}
+}
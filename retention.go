@@ -0,0 +1,170 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// Default ages, in days, of the cache objects that are archived and deleted
+// unless ARCHIVE_AFTER_DAYS and DELETE_AFTER_DAYS are set.
+const (
+	defaultArchiveAfterDays = 30
+	defaultDeleteAfterDays  = 365
+)
+
+// archiveStorageClass is the storage class archived cache objects are moved
+// to.
+const archiveStorageClass = "NEARLINE"
+
+// retentionPolicy decides what happens to the cache objects of previous days
+// in a bucket: they are moved to archiveStorageClass after ArchiveAfterDays
+// and deleted after DeleteAfterDays.
+type retentionPolicy struct {
+	ArchiveAfterDays int
+	DeleteAfterDays  int
+}
+
+// cacheObjectStore is the part of the Cloud Storage client used by the
+// retention policy.
+type cacheObjectStore interface {
+	// listObjects returns the attributes of every object in bucket.
+	listObjects(ctx context.Context, bucket string) ([]*storage.ObjectAttrs, error)
+	// archiveCacheFile moves an object to archiveStorageClass.
+	archiveCacheFile(ctx context.Context, bucket, objectName string) error
+	// deleteObject deletes an object.
+	deleteObject(ctx context.Context, bucket, objectName string) error
+}
+
+// gcsObjectStore implements cacheObjectStore with a Cloud Storage client.
+type gcsObjectStore struct {
+	client *storage.Client
+}
+
+func (s gcsObjectStore) listObjects(ctx context.Context, bucket string) ([]*storage.ObjectAttrs, error) {
+	var objects []*storage.ObjectAttrs
+	it := s.client.Bucket(bucket).Objects(ctx, nil)
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, attrs)
+	}
+}
+
+// archiveCacheFile rewrites the object onto itself with the new storage
+// class, since the storage class cannot be changed by updating the object
+// metadata.
+func (s gcsObjectStore) archiveCacheFile(ctx context.Context, bucket, objectName string) error {
+	obj := s.client.Bucket(bucket).Object(objectName)
+	copier := obj.CopierFrom(obj)
+	copier.StorageClass = archiveStorageClass
+	_, err := copier.Run(ctx)
+	return err
+}
+
+func (s gcsObjectStore) deleteObject(ctx context.Context, bucket, objectName string) error {
+	return s.client.Bucket(bucket).Object(objectName).Delete(ctx)
+}
+
+// applyRetention archives and deletes the cache objects of the bucket
+// according to p, relative to the date of now. Objects whose name is not
+// {symbol}/{date}.json or splits/{symbol}/{date}.json are left alone. It returns the number of objects
+// archived and deleted.
+func (b *GCSCacheBackend) applyRetention(ctx context.Context, p retentionPolicy, now time.Time) (archived, deleted int, err error) {
+	objects, err := b.store.listObjects(ctx, b.name)
+	if err != nil {
+		return 0, 0, err
+	}
+	today, _ := time.Parse(time.DateOnly, now.UTC().Format(time.DateOnly))
+	for _, attrs := range objects {
+		date, ok := strings.CutSuffix(path.Base(attrs.Name), ".json")
+		if !ok || strings.Count(strings.TrimPrefix(attrs.Name, "splits/"), "/") != 1 {
+			continue
+		}
+		day, perr := time.Parse(time.DateOnly, date)
+		if perr != nil {
+			continue
+		}
+		age := int(today.Sub(day).Hours() / 24)
+		switch {
+		case age >= p.DeleteAfterDays:
+			if err := b.store.deleteObject(ctx, b.name, attrs.Name); err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+				return archived, deleted, fmt.Errorf("deleting %s: %w", attrs.Name, err)
+			}
+			deleted++
+		case age >= p.ArchiveAfterDays && attrs.StorageClass != archiveStorageClass:
+			if err := b.store.archiveCacheFile(ctx, b.name, attrs.Name); err != nil {
+				return archived, deleted, fmt.Errorf("archiving %s: %w", attrs.Name, err)
+			}
+			archived++
+		}
+	}
+	return archived, deleted, nil
+}
+
+// retentionBucket returns the bucket the retention policy of the app applies
+// to: the bucket cache, or the bucket mounted as the cache directory. It
+// returns nil when the cache is a plain directory, which is evicted instead.
+func (a *App) retentionBucket() *GCSCacheBackend {
+	switch backend := a.cache().(type) {
+	case *GCSCacheBackend:
+		return backend
+	case FileCacheBackend:
+		return a.cacheMountBucket
+	}
+	return nil
+}
+
+// runCacheRetention applies the retention policy of the app to the cache
+// bucket every interval until ctx is done.
+func (a *App) runCacheRetention(ctx context.Context, backend *GCSCacheBackend, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		archived, deleted, err := backend.applyRetention(ctx, a.retention, time.Now())
+		if err != nil {
+			a.log.Log(logging.Entry{
+				Severity: logging.Warning,
+				Payload:  fmt.Sprintf("cache retention: %v", err),
+			})
+			continue
+		}
+		if archived > 0 || deleted > 0 {
+			a.log.Log(logging.Entry{
+				Severity: logging.Info,
+				Payload:  fmt.Sprintf("cache retention archived %d and deleted %d objects", archived, deleted),
+			})
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// fakeObjectStore is a cacheObjectStore recording the objects it archives
+// and deletes.
+type fakeObjectStore struct {
+	objects  []*storage.ObjectAttrs
+	archived []string
+	deleted  []string
+}
+
+func (s *fakeObjectStore) listObjects(ctx context.Context, bucket string) ([]*storage.ObjectAttrs, error) {
+	return s.objects, nil
+}
+
+func (s *fakeObjectStore) archiveCacheFile(ctx context.Context, bucket, objectName string) error {
+	s.archived = append(s.archived, bucket+"/"+objectName)
+	return nil
+}
+
+func (s *fakeObjectStore) deleteObject(ctx context.Context, bucket, objectName string) error {
+	s.deleted = append(s.deleted, bucket+"/"+objectName)
+	return nil
+}
+
+func TestApplyRetention(t *testing.T) {
+	store := &fakeObjectStore{objects: []*storage.ObjectAttrs{
+		{Name: "VOO.US/2024-06-30.json", StorageClass: "STANDARD"},
+		{Name: "VOO.US/2024-06-01.json", StorageClass: "STANDARD"},
+		{Name: "VOO.US/2024-05-31.json", StorageClass: "STANDARD"},
+		{Name: "VOO.US/2024-05-01.json", StorageClass: archiveStorageClass},
+		{Name: "VOO.US/2024-04-01.json", StorageClass: archiveStorageClass},
+		{Name: "BTC-USD.CC/2024-03-01.json", StorageClass: "STANDARD"},
+		{Name: "splits/VOO.US/2024-03-01.json", StorageClass: "STANDARD"},
+		{Name: "snapshots/QUARTZ9/20240101T000000Z.json", StorageClass: "STANDARD"},
+		{Name: "VOO.US/notes.json", StorageClass: "STANDARD"},
+	}}
+	backend := &GCSCacheBackend{name: "cache", store: store}
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	archived, deleted, err := backend.applyRetention(context.Background(), retentionPolicy{ArchiveAfterDays: 30, DeleteAfterDays: 90}, now)
+	if err != nil {
+		t.Fatalf("applyRetention: %v", err)
+	}
+	wantArchived := []string{"cache/VOO.US/2024-05-31.json"}
+	wantDeleted := []string{"cache/VOO.US/2024-04-01.json", "cache/BTC-USD.CC/2024-03-01.json", "cache/splits/VOO.US/2024-03-01.json"}
+	if archived != len(wantArchived) || !slices.Equal(store.archived, wantArchived) {
+		t.Errorf("archived %d: %v, want %v", archived, store.archived, wantArchived)
+	}
+	if deleted != len(wantDeleted) || !slices.Equal(store.deleted, wantDeleted) {
+		t.Errorf("deleted %d: %v, want %v", deleted, store.deleted, wantDeleted)
+	}
+}
+
+func TestRetentionBucketFileBackend(t *testing.T) {
+	app := newTestApp(t)
+	if bucket := app.retentionBucket(); bucket != nil {
+		t.Errorf("retentionBucket of a plain directory = %v, want nil", bucket)
+	}
+
+	// The files of the mounted bucket are archived at ArchiveAfterDays
+	// rather than evicted after a day.
+	store := &fakeObjectStore{objects: []*storage.ObjectAttrs{
+		{Name: "VOO.US/2024-06-29.json", StorageClass: "STANDARD"},
+		{Name: "VOO.US/2024-05-31.json", StorageClass: "STANDARD"},
+	}}
+	app.cacheMountBucket = &GCSCacheBackend{name: "mount", store: store}
+	bucket := app.retentionBucket()
+	if bucket != app.cacheMountBucket {
+		t.Fatalf("retentionBucket = %v, want the mounted bucket", bucket)
+	}
+	archived, deleted, err := bucket.applyRetention(context.Background(), retentionPolicy{ArchiveAfterDays: 30, DeleteAfterDays: 90}, time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("applyRetention: %v", err)
+	}
+	if want := []string{"mount/VOO.US/2024-05-31.json"}; archived != 1 || deleted != 0 || !slices.Equal(store.archived, want) {
+		t.Errorf("archived %d %v and deleted %d, want %v archived", archived, store.archived, deleted, want)
+	}
+}
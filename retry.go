@@ -0,0 +1,102 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultRetryAttempts is the number of attempts made for an upstream request
+// when FETCH_RETRY_ATTEMPTS is not set.
+const defaultRetryAttempts = 3
+
+// retryPolicy configures the retries of readDataFromURL. The zero value makes
+// a single attempt.
+type retryPolicy struct {
+	// Attempts is the total number of attempts, including the first.
+	Attempts int
+	// Base is the delay before the first retry. It doubles with every
+	// attempt, and a random jitter of up to Base is added.
+	Base time.Duration
+	// MaxRetryAfter caps the delay requested by a Retry-After header.
+	MaxRetryAfter time.Duration
+	// NoRetryTooManyRequests returns 429 Too Many Requests at once, for
+	// callers that can switch to another API key instead of waiting.
+	NoRetryTooManyRequests bool
+}
+
+// defaultRetryPolicy is used for the upstream APIs.
+var defaultRetryPolicy = retryPolicy{
+	Attempts:      defaultRetryAttempts,
+	Base:          200 * time.Millisecond,
+	MaxRetryAfter: 30 * time.Second,
+}
+
+// backoff returns the delay before retrying after the given attempt,
+// starting at 0: Base * 2^attempt plus jitter.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	delay := p.Base << attempt
+	if p.Base > 0 {
+		delay += rand.N(p.Base)
+	}
+	return delay
+}
+
+// delay returns how long to wait before retrying after err, and whether the
+// request should be retried at all. Requests rejected with 429 Too Many
+// Requests or a 5xx status, and network errors, are retried; other statuses
+// such as 400, 401, 403 and 404 are not.
+func (p retryPolicy) delay(err error, attempt int) (time.Duration, bool) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return 0, false
+	}
+	var statusErr *httpStatusError
+	if !errors.As(err, &statusErr) {
+		return p.backoff(attempt), true
+	}
+	switch {
+	case statusErr.StatusCode == http.StatusTooManyRequests:
+		if p.NoRetryTooManyRequests {
+			return 0, false
+		}
+		if statusErr.RetryAfter > 0 {
+			return min(statusErr.RetryAfter, p.MaxRetryAfter), true
+		}
+		return p.backoff(attempt), true
+	case statusErr.StatusCode >= 500:
+		return p.backoff(attempt), true
+	}
+	return 0, false
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP
+// date. It returns 0 when the header is absent or invalid.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
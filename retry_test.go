@@ -0,0 +1,148 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testRetryPolicy retries quickly so that tests do not sleep.
+var testRetryPolicy = retryPolicy{Attempts: 3, Base: time.Millisecond, MaxRetryAfter: 10 * time.Millisecond}
+
+// statusSequence serves the given statuses in turn, then 200 with body "ok".
+func statusSequence(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *int) {
+	t.Helper()
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= len(statuses) {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(statuses[requests-1])
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestReadDataFromURLRetries(t *testing.T) {
+	srv, requests := statusSequence(t, nil, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	body, err := readDataFromURL(context.Background(), srv.URL, testRetryPolicy)
+	if err != nil || string(body) != "ok" {
+		t.Fatalf("readDataFromURL = %q, %v, want ok on the third attempt", body, err)
+	}
+	if *requests != 3 {
+		t.Errorf("requests = %d, want 3", *requests)
+	}
+}
+
+func TestReadDataFromURLGivesUp(t *testing.T) {
+	srv, requests := statusSequence(t, nil, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	_, err := readDataFromURL(context.Background(), srv.URL, testRetryPolicy)
+	var statusErr *httpStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("err = %v, want 502", err)
+	}
+	if *requests != 3 {
+		t.Errorf("requests = %d, want 3", *requests)
+	}
+}
+
+func TestReadDataFromURLDoesNotRetryClientErrors(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound} {
+		srv, requests := statusSequence(t, nil, status)
+		if _, err := readDataFromURL(context.Background(), srv.URL, testRetryPolicy); err == nil {
+			t.Errorf("%d: readDataFromURL succeeded, want error", status)
+		}
+		if *requests != 1 {
+			t.Errorf("%d: requests = %d, want 1", status, *requests)
+		}
+	}
+}
+
+func TestReadDataFromURLRetryAfter(t *testing.T) {
+	srv, requests := statusSequence(t, http.Header{"Retry-After": {"120"}}, http.StatusTooManyRequests)
+	start := time.Now()
+	body, err := readDataFromURL(context.Background(), srv.URL, testRetryPolicy)
+	if err != nil || string(body) != "ok" || *requests != 2 {
+		t.Fatalf("readDataFromURL = %q, %v after %d requests, want ok after 2", body, err, *requests)
+	}
+	// The two minutes requested by the server are capped by MaxRetryAfter.
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("elapsed = %v, want the Retry-After capped", elapsed)
+	}
+}
+
+func TestReadDataFromURLCancelled(t *testing.T) {
+	srv, requests := statusSequence(t, nil, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	policy := retryPolicy{Attempts: 3, Base: time.Hour}
+	if _, err := readDataFromURL(ctx, srv.URL, policy); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if *requests != 0 {
+		t.Errorf("requests = %d, want 0", *requests)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"soon", 0},
+		{now.Add(time.Minute).Format(http.TimeFormat), time.Minute},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.header, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := retryPolicy{Base: 100 * time.Millisecond}
+	for attempt, lo := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond} {
+		if got := p.backoff(attempt); got < lo || got >= lo+p.Base {
+			t.Errorf("backoff(%d) = %v, want in [%v, %v)", attempt, got, lo, lo+p.Base)
+		}
+	}
+}
+
+func TestReadDataFromURLNoRetryTooManyRequests(t *testing.T) {
+	srv, requests := statusSequence(t, nil, http.StatusTooManyRequests)
+	policy := testRetryPolicy
+	policy.NoRetryTooManyRequests = true
+	var statusErr *httpStatusError
+	if _, err := readDataFromURL(context.Background(), srv.URL, policy); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("readDataFromURL error = %v, want 429", err)
+	}
+	if *requests != 1 {
+		t.Errorf("requests = %d, want 1", *requests)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// RouteParam describes a query parameter accepted by an endpoint.
+type RouteParam struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+}
+
+// Endpoint documents a single route of the service.
+type Endpoint struct {
+	Path        string       `json:"path"`
+	Method      string       `json:"method"`
+	Description string       `json:"description,omitempty"`
+	Params      []RouteParam `json:"params"`
+}
+
+// EndpointRegistry holds the documentation of each route, keyed by method
+// and path template.
+type EndpointRegistry map[string]Endpoint
+
+// Register adds the documentation for a route.
+func (reg EndpointRegistry) Register(method, path, description string, params ...RouteParam) {
+	reg[method+" "+path] = Endpoint{Path: path, Method: method, Description: description, Params: params}
+}
+
+// lookup returns the documentation for a route, or a bare entry when the
+// route has not been documented.
+func (reg EndpointRegistry) lookup(method, path string) Endpoint {
+	if e, ok := reg[method+" "+path]; ok {
+		return e
+	}
+	return Endpoint{Path: path, Method: method}
+}
+
+// endpoints documents the routes registered in newRouter.
+var endpoints = EndpointRegistry{}
+
+func init() {
+	from := RouteParam{Name: "from", Type: "date"}
+	endpoints.Register("GET", "/admin/reconcile/{ticker}", "Compares the cached close prices of a ticker with Yahoo Finance",
+		RouteParam{Name: "date", Type: "date", Required: true})
+	endpoints.Register("GET", "/admin/share", "Returns a signed link to a report",
+		RouteParam{Name: "symbol", Type: "string", Required: true},
+		RouteParam{Name: "ttl_hours", Type: "integer"})
+	endpoints.Register("POST", "/admin/snapshot", "Writes the index series of a fund to the snapshot bucket",
+		RouteParam{Name: "symbol", Type: "string", Required: true})
+	endpoints.Register("GET", "/admin/error-budget", "Returns the share of requests that succeeded against the error rate SLO",
+		RouteParam{Name: "window", Type: "string"})
+	endpoints.Register("GET", "/routes", "Lists the endpoints of the service")
+	endpoints.Register("GET", "/health", "Liveness probe")
+	endpoints.Register("GET", "/ready", "Readiness probe, checking that the cache directory is accessible")
+	endpoints.Register("GET", "/status", "Returns the number of requests served and recent latency percentiles")
+	endpoints.Register("GET", "/metrics", "Returns Prometheus metrics")
+	endpoints.Register("GET", "/healthz/cache", "Returns statistics about the cache directory")
+	endpoints.Register("GET", "/blend", "Returns an index for a custom mix of tickers", from)
+	endpoints.Register("GET", "/chart-data", "Returns funds and tickers rebased to the same start date in the Chart.js format",
+		RouteParam{Name: "symbols", Type: "string", Required: true},
+		from)
+	endpoints.Register("GET", "/raw-comparison", "Returns raw ticker prices rebased to the same start date in the Chart.js format",
+		RouteParam{Name: "tickers", Type: "string", Required: true},
+		from)
+	endpoints.Register("GET", "/fundamentals/{symbol}", "Returns an estimated WACC for the equity component of the fund")
+	endpoints.Register("GET", "/quality/{symbol}", "Reports data quality issues of the fund such as survivorship bias")
+	endpoints.Register("GET", "/compare", "Returns two funds normalised to 100 on their first shared date",
+		RouteParam{Name: "a", Type: "string", Required: true},
+		RouteParam{Name: "b", Type: "string", Required: true},
+		from,
+		RouteParam{Name: "to", Type: "date"})
+	endpoints.Register("GET", "/universe", "Returns every fund rebased to the same start date with summary statistics", from)
+	endpoints.Register("GET", "/{symbol}/backtest/period", "Returns the fund returns over rolling windows",
+		from,
+		RouteParam{Name: "period", Type: "period"},
+		RouteParam{Name: "step", Type: "period"})
+	endpoints.Register("GET", "/{symbol}/mom", "Returns the multiple of money since each start date", from)
+	endpoints.Register("GET", "/{symbol}/crossings", "Returns the dates the fund crossed a target value",
+		from,
+		RouteParam{Name: "target", Type: "number", Required: true})
+	endpoints.Register("GET", "/{symbol}/stats", "Returns portfolio statistics for the fund",
+		from,
+		RouteParam{Name: "risk_free_rate", Type: "number"},
+		RouteParam{Name: "exclude_outliers", Type: "boolean"},
+		RouteParam{Name: "recovery", Type: "boolean"},
+		RouteParam{Name: "recovery_ratio", Type: "boolean"},
+		RouteParam{Name: "seasonality", Type: "boolean"},
+		RouteParam{Name: "streaks", Type: "boolean"})
+	endpoints.Register("GET", "/{symbol}/model", "Fits a geometric Brownian motion to the fund index", from)
+	endpoints.Register("GET", "/{symbol}/montecarlo", "Projects the fund index with simulated geometric Brownian motion paths",
+		RouteParam{Name: "simulations", Type: "integer"},
+		RouteParam{Name: "horizon", Type: "integer"},
+		RouteParam{Name: "seed", Type: "integer"},
+		from)
+	endpoints.Register("GET", "/{symbol}/impact", "Compares the fund with another weight for one component",
+		RouteParam{Name: "component", Type: "string", Required: true},
+		RouteParam{Name: "new_weight", Type: "number", Required: true},
+		from)
+	endpoints.Register("GET", "/{symbol}/dca", "Simulates monthly and annual contributions to the fund",
+		RouteParam{Name: "simulate_contribution", Type: "string", Required: true},
+		from)
+	endpoints.Register("DELETE", "/{symbol}/cache", "Deletes the cached prices of the fund components so that they are fetched again",
+		RouteParam{Name: "date", Type: "date"})
+	endpoints.Register("GET", "/{symbol}", "Returns blended fund index",
+		RouteParam{Name: "group_by", Type: "string"},
+		RouteParam{Name: "format", Type: "string"},
+		RouteParam{Name: "page", Type: "integer"},
+		RouteParam{Name: "page_size", Type: "integer"},
+		RouteParam{Name: "include_raw_data", Type: "boolean"},
+		RouteParam{Name: "debug", Type: "boolean"},
+		RouteParam{Name: "include_date_gaps", Type: "boolean"},
+		RouteParam{Name: "split_only", Type: "boolean"},
+		RouteParam{Name: "dividend_reinvestment", Type: "boolean"},
+		RouteParam{Name: "calendar", Type: "string"},
+		RouteParam{Name: "rebalance", Type: "string"},
+		RouteParam{Name: "tax_jurisdiction", Type: "string"},
+		RouteParam{Name: "fill_strategy", Type: "string"},
+		RouteParam{Name: "fill_business_days_only", Type: "boolean"},
+		RouteParam{Name: "offset_days", Type: "integer"},
+		RouteParam{Name: "clamp_returns", Type: "number"},
+		RouteParam{Name: "smooth", Type: "string"},
+		RouteParam{Name: "smoothing_alpha", Type: "number"},
+		RouteParam{Name: "regime", Type: "boolean"},
+		RouteParam{Name: "regime_filter", Type: "string"},
+		RouteParam{Name: "from", Type: "date"},
+		RouteParam{Name: "to", Type: "date"},
+		RouteParam{Name: "frequency", Type: "string"},
+		RouteParam{Name: "base_date", Type: "date"},
+		RouteParam{Name: "output_timezone", Type: "string"},
+		RouteParam{Name: "vol_regime", Type: "boolean"},
+		RouteParam{Name: "fill_confidence", Type: "boolean"},
+		RouteParam{Name: "threshold_alert", Type: "number"},
+		RouteParam{Name: "runup", Type: "boolean"},
+		RouteParam{Name: "volatility_30d", Type: "boolean"},
+		RouteParam{Name: "annualise_volatility", Type: "boolean"},
+		RouteParam{Name: "normalize", Type: "string"},
+		RouteParam{Name: "transforms", Type: "string"},
+		RouteParam{Name: "fields_hash", Type: "boolean"},
+		RouteParam{Name: "token", Type: "string"})
+}
+
+// routeManifest walks the router and documents every route that serves a
+// method. Routes missing from reg are listed without a description.
+func routeManifest(router *mux.Router, reg EndpointRegistry) ([]Endpoint, error) {
+	manifest := []Endpoint{}
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Path prefixes such as /admin have no methods of their own.
+			return nil
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			e := reg.lookup(method, path)
+			if e.Params == nil {
+				e.Params = []RouteParam{}
+			}
+			manifest = append(manifest, e)
+		}
+		return nil
+	})
+	return manifest, err
+}
+
+// RoutesHandler lists the endpoints registered on router.
+func RoutesHandler(router *mux.Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		manifest, err := routeManifest(router, endpoints)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error listing routes: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(manifest)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoutesHandler(t *testing.T) {
+	app := newTestApp(t)
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/routes", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rr.Code, rr.Body.String())
+	}
+	var manifest []Endpoint
+	if err := json.Unmarshal(rr.Body.Bytes(), &manifest); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	byPath := make(map[string]Endpoint)
+	for _, e := range manifest {
+		byPath[e.Method+" "+e.Path] = e
+	}
+	for _, key := range []string{"GET /admin/reconcile/{ticker}", "GET /routes", "GET /{symbol}/stats", "GET /{symbol}"} {
+		if _, ok := byPath[key]; !ok {
+			t.Errorf("manifest is missing %s", key)
+		}
+	}
+	if _, ok := byPath["/admin"]; ok {
+		t.Errorf("manifest lists the /admin path prefix")
+	}
+	index := byPath["GET /{symbol}"]
+	if index.Description != "Returns blended fund index" {
+		t.Errorf("description = %q", index.Description)
+	}
+	found := false
+	for _, p := range index.Params {
+		if p.Name == "base_date" && p.Type == "date" && !p.Required {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("params = %+v, want an optional base_date date", index.Params)
+	}
+}
+
+func TestRouteManifestUndocumented(t *testing.T) {
+	app := newTestApp(t)
+	manifest, err := routeManifest(app.newRouter(), EndpointRegistry{})
+	if err != nil {
+		t.Fatalf("routeManifest: %v", err)
+	}
+	if len(manifest) == 0 {
+		t.Fatal("manifest is empty")
+	}
+	for _, e := range manifest {
+		if e.Description != "" || e.Params == nil {
+			t.Errorf("undocumented route %s = %+v, want no description and empty params", e.Path, e)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultShareTTLHours is how long a share link is valid when the caller
+	// does not ask for a specific lifetime.
+	defaultShareTTLHours = 24
+	// maxShareTTLHours is the longest lifetime of a share link.
+	maxShareTTLHours = 30 * 24
+)
+
+// shareJWTHeader is the encoded header of every share token.
+var shareJWTHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// shareClaims is the payload of a share token: the report it grants access to
+// and its lifetime.
+type shareClaims struct {
+	Symbol    string            `json:"sym"`
+	Params    map[string]string `json:"params,omitempty"`
+	IssuedAt  int64             `json:"iat"`
+	ExpiresAt int64             `json:"exp"`
+}
+
+// ShareResponse is the response of the share link endpoint.
+type ShareResponse struct {
+	URL       string `json:"url"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// signShareToken encodes claims as an HS256 signed JWT.
+func signShareToken(claims shareClaims, key []byte) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := shareJWTHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + shareSignature(unsigned, key), nil
+}
+
+// shareSignature returns the encoded HMAC-SHA256 of the unsigned token.
+func shareSignature(unsigned string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyShareToken checks the signature and expiry of a share token and
+// returns its claims.
+func verifyShareToken(token string, key []byte, now time.Time) (shareClaims, error) {
+	var claims shareClaims
+	header, rest, ok := strings.Cut(token, ".")
+	if !ok || header != shareJWTHeader {
+		return claims, errors.New("malformed token")
+	}
+	payload, signature, ok := strings.Cut(rest, ".")
+	if !ok {
+		return claims, errors.New("malformed token")
+	}
+	if !hmac.Equal([]byte(signature), []byte(shareSignature(header+"."+payload, key))) {
+		return claims, errors.New("invalid token signature")
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return claims, errors.New("malformed token")
+	}
+	if err := json.Unmarshal(decoded, &claims); err != nil {
+		return claims, errors.New("malformed token")
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return claims, errors.New("token expired")
+	}
+	return claims, nil
+}
+
+// ShareHandler creates a link to a fund report that expires after ttl_hours,
+// e.g. /admin/share?symbol=QUARTZ9&from=2021-01-01&ttl_hours=24. Every query
+// parameter other than symbol and ttl_hours is signed into the link.
+func (a *App) ShareHandler(w http.ResponseWriter, r *http.Request) {
+	if len(a.shareSigningKey) == 0 {
+		http.Error(w, "Share links are not configured", http.StatusServiceUnavailable)
+		return
+	}
+	query := r.URL.Query()
+	symbol := strings.ToUpper(query.Get("symbol"))
+	if _, ok := lookupFund(symbol); !ok {
+		http.Error(w, "Invalid symbol", http.StatusBadRequest)
+		return
+	}
+	if _, err := optionalDateParam(r, "from"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ttlHours := defaultShareTTLHours
+	if v := query.Get("ttl_hours"); v != "" {
+		var err error
+		if ttlHours, err = strconv.Atoi(v); err != nil || ttlHours < 1 || ttlHours > maxShareTTLHours {
+			http.Error(w, fmt.Sprintf("invalid 'ttl_hours' value '%s', expected an integer between 1 and %d", v, maxShareTTLHours), http.StatusBadRequest)
+			return
+		}
+	}
+
+	params := map[string]string{}
+	for name := range query {
+		if name != "symbol" && name != "ttl_hours" && name != "token" {
+			params[name] = query.Get(name)
+		}
+	}
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(ttlHours) * time.Hour)
+	token, err := signShareToken(shareClaims{
+		Symbol:    symbol,
+		Params:    params,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	}, a.shareSigningKey)
+	if err != nil {
+		http.Error(w, "Error signing share link", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ShareResponse{
+		URL:       a.publicBaseURL(r) + "/" + symbol + "?token=" + url.QueryEscape(token),
+		ExpiresAt: expiresAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// publicBaseURL returns the configured base URL of the service, or the one the
+// request was made to.
+func (a *App) publicBaseURL(r *http.Request) string {
+	if a.shareBaseURL != "" {
+		return strings.TrimSuffix(a.shareBaseURL, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// requireValidShareToken validates the share token of requests that carry a
+// token query parameter and replaces their query with the signed parameters,
+// so that a shared link cannot be altered. Requests without a token are
+// passed through unchanged.
+func (a *App) requireValidShareToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(a.shareSigningKey) == 0 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		claims, err := verifyShareToken(token, a.shareSigningKey, time.Now())
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if !strings.EqualFold(mux.Vars(r)["symbol"], claims.Symbol) {
+			http.Error(w, "Unauthorized: token is for a different symbol", http.StatusUnauthorized)
+			return
+		}
+		query := url.Values{}
+		for name, value := range claims.Params {
+			query.Set(name, value)
+		}
+		r.URL.RawQuery = query.Encode()
+		next.ServeHTTP(w, r)
+	})
+}
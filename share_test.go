@@ -0,0 +1,127 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShareTokenRoundTrip(t *testing.T) {
+	key := []byte("signing-key")
+	now := time.Unix(1700000000, 0)
+	claims := shareClaims{
+		Symbol:    "QUARTZ9",
+		Params:    map[string]string{"from": "2021-01-01"},
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Hour).Unix(),
+	}
+	token, err := signShareToken(claims, key)
+	if err != nil {
+		t.Fatalf("signShareToken: %v", err)
+	}
+
+	got, err := verifyShareToken(token, key, now)
+	if err != nil || got.Symbol != "QUARTZ9" || got.Params["from"] != "2021-01-01" {
+		t.Errorf("verifyShareToken = %+v, %v", got, err)
+	}
+	if _, err := verifyShareToken(token, key, now.Add(time.Hour)); err == nil {
+		t.Error("expired token accepted")
+	}
+	if _, err := verifyShareToken(token, []byte("other-key"), now); err == nil {
+		t.Error("token signed with another key accepted")
+	}
+
+	// Swap in a payload for another symbol, keeping the signature.
+	parts := strings.Split(token, ".")
+	claims.Symbol = "QUARTZ5"
+	forged, _ := signShareToken(claims, []byte("attacker"))
+	parts[1] = strings.Split(forged, ".")[1]
+	if _, err := verifyShareToken(strings.Join(parts, "."), key, now); err == nil {
+		t.Error("tampered token accepted")
+	}
+	for _, malformed := range []string{"", "abc", parts[0] + ".x"} {
+		if _, err := verifyShareToken(malformed, key, now); err == nil {
+			t.Errorf("malformed token %q accepted", malformed)
+		}
+	}
+}
+
+func TestShareHandler(t *testing.T) {
+	app := newTestApp(t)
+	app.adminToken = "secret"
+	app.shareSigningKey = []byte("signing-key")
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101, 102, 103, 104))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 13, 14, 15, 16))
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://service.run.app/admin/share?symbol=quartz9&page_size=3&ttl_hours=24", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	app.newRouter().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var share ShareResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &share); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if !strings.HasPrefix(share.URL, "http://service.run.app/QUARTZ9?token=") {
+		t.Fatalf("url = %q, want a link to /QUARTZ9", share.URL)
+	}
+
+	// The shared link serves the signed parameters, whatever else is added.
+	link, _ := url.Parse(share.URL)
+	rr = httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", link.RequestURI()+"&page_size=1000", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("shared link: Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got IndexResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(got.Index) != 3 {
+		t.Errorf("shared link returned %d points, want the signed page size of 3", len(got.Index))
+	}
+
+	token := link.Query().Get("token")
+	for _, target := range []string{"/QUARTZ5?token=" + url.QueryEscape(token), "/QUARTZ9?token=garbage"} {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s: Code = %d, want %d", target, rr.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestShareHandlerInvalid(t *testing.T) {
+	app := newTestApp(t)
+	app.adminToken = "secret"
+	app.shareSigningKey = []byte("signing-key")
+	for _, query := range []string{"symbol=QUARTZ1", "symbol=QUARTZ9&ttl_hours=0", "symbol=QUARTZ9&from=2021-02-30"} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/admin/share?"+query, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		app.newRouter().ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: Code = %d, want %d", query, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultShutdownTimeout is how long in-flight requests are given to complete
+// on shutdown unless SHUTDOWN_TIMEOUT_SECONDS is set. Cloud Run gives apps 10
+// seconds to shutdown. See
+// https://cloud.google.com/blog/topics/developers-practitioners/graceful-shutdowns-cloud-run-deep-dive
+// for more details.
+const defaultShutdownTimeout = 10 * time.Second
+
+// shutdownTimeout parses SHUTDOWN_TIMEOUT_SECONDS, falling back to
+// defaultShutdownTimeout when v is empty or not a positive number of seconds.
+func shutdownTimeout(v string) time.Duration {
+	seconds, err := strconv.Atoi(v)
+	if err != nil || seconds <= 0 {
+		return defaultShutdownTimeout
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// shutdownServers stops the servers from accepting connections and waits up
+// to timeout for their in-flight requests to complete.
+func shutdownServers(timeout time.Duration, servers ...*http.Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var errs []error
+	for _, srv := range servers {
+		errs = append(errs, srv.Shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
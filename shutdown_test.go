@@ -0,0 +1,94 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestShutdownTimeout(t *testing.T) {
+	tests := map[string]time.Duration{
+		"":    defaultShutdownTimeout,
+		"30":  30 * time.Second,
+		"0":   defaultShutdownTimeout,
+		"-5":  defaultShutdownTimeout,
+		"1.5": defaultShutdownTimeout,
+		"ten": defaultShutdownTimeout,
+	}
+	for v, want := range tests {
+		if got := shutdownTimeout(v); got != want {
+			t.Errorf("shutdownTimeout(%q) = %s, want %s", v, got, want)
+		}
+	}
+}
+
+func TestShutdownServersWaitsForSlowHandler(t *testing.T) {
+	sigctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	started := make(chan struct{})
+	notified := make(chan bool, 1)
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			select {
+			case <-r.Context().Done():
+				notified <- true
+			case <-time.After(time.Second):
+				notified <- false
+			}
+			time.Sleep(100 * time.Millisecond)
+			io.WriteString(w, "done")
+		}),
+		BaseContext: func(net.Listener) context.Context { return sigctx },
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	go srv.Serve(ln)
+
+	type result struct {
+		body string
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		results <- result{string(body), err}
+	}()
+	<-started
+
+	stop()
+	if err := shutdownServers(2*time.Second, srv); err != nil {
+		t.Fatalf("shutdownServers: %v", err)
+	}
+	if !<-notified {
+		t.Error("handler context was not cancelled on shutdown")
+	}
+	if res := <-results; res.err != nil || res.body != "done" {
+		t.Errorf("response = %q, %v, want done", res.body, res.err)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// snapshotTimestampFormat names snapshot objects so that they sort by time.
+const snapshotTimestampFormat = "20060102T150405Z"
+
+// errNoSnapshot is returned when no snapshot has been written for a symbol.
+var errNoSnapshot = errors.New("no snapshot available")
+
+// SnapshotStore keeps snapshots of the index series for disaster recovery.
+type SnapshotStore interface {
+	// Write stores data under name.
+	Write(ctx context.Context, name string, data []byte) error
+	// Latest returns the object with the greatest name under prefix, or
+	// errNoSnapshot when there is none.
+	Latest(ctx context.Context, prefix string) ([]byte, error)
+}
+
+// gcsSnapshotStore keeps snapshots in a Cloud Storage bucket.
+type gcsSnapshotStore struct {
+	bucket *storage.BucketHandle
+}
+
+func newGCSSnapshotStore(ctx context.Context, bucket string) (*gcsSnapshotStore, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &gcsSnapshotStore{bucket: client.Bucket(bucket)}, nil
+}
+
+// Write implements SnapshotStore.
+func (s *gcsSnapshotStore) Write(ctx context.Context, name string, data []byte) error {
+	w := s.bucket.Object(name).NewWriter(ctx)
+	w.ContentType = "application/json"
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// Latest implements SnapshotStore.
+func (s *gcsSnapshotStore) Latest(ctx context.Context, prefix string) ([]byte, error) {
+	latest := ""
+	it := s.bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		latest = max(latest, attrs.Name)
+	}
+	if latest == "" {
+		return nil, errNoSnapshot
+	}
+	r, err := s.bucket.Object(latest).NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// snapshotPrefix is the prefix of the snapshot objects of symbol.
+func snapshotPrefix(symbol string) string {
+	return "snapshots/" + symbol + "/"
+}
+
+// snapshotObjectName is the name of the snapshot of symbol taken at t.
+func snapshotObjectName(symbol string, t time.Time) string {
+	return snapshotPrefix(symbol) + t.UTC().Format(snapshotTimestampFormat) + ".json"
+}
+
+// indexSnapshots holds the precomputed index series of each fund in memory.
+// A nil value is valid and never holds any series.
+type indexSnapshots struct {
+	mu     sync.RWMutex
+	series map[string][]IndexData
+}
+
+func newIndexSnapshots() *indexSnapshots {
+	return &indexSnapshots{series: make(map[string][]IndexData)}
+}
+
+// Get returns the series kept for symbol. It must not be modified.
+func (s *indexSnapshots) Get(symbol string) ([]IndexData, bool) {
+	if s == nil {
+		return nil, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	series, ok := s.series[symbol]
+	return series, ok
+}
+
+// Set keeps series for symbol.
+func (s *indexSnapshots) Set(symbol string, series []IndexData) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.series[symbol] = series
+}
+
+// SnapshotResult describes a snapshot written by SnapshotHandler.
+type SnapshotResult struct {
+	Symbol string `json:"symbol"`
+	Object string `json:"object"`
+	Points int    `json:"points"`
+}
+
+// SnapshotHandler computes the index series of a fund, keeps it in memory
+// and writes it to the snapshot bucket.
+func (a *App) SnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	if a.snapshotStore == nil {
+		http.Error(w, "Snapshots are not configured", http.StatusServiceUnavailable)
+		return
+	}
+	symbol := r.URL.Query().Get("symbol")
+	fund, ok := lookupFund(symbol)
+	if !ok {
+		http.Error(w, "Invalid symbol", http.StatusBadRequest)
+		return
+	}
+	series, err := a.computeIndexSeries(r.Context(), fund, "", indexOptions{})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error computing index series: %v", err), http.StatusBadGateway)
+		return
+	}
+	data, err := json.Marshal(series)
+	if err != nil {
+		http.Error(w, "Error encoding snapshot", http.StatusInternalServerError)
+		return
+	}
+	name := snapshotObjectName(symbol, time.Now())
+	if err := a.snapshotStore.Write(r.Context(), name, data); err != nil {
+		http.Error(w, fmt.Sprintf("Error writing snapshot: %v", err), http.StatusBadGateway)
+		return
+	}
+	a.snapshots.Set(symbol, series)
+	a.log.Log(logging.Entry{
+		Severity: logging.Info,
+		Payload:  fmt.Sprintf("wrote snapshot %s with %d points", name, len(series)),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SnapshotResult{Symbol: symbol, Object: name, Points: len(series)})
+}
+
+// loadSnapshots reads the latest snapshot of every fund into memory. Funds
+// without a snapshot are skipped.
+func (a *App) loadSnapshots(ctx context.Context) error {
+	for _, symbol := range fundSymbols {
+		data, err := a.snapshotStore.Latest(ctx, snapshotPrefix(symbol))
+		if errors.Is(err, errNoSnapshot) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read snapshot of %s: %w", symbol, err)
+		}
+		var series []IndexData
+		if err := json.Unmarshal(data, &series); err != nil {
+			return fmt.Errorf("unable to decode snapshot of %s: %w", symbol, err)
+		}
+		a.snapshots.Set(symbol, series)
+	}
+	return nil
+}
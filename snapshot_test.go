@@ -0,0 +1,117 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSnapshotStore keeps snapshots in memory.
+type fakeSnapshotStore struct {
+	objects map[string][]byte
+}
+
+func (s *fakeSnapshotStore) Write(ctx context.Context, name string, data []byte) error {
+	s.objects[name] = data
+	return nil
+}
+
+func (s *fakeSnapshotStore) Latest(ctx context.Context, prefix string) ([]byte, error) {
+	latest := ""
+	for name := range s.objects {
+		if strings.HasPrefix(name, prefix) {
+			latest = max(latest, name)
+		}
+	}
+	if latest == "" {
+		return nil, errNoSnapshot
+	}
+	return s.objects[latest], nil
+}
+
+func TestSnapshotObjectName(t *testing.T) {
+	got := snapshotObjectName("QUARTZ9", time.Date(2024, 3, 1, 12, 30, 5, 0, time.UTC))
+	if want := "snapshots/QUARTZ9/20240301T123005Z.json"; got != want {
+		t.Errorf("snapshotObjectName = %q, want %q", got, want)
+	}
+}
+
+func TestSnapshotHandler(t *testing.T) {
+	app := newTestApp(t)
+	app.adminToken = "secret"
+	app.snapshots = newIndexSnapshots()
+	store := &fakeSnapshotStore{objects: map[string][]byte{}}
+	app.snapshotStore = store
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", false, 100, 101, 102))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12))
+
+	req := httptest.NewRequest("POST", "/admin/snapshot?symbol=QUARTZ9", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var result SnapshotResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if result.Points != 3 || !strings.HasPrefix(result.Object, "snapshots/QUARTZ9/") {
+		t.Errorf("result = %+v, want 3 points under snapshots/QUARTZ9/", result)
+	}
+	if _, ok := store.objects[result.Object]; !ok {
+		t.Errorf("snapshot %s was not written", result.Object)
+	}
+
+	// A restarted instance loads the snapshot and serves it while the
+	// components cannot be fetched.
+	restarted := newTestApp(t)
+	restarted.eodBaseURL = "http://127.0.0.1:0"
+	restarted.snapshots = newIndexSnapshots()
+	restarted.snapshotStore = store
+	if err := restarted.loadSnapshots(context.Background()); err != nil {
+		t.Fatalf("loadSnapshots: %v", err)
+	}
+	if series, ok := restarted.snapshots.Get("QUARTZ9"); !ok || len(series) != 3 {
+		t.Fatalf("loaded snapshot = %+v, want 3 points", series)
+	}
+	if _, ok := restarted.snapshots.Get("QUARTZ7"); ok {
+		t.Error("QUARTZ7 has a snapshot but none was written")
+	}
+	rr = httptest.NewRecorder()
+	restarted.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ9", nil))
+	var got IndexResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if len(got.Index) != 3 || len(got.Errors) == 0 {
+		t.Errorf("index = %d points with errors %+v, want the 3 snapshot points and the component errors", len(got.Index), got.Errors)
+	}
+}
+
+func TestSnapshotHandlerNotConfigured(t *testing.T) {
+	app := newTestApp(t)
+	rr := httptest.NewRecorder()
+	app.SnapshotHandler(rr, httptest.NewRequest("POST", "/admin/snapshot?symbol=QUARTZ9", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Code = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+}
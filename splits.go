@@ -0,0 +1,137 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Split is a stock split as reported by the EODHD splits API, e.g.
+// {"date":"2014-06-09","split":"7.000000/1.000000"}.
+type Split struct {
+	Date  string `json:"date"`
+	Split string `json:"split"`
+}
+
+// ratio returns the number of new shares issued per old share.
+func (s Split) ratio() (float64, error) {
+	newShares, oldShares, ok := strings.Cut(s.Split, "/")
+	if !ok {
+		return 0, fmt.Errorf("invalid split %q", s.Split)
+	}
+	n, err := strconv.ParseFloat(newShares, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid split %q", s.Split)
+	}
+	o, err := strconv.ParseFloat(oldShares, 64)
+	if err != nil || n <= 0 || o <= 0 {
+		return 0, fmt.Errorf("invalid split %q", s.Split)
+	}
+	return n / o, nil
+}
+
+// splitCacheSymbol is the name under which the split history of symbol is
+// cached, so that it is kept apart from the prices of symbol.
+func splitCacheSymbol(symbol string) string {
+	return "splits/" + symbol
+}
+
+// PrepareSplitData returns the split history of symbol. Like the price data
+// it is cached once per day in the cache backend, under
+// splits/{symbol}/{date}.json. Crypto tickers never split and are not looked
+// up.
+func (a *App) PrepareSplitData(ctx context.Context, symbol string) ([]Split, error) {
+	if strings.HasSuffix(symbol, ".CC") {
+		return nil, nil
+	}
+	cache, cacheSymbol := a.cache(), splitCacheSymbol(symbol)
+	today := time.Now().UTC().Format(time.DateOnly)
+
+	// The backend discards split data that no longer matches its checksum
+	body, err := cache.Read(cacheSymbol, today)
+	if errors.Is(err, errChecksumMismatch) {
+		a.logCorruptCache(ctx, cache.Location(cacheSymbol, today), err)
+		err = fs.ErrNotExist
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		body, err = a.fetchEOD(ctx, a.eodBaseURL+"/splits/"+symbol+"?fmt=json&from="+fundInceptionDate)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errUpstreamUnavailable, err)
+		}
+		if err := cache.Write(cacheSymbol, today, body); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	var splits []Split
+	if err := json.Unmarshal(body, &splits); err != nil {
+		return nil, err
+	}
+	return splits, nil
+}
+
+// applySplitAdjustment sets SplitAdjClose on every data point: the raw close
+// divided by the combined ratio of the splits that happened after that date.
+// Unlike adjusted_close, dividends are not reinvested.
+func applySplitAdjustment(stockData []StockData, splits []Split) ([]StockData, error) {
+	ratios := make([]float64, len(splits))
+	for i, split := range splits {
+		ratio, err := split.ratio()
+		if err != nil {
+			return nil, err
+		}
+		ratios[i] = ratio
+	}
+	adjusted := make([]StockData, len(stockData))
+	for i, data := range stockData {
+		factor := 1.0
+		for j, split := range splits {
+			// The split takes effect on its date, so the close of that day is
+			// already post-split.
+			if split.Date != data.Date && maxDateStr(split.Date, data.Date) == split.Date {
+				factor *= ratios[j]
+			}
+		}
+		data.SplitAdjClose = data.Close / factor
+		adjusted[i] = data
+	}
+	return adjusted, nil
+}
+
+// splitOnlySeries returns a copy of stockData that uses the split adjusted
+// close in place of the split and dividend adjusted close.
+func (a *App) splitOnlySeries(ctx context.Context, symbol string, stockData []StockData) ([]StockData, error) {
+	splits, err := a.PrepareSplitData(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+	adjusted, err := applySplitAdjustment(stockData, splits)
+	if err != nil {
+		return nil, err
+	}
+	for i := range adjusted {
+		adjusted[i].AdjClose = adjusted[i].SplitAdjClose
+	}
+	return adjusted, nil
+}
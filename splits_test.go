@@ -0,0 +1,180 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestApplySplitAdjustment(t *testing.T) {
+	// A 2-for-1 split on the third day halves the raw close.
+	data := fixtureSeries("2021-01-04", true, 100, 104, 52, 53)
+	splits := []Split{{Date: "2021-01-06", Split: "2.000000/1.000000"}}
+	got, err := applySplitAdjustment(data, splits)
+	if err != nil {
+		t.Fatalf("applySplitAdjustment: %v", err)
+	}
+	want := []float64{50, 52, 52, 53}
+	for i, w := range want {
+		if got[i].SplitAdjClose != w {
+			t.Errorf("%s: SplitAdjClose = %v, want %v", got[i].Date, got[i].SplitAdjClose, w)
+		}
+	}
+	if data[0].SplitAdjClose != 0 {
+		t.Error("applySplitAdjustment modified its input")
+	}
+	if _, err := applySplitAdjustment(data, []Split{{Date: "2021-01-06", Split: "2"}}); err == nil {
+		t.Error("applySplitAdjustment accepted an invalid split ratio")
+	}
+}
+
+func TestHandlerSplitOnly(t *testing.T) {
+	app := newTestApp(t)
+	// VOO splits 2-for-1 on 2019-01-04; adjusted_close already reflects it,
+	// close does not.
+	voo := fixtureSeries("2019-01-02", true, 200, 200, 100, 100, 100)
+	for i := range voo {
+		voo[i].AdjClose = 100
+	}
+	writeFixture(t, app, "VOO.US", voo)
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 10, 10, 10, 10, 10, 10))
+
+	dir := filepath.Join(app.bucketCacheDirectory, "splits", "VOO.US")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatalf("os.MkdirAll: %v", err)
+	}
+	splits := `[{"date":"2019-01-04","split":"2.000000/1.000000"}]`
+	if err := os.WriteFile(filepath.Join(dir, time.Now().UTC().Format(time.DateOnly)+".json"), []byte(splits), 0o644); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "http://example.com/QUARTZ9?split_only=true", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got []IndexData
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	for _, data := range got {
+		if !almostEqual(data.AdjClose, 100) {
+			t.Errorf("%s: index = %v, want 100", data.Date, data.AdjClose)
+		}
+	}
+}
+
+func TestHandlerDividendReinvestment(t *testing.T) {
+	app := newTestApp(t)
+	// VOO pays a dividend of 2 going ex on 2019-01-04. adjusted_close scales
+	// the prices before that date by 99/101, close drops on the ex-date.
+	closes := []float64{100, 101, 99, 100, 101}
+	voo := fixtureSeries("2019-01-02", false, closes...)
+	for i := range voo {
+		if i < 2 {
+			voo[i].AdjClose = closes[i] * 99 / 101
+		}
+	}
+	writeFixture(t, app, "VOO.US", voo)
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 10, 10, 10, 10))
+	dir := filepath.Join(app.bucketCacheDirectory, "splits", "VOO.US")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatalf("os.MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, time.Now().UTC().Format(time.DateOnly)+".json"), []byte("[]"), 0o644); err != nil {
+		t.Fatalf("os.WriteFile: %v", err)
+	}
+
+	get := func(query string) []IndexData {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ9?"+query, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: Code = %d, want %d: %s", query, rr.Code, http.StatusOK, rr.Body)
+		}
+		var got []IndexData
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatalf("json.Unmarshal: %v", err)
+		}
+		return got
+	}
+	total, priceOnly := get("dividend_reinvestment=true"), get("dividend_reinvestment=false")
+	if len(total) != len(priceOnly) || len(total) != len(closes) {
+		t.Fatalf("len = %d, %d, want %d", len(total), len(priceOnly), len(closes))
+	}
+	// The ETF itself never returns less with dividends reinvested.
+	etf, err := app.splitOnlySeries(context.Background(), "VOO.US", voo)
+	if err != nil {
+		t.Fatalf("splitOnlySeries: %v", err)
+	}
+	for i := range etf {
+		totalReturn, priceReturn := voo[i].AdjClose/voo[0].AdjClose, etf[i].AdjClose/etf[0].AdjClose
+		if totalReturn < priceReturn-1e-12 {
+			t.Errorf("%s: total return %v below price-only %v", etf[i].Date, totalReturn, priceReturn)
+		}
+	}
+	// Price-only: (0.9*101 + 1) / (0.9*100 + 1).
+	if last := priceOnly[len(priceOnly)-1].AdjClose; !almostEqual(last, 91.9/91*100) {
+		t.Errorf("last price-only value = %v, want %v", last, 91.9/91*100)
+	}
+	if total[len(total)-1].AdjClose <= priceOnly[len(priceOnly)-1].AdjClose {
+		t.Error("total return does not exceed price-only after the dividend")
+	}
+
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ9?dividend_reinvestment=true&split_only=true", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("contradicting options: Code = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestPrepareSplitDataCacheBackend(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`[{"date":"2019-01-04","split":"2.000000/1.000000"}]`))
+	}))
+	t.Cleanup(srv.Close)
+	app := newTestApp(t)
+	app.eodBaseURL = srv.URL
+	backend := &memoryCacheBackend{objects: map[string][]byte{}}
+	app.cacheBackend = backend
+
+	for range 2 {
+		splits, err := app.PrepareSplitData(context.Background(), "VOO.US")
+		if err != nil || len(splits) != 1 {
+			t.Fatalf("PrepareSplitData = %+v, %v, want one split", splits, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("EOD API calls = %d, want 1", calls)
+	}
+	today := time.Now().UTC().Format(time.DateOnly)
+	if _, err := backend.Read(splitCacheSymbol("VOO.US"), today); err != nil {
+		t.Errorf("split data was not cached in the backend: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(app.bucketCacheDirectory, "splits")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("split data was written to the cache directory: %v", err)
+	}
+}
@@ -0,0 +1,520 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// tradingDaysPerYear is used to annualise daily statistics.
+	tradingDaysPerYear = 252
+	// defaultRiskFreeRate is the annual risk-free rate used for the Sharpe
+	// ratio when the caller does not provide one.
+	defaultRiskFreeRate = 0.05
+	// outlierZScore is the daily return z-score above which a point is
+	// treated as a data error by ?exclude_outliers=true.
+	outlierZScore = 4.0
+	// maxCalmarRatio is reported as the Calmar ratio of a growing series
+	// without any drawdown, whose ratio would otherwise be infinite.
+	maxCalmarRatio = 100.0
+)
+
+// PortfolioStats holds the risk and return metrics of an index series.
+type PortfolioStats struct {
+	CAGRPct          float64 `json:"cagr_pct"`
+	VolatilityAnnPct float64 `json:"volatility_ann_pct"`
+	MaxDrawdownPct   float64 `json:"max_drawdown_pct"`
+	// MaxDrawdownStart and MaxDrawdownEnd are the peak and trough dates of
+	// the largest drawdown, empty without any drawdown.
+	MaxDrawdownStart string  `json:"max_drawdown_start,omitempty"`
+	MaxDrawdownEnd   string  `json:"max_drawdown_end,omitempty"`
+	SharpeRatio      float64 `json:"sharpe_ratio"`
+	VaR95Pct         float64 `json:"var_95_pct"`
+	CVaR95Pct        float64 `json:"cvar_95_pct"`
+	CalmarRatio      float64 `json:"calmar_ratio"`
+	OutliersRemoved  int     `json:"outliers_removed,omitempty"`
+
+	RecoveryPeriods []DrawdownPeriod `json:"recovery_periods,omitempty"`
+	// RecoveryRatio is the fraction of the maximum drawdown recovered by the
+	// last date.
+	RecoveryRatio *float64 `json:"recovery_ratio,omitempty"`
+
+	// Seasonality is the average return in percent of each calendar month,
+	// and SeasonalityStdDev the standard deviation of those returns.
+	Seasonality       map[string]float64 `json:"seasonality,omitempty"`
+	SeasonalityStdDev map[string]float64 `json:"seasonality_std_dev,omitempty"`
+
+	Streaks *Streaks `json:"streaks,omitempty"`
+}
+
+// Streaks holds the longest runs of consecutive up and down days of an index
+// series, and the run it ends on. A day without any change ends a run.
+type Streaks struct {
+	MaxConsecutiveGains  int `json:"max_consecutive_gains"`
+	MaxConsecutiveLosses int `json:"max_consecutive_losses"`
+	CurrentStreak        int `json:"current_streak"`
+	// CurrentStreakDirection is "up", "down" or "flat" when the last day
+	// did not change.
+	CurrentStreakDirection string `json:"current_streak_direction"`
+}
+
+// DrawdownPeriod is a decline of the index from a peak and its recovery back
+// to that peak. RecoveryDate and RecoveryDays are null while the index has not
+// recovered yet.
+type DrawdownPeriod struct {
+	PeakDate     string  `json:"peak_date"`
+	TroughDate   string  `json:"trough_date"`
+	RecoveryDate *string `json:"recovery_date"`
+	DrawdownPct  float64 `json:"drawdown_pct"`
+	// RecoveryDays is the number of calendar days from the trough to the
+	// recovery.
+	RecoveryDays *int `json:"recovery_days"`
+}
+
+// StatsHandler returns the portfolio statistics of a fund.
+func (a *App) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	symbol := strings.ToUpper(mux.Vars(r)["symbol"])
+	fund, ok := lookupFund(symbol)
+	if !ok {
+		http.Error(w, "Invalid symbol", http.StatusBadRequest)
+		return
+	}
+
+	from, err := optionalDateParam(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rfRate := defaultRiskFreeRate
+	if v := r.URL.Query().Get("risk_free_rate"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			http.Error(w, "Invalid risk_free_rate", http.StatusBadRequest)
+			return
+		}
+		rfRate = parsed
+	}
+
+	excludeOutliers, err := parseBoolParam(r, "exclude_outliers")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recovery, err := parseBoolParam(r, "recovery")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recoveryRatio, err := parseBoolParam(r, "recovery_ratio")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	seasonality, err := parseBoolParam(r, "seasonality")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	streaks, err := parseBoolParam(r, "streaks")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	series, err := a.computeIndexSeries(r.Context(), fund, from, indexOptions{})
+	if err != nil {
+		http.Error(w, "Error computing index series", http.StatusInternalServerError)
+		return
+	}
+
+	removed := 0
+	if excludeOutliers {
+		series, removed = removeOutliers(series, outlierZScore)
+	}
+	stats := computePortfolioStats(series, rfRate)
+	stats.OutliersRemoved = removed
+	if recovery {
+		stats.RecoveryPeriods = computeRecoveryPeriods(series)
+	}
+	if recoveryRatio {
+		ratio := computeRecoveryRatio(series)
+		stats.RecoveryRatio = &ratio
+	}
+	if seasonality {
+		stats.Seasonality = computeSeasonality(series)
+		stats.SeasonalityStdDev = computeSeasonalityStdDev(series)
+	}
+	if streaks {
+		s := computeStreaks(series)
+		stats.Streaks = &s
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// computePortfolioStats computes the return and risk metrics of series. The
+// risk-free rate is an annual rate expressed as a fraction (0.05 = 5%).
+func computePortfolioStats(series []IndexData, rfRate float64) PortfolioStats {
+	var stats PortfolioStats
+	if len(series) < 2 {
+		return stats
+	}
+
+	returns := dailyReturns(series)
+	cagr := computeCAGR(series)
+	vol := stdDev(dailyLogReturns(series)) * math.Sqrt(tradingDaysPerYear)
+
+	stats.CAGRPct = cagr * 100
+	stats.VolatilityAnnPct = vol * 100
+	maxDrawdown, start, end := computeMaxDrawdownPeriod(series)
+	stats.MaxDrawdownPct = maxDrawdown * 100
+	stats.MaxDrawdownStart, stats.MaxDrawdownEnd = start, end
+	stats.CalmarRatio = computeCalmar(cagr, maxDrawdown)
+	if vol > 0 {
+		stats.SharpeRatio = (cagr - rfRate) / vol
+	}
+	stats.VaR95Pct = computeVaR(returns, 0.95) * 100
+	stats.CVaR95Pct = computeCVaR(returns, 0.95) * 100
+	return stats
+}
+
+// removeOutliers drops the points whose daily return lies more than
+// zscoreThreshold standard deviations from the mean daily return. Returns are
+// measured against the last point that was kept, so a single bad print does
+// not also remove the day after it. It returns the cleaned series and the
+// number of removed points.
+func removeOutliers(series []IndexData, zscoreThreshold float64) ([]IndexData, int) {
+	returns := dailyReturns(series)
+	m, sd := mean(returns), stdDev(returns)
+	if len(series) < 3 || sd == 0 {
+		return series, 0
+	}
+
+	cleaned := []IndexData{series[0]}
+	for _, data := range series[1:] {
+		prev := cleaned[len(cleaned)-1].AdjClose
+		if prev != 0 && math.Abs((data.AdjClose/prev-1-m)/sd) > zscoreThreshold {
+			continue
+		}
+		cleaned = append(cleaned, data)
+	}
+	return cleaned, len(series) - len(cleaned)
+}
+
+// dailyReturns returns the simple period-over-period returns of series.
+func dailyReturns(series []IndexData) []float64 {
+	if len(series) < 2 {
+		return nil
+	}
+	returns := make([]float64, 0, len(series)-1)
+	for i := 1; i < len(series); i++ {
+		if series[i-1].AdjClose == 0 {
+			continue
+		}
+		returns = append(returns, series[i].AdjClose/series[i-1].AdjClose-1)
+	}
+	return returns
+}
+
+// dailyLogReturns returns the period-over-period log returns of series.
+func dailyLogReturns(series []IndexData) []float64 {
+	if len(series) < 2 {
+		return nil
+	}
+	returns := make([]float64, 0, len(series)-1)
+	for i := 1; i < len(series); i++ {
+		if series[i-1].AdjClose <= 0 || series[i].AdjClose <= 0 {
+			continue
+		}
+		returns = append(returns, math.Log(series[i].AdjClose/series[i-1].AdjClose))
+	}
+	return returns
+}
+
+// computeCAGR returns the compound annual growth rate between the first and
+// last point of series, based on the calendar days between them.
+func computeCAGR(series []IndexData) float64 {
+	if len(series) < 2 || series[0].AdjClose <= 0 {
+		return 0
+	}
+	first, err := time.Parse(time.DateOnly, series[0].Date)
+	if err != nil {
+		return 0
+	}
+	last, err := time.Parse(time.DateOnly, series[len(series)-1].Date)
+	if err != nil || !last.After(first) {
+		return 0
+	}
+	years := last.Sub(first).Hours() / 24 / 365.25
+	return math.Pow(series[len(series)-1].AdjClose/series[0].AdjClose, 1/years) - 1
+}
+
+// computeMaxDrawdown returns the largest peak-to-trough decline of series as a
+// negative fraction (-0.35 = -35%).
+func computeMaxDrawdown(series []IndexData) float64 {
+	maxDrawdown, _, _ := computeMaxDrawdownPeriod(series)
+	return maxDrawdown
+}
+
+// computeMaxDrawdownPeriod returns the largest peak-to-trough decline of
+// series with the dates of the peak and the trough.
+func computeMaxDrawdownPeriod(series []IndexData) (maxDrawdown float64, start, end string) {
+	var peak IndexData
+	for _, data := range series {
+		if data.AdjClose > peak.AdjClose {
+			peak = data
+		}
+		if peak.AdjClose > 0 {
+			if drawdown := data.AdjClose/peak.AdjClose - 1; drawdown < maxDrawdown {
+				maxDrawdown, start, end = drawdown, peak.Date, data.Date
+			}
+		}
+	}
+	return maxDrawdown, start, end
+}
+
+// computeCalmar returns the Calmar ratio, CAGR / |max drawdown|. A series
+// without any drawdown is capped at maxCalmarRatio.
+func computeCalmar(cagr, maxDrawdown float64) float64 {
+	if maxDrawdown == 0 {
+		if cagr > 0 {
+			return maxCalmarRatio
+		}
+		return 0
+	}
+	return math.Min(cagr/math.Abs(maxDrawdown), maxCalmarRatio)
+}
+
+// computeRecoveryPeriods returns every drawdown of series, from the peak
+// before the decline to the first point back at or above that peak. A
+// drawdown that has not recovered by the end of the series is returned with a
+// null recovery.
+func computeRecoveryPeriods(series []IndexData) []DrawdownPeriod {
+	periods := []DrawdownPeriod{}
+	if len(series) == 0 {
+		return periods
+	}
+	peak := series[0]
+	var current *DrawdownPeriod
+	for _, data := range series[1:] {
+		if data.AdjClose >= peak.AdjClose {
+			if current != nil {
+				recoveryDate := data.Date
+				current.RecoveryDate = &recoveryDate
+				if days, err := daysBetween(current.TroughDate, data.Date); err == nil {
+					current.RecoveryDays = &days
+				}
+				periods = append(periods, *current)
+				current = nil
+			}
+			peak = data
+			continue
+		}
+		drawdown := (data.AdjClose/peak.AdjClose - 1) * 100
+		if current == nil {
+			current = &DrawdownPeriod{PeakDate: peak.Date}
+		}
+		if drawdown < current.DrawdownPct || current.TroughDate == "" {
+			current.TroughDate = data.Date
+			current.DrawdownPct = drawdown
+		}
+	}
+	if current != nil {
+		periods = append(periods, *current)
+	}
+	return periods
+}
+
+// computeRecoveryRatio returns the fraction of the maximum drawdown of series
+// that the last point has recovered, from 0 at the trough to 1 back at the
+// peak. A series without any drawdown, or that has recovered from its maximum
+// drawdown, returns 1.
+func computeRecoveryRatio(series []IndexData) float64 {
+	var peak, maxPeak, maxTrough float64
+	maxDrawdown := 0.0
+	for _, data := range series {
+		peak = math.Max(peak, data.AdjClose)
+		if peak > 0 {
+			if drawdown := data.AdjClose/peak - 1; drawdown < maxDrawdown {
+				maxDrawdown, maxPeak, maxTrough = drawdown, peak, data.AdjClose
+			}
+		}
+	}
+	if maxDrawdown == 0 {
+		return 1
+	}
+	last := series[len(series)-1].AdjClose
+	return math.Min(math.Max((last-maxTrough)/(maxPeak-maxTrough), 0), 1)
+}
+
+// computeStreaks returns the longest runs of consecutive gains and losses of
+// series and the run at its end.
+func computeStreaks(series []IndexData) Streaks {
+	streaks := Streaks{CurrentStreakDirection: "flat"}
+	for i := 1; i < len(series); i++ {
+		direction := "flat"
+		switch {
+		case series[i].AdjClose > series[i-1].AdjClose:
+			direction = "up"
+		case series[i].AdjClose < series[i-1].AdjClose:
+			direction = "down"
+		}
+		if direction == "flat" {
+			streaks.CurrentStreak = 0
+		} else if direction == streaks.CurrentStreakDirection {
+			streaks.CurrentStreak++
+		} else {
+			streaks.CurrentStreak = 1
+		}
+		streaks.CurrentStreakDirection = direction
+		switch direction {
+		case "up":
+			streaks.MaxConsecutiveGains = max(streaks.MaxConsecutiveGains, streaks.CurrentStreak)
+		case "down":
+			streaks.MaxConsecutiveLosses = max(streaks.MaxConsecutiveLosses, streaks.CurrentStreak)
+		}
+	}
+	return streaks
+}
+
+// monthlyReturnsByMonth groups the month-over-month returns of series, in
+// percent, by calendar month. Each month runs from the last point of the
+// previous month to its own last point, so the first month of the series is
+// not counted.
+func monthlyReturnsByMonth(series []IndexData) map[time.Month][]float64 {
+	returns := make(map[time.Month][]float64)
+	start := 0.0
+	for i, data := range series {
+		if i+1 < len(series) && series[i+1].Date[:7] == data.Date[:7] {
+			continue
+		}
+		// data is the last point of its month.
+		date, err := time.Parse(time.DateOnly, data.Date)
+		if err == nil && start != 0 {
+			returns[date.Month()] = append(returns[date.Month()], (data.AdjClose/start-1)*100)
+		}
+		start = data.AdjClose
+	}
+	return returns
+}
+
+// computeSeasonality returns the average monthly return in percent for each
+// calendar month in series, keyed by month name.
+func computeSeasonality(series []IndexData) map[string]float64 {
+	seasonality := make(map[string]float64)
+	for month, returns := range monthlyReturnsByMonth(series) {
+		seasonality[month.String()] = mean(returns)
+	}
+	return seasonality
+}
+
+// computeSeasonalityStdDev returns the standard deviation of the monthly
+// returns of each calendar month in series, keyed by month name. It is zero
+// for months that occur only once.
+func computeSeasonalityStdDev(series []IndexData) map[string]float64 {
+	stdDevs := make(map[string]float64)
+	for month, returns := range monthlyReturnsByMonth(series) {
+		stdDevs[month.String()] = stdDev(returns)
+	}
+	return stdDevs
+}
+
+// daysBetween returns the number of calendar days from a to b.
+func daysBetween(a, b string) (int, error) {
+	ta, err := time.Parse(time.DateOnly, a)
+	if err != nil {
+		return 0, err
+	}
+	tb, err := time.Parse(time.DateOnly, b)
+	if err != nil {
+		return 0, err
+	}
+	return int(tb.Sub(ta).Hours() / 24), nil
+}
+
+// computeVaR returns the historical Value at Risk of returns: the return at
+// the (1-confidence) percentile of the distribution.
+func computeVaR(returns []float64, confidence float64) float64 {
+	if len(returns) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), returns...)
+	sort.Float64s(sorted)
+	return sorted[percentileIndex(len(sorted), 1-confidence)]
+}
+
+// computeCVaR returns the Conditional Value at Risk (expected shortfall) of
+// returns: the average of all returns at or below the Value at Risk threshold.
+func computeCVaR(returns []float64, confidence float64) float64 {
+	if len(returns) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), returns...)
+	sort.Float64s(sorted)
+	return mean(sorted[:percentileIndex(len(sorted), 1-confidence)+1])
+}
+
+// percentileIndex returns the index of the p-th percentile (0 <= p <= 1) in a
+// sorted slice of length n.
+func percentileIndex(n int, p float64) int {
+	idx := int(math.Floor(p * float64(n)))
+	if idx >= n {
+		idx = n - 1
+	}
+	if idx < 0 {
+		idx = 0
+	}
+	return idx
+}
+
+// mean returns the arithmetic mean of values.
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// stdDev returns the sample standard deviation of values.
+func stdDev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	m := mean(values)
+	sum := 0.0
+	for _, v := range values {
+		sum += (v - m) * (v - m)
+	}
+	return math.Sqrt(sum / float64(len(values)-1))
+}
@@ -0,0 +1,319 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestComputeCAGR(t *testing.T) {
+	series := []IndexData{
+		{Date: "2019-01-01", AdjClose: 100},
+		{Date: "2021-01-01", AdjClose: 121},
+	}
+	want := math.Pow(1.21, 365.25/731) - 1
+	if got := computeCAGR(series); !almostEqual(got, want) {
+		t.Errorf("computeCAGR = %v, want %v", got, want)
+	}
+	if got := computeCAGR(series[:1]); got != 0 {
+		t.Errorf("computeCAGR(single point) = %v, want 0", got)
+	}
+}
+
+func TestComputeMaxDrawdown(t *testing.T) {
+	series := indexSeries("2021-01-01", 100, 120, 90, 130, 65, 70)
+	if got := computeMaxDrawdown(series); !almostEqual(got, -0.5) {
+		t.Errorf("computeMaxDrawdown = %v, want -0.5", got)
+	}
+	if got := computeMaxDrawdown(indexSeries("2021-01-01", 100, 101, 102)); got != 0 {
+		t.Errorf("computeMaxDrawdown(rising) = %v, want 0", got)
+	}
+	// The peak is 130 on the fourth day and the trough 65 on the fifth.
+	if _, start, end := computeMaxDrawdownPeriod(series); start != "2021-01-04" || end != "2021-01-05" {
+		t.Errorf("computeMaxDrawdownPeriod = %s to %s, want 2021-01-04 to 2021-01-05", start, end)
+	}
+}
+
+func TestComputeVaR(t *testing.T) {
+	var returns []float64
+	for i := 9; i >= -10; i-- {
+		returns = append(returns, float64(i)/100)
+	}
+	if got := computeVaR(returns, 0.95); !almostEqual(got, -0.09) {
+		t.Errorf("computeVaR = %v, want -0.09", got)
+	}
+	if got := computeVaR(nil, 0.95); got != 0 {
+		t.Errorf("computeVaR(nil) = %v, want 0", got)
+	}
+}
+
+func TestComputeCVaR(t *testing.T) {
+	var returns []float64
+	for i := 9; i >= -10; i-- {
+		returns = append(returns, float64(i)/100)
+	}
+	if got := computeCVaR(returns, 0.95); !almostEqual(got, -0.095) {
+		t.Errorf("computeCVaR = %v, want -0.095", got)
+	}
+	for _, confidence := range []float64{0.9, 0.95, 0.99} {
+		cvar, hvar := computeCVaR(returns, confidence), computeVaR(returns, confidence)
+		if cvar > hvar {
+			t.Errorf("confidence %v: CVaR %v > VaR %v", confidence, cvar, hvar)
+		}
+	}
+	if got := computeCVaR(nil, 0.95); got != 0 {
+		t.Errorf("computeCVaR(nil) = %v, want 0", got)
+	}
+}
+
+func TestRemoveOutliers(t *testing.T) {
+	var values []float64
+	for i := 0; i < 100; i++ {
+		// Alternate small gains and losses around a flat trend.
+		values = append(values, 100+float64(i%3))
+	}
+	values[50] = values[49] * 1.5 // injected bad print
+	series := indexSeries("2021-01-01", values...)
+
+	cleaned, removed := removeOutliers(series, outlierZScore)
+	if removed != 1 {
+		t.Fatalf("removed = %d, want 1", removed)
+	}
+	for _, data := range cleaned {
+		if data.Date == series[50].Date {
+			t.Errorf("outlier %s was not removed", data.Date)
+		}
+	}
+	if len(cleaned) != len(series)-1 {
+		t.Errorf("len(cleaned) = %d, want %d", len(cleaned), len(series)-1)
+	}
+
+	if _, removed := removeOutliers(indexSeries("2021-01-01", 100, 101, 102, 103), outlierZScore); removed != 0 {
+		t.Errorf("removed = %d from a clean series, want 0", removed)
+	}
+}
+
+func TestComputePortfolioStats(t *testing.T) {
+	series := indexSeries("2021-01-01", 100, 110, 99, 108.9)
+	stats := computePortfolioStats(series, 0.05)
+
+	returns := []float64{math.Log(1.1), math.Log(0.9), math.Log(1.1)}
+	wantVol := stdDev(returns) * math.Sqrt(252)
+	if !almostEqual(stats.VolatilityAnnPct, wantVol*100) {
+		t.Errorf("VolatilityAnnPct = %v, want %v", stats.VolatilityAnnPct, wantVol*100)
+	}
+	if !almostEqual(stats.MaxDrawdownPct, -10) {
+		t.Errorf("MaxDrawdownPct = %v, want -10", stats.MaxDrawdownPct)
+	}
+	if stats.MaxDrawdownStart != "2021-01-02" || stats.MaxDrawdownEnd != "2021-01-03" {
+		t.Errorf("max drawdown from %s to %s, want 2021-01-02 to 2021-01-03", stats.MaxDrawdownStart, stats.MaxDrawdownEnd)
+	}
+	if want := (stats.CAGRPct/100 - 0.05) / wantVol; !almostEqual(stats.SharpeRatio, want) {
+		t.Errorf("SharpeRatio = %v, want %v", stats.SharpeRatio, want)
+	}
+	if !almostEqual(stats.VaR95Pct, -10) {
+		t.Errorf("VaR95Pct = %v, want -10", stats.VaR95Pct)
+	}
+	if stats.CVaR95Pct > stats.VaR95Pct {
+		t.Errorf("CVaR95Pct = %v, want <= VaR95Pct %v", stats.CVaR95Pct, stats.VaR95Pct)
+	}
+	if got := computePortfolioStats(series[:1], 0.05); !reflect.DeepEqual(got, PortfolioStats{}) {
+		t.Errorf("computePortfolioStats(single point) = %+v, want zero value", got)
+	}
+}
+
+func TestStatsHandler(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101, 99, 103, 104))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 9, 14, 15, 16))
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/QUARTZ9/stats", http.StatusOK},
+		{"/QUARTZ9/stats?from=2019-01-04", http.StatusOK},
+		{"/QUARTZ9/stats?from=yesterday", http.StatusBadRequest},
+		{"/QUARTZ9/stats?exclude_outliers=true", http.StatusOK},
+		{"/QUARTZ9/stats?exclude_outliers=maybe", http.StatusBadRequest},
+		{"/QUARTZ9/stats?streaks=true", http.StatusOK},
+		{"/QUARTZ9/stats?streaks=maybe", http.StatusBadRequest},
+		{"/QUARTZ9/stats?recovery_ratio=true", http.StatusOK},
+		{"/QUARTZ9/stats?recovery_ratio=maybe", http.StatusBadRequest},
+		{"/QUARTZ1/stats", http.StatusBadRequest},
+	}
+	for _, tc := range tests {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", tc.target, nil))
+		if rr.Code != tc.want {
+			t.Errorf("GET %s: Code = %d, want %d", tc.target, rr.Code, tc.want)
+			continue
+		}
+		if rr.Code != http.StatusOK {
+			continue
+		}
+		var stats PortfolioStats
+		if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+			t.Errorf("GET %s: json.Unmarshal: %v", tc.target, err)
+		}
+		if stats.MaxDrawdownPct >= 0 {
+			t.Errorf("GET %s: MaxDrawdownPct = %v, want negative", tc.target, stats.MaxDrawdownPct)
+		}
+		for name, v := range map[string]float64{"cagr": stats.CAGRPct, "volatility": stats.VolatilityAnnPct, "sharpe": stats.SharpeRatio} {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				t.Errorf("GET %s: %s = %v, want a finite value", tc.target, name, v)
+			}
+		}
+		if stats.MaxDrawdownStart == "" || stats.MaxDrawdownEnd == "" {
+			t.Errorf("GET %s: max drawdown dates = %q, %q, want both set", tc.target, stats.MaxDrawdownStart, stats.MaxDrawdownEnd)
+		}
+	}
+}
+
+func TestComputeRecoveryPeriods(t *testing.T) {
+	// Peak of 120 on day 2, trough of 90 on day 4, recovered on day 7. The
+	// second drawdown from 130 has not recovered by the end of the series.
+	series := indexSeries("2021-01-01", 100, 120, 100, 90, 110, 115, 125, 130, 117)
+	got := computeRecoveryPeriods(series)
+	if len(got) != 2 {
+		t.Fatalf("len = %d, want 2: %+v", len(got), got)
+	}
+
+	first := got[0]
+	if first.PeakDate != "2021-01-02" || first.TroughDate != "2021-01-04" || !almostEqual(first.DrawdownPct, -25) {
+		t.Errorf("first period = %+v, want peak 2021-01-02, trough 2021-01-04, -25%%", first)
+	}
+	if first.RecoveryDate == nil || *first.RecoveryDate != "2021-01-07" {
+		t.Errorf("first recovery date = %v, want 2021-01-07", first.RecoveryDate)
+	}
+	if first.RecoveryDays == nil || *first.RecoveryDays != 3 {
+		t.Errorf("first recovery days = %v, want 3", first.RecoveryDays)
+	}
+
+	second := got[1]
+	if second.PeakDate != "2021-01-08" || !almostEqual(second.DrawdownPct, -10) {
+		t.Errorf("second period = %+v, want peak 2021-01-08, -10%%", second)
+	}
+	if second.RecoveryDate != nil || second.RecoveryDays != nil {
+		t.Errorf("second period recovered at %v after %v days, want null", second.RecoveryDate, second.RecoveryDays)
+	}
+
+	if got := computeRecoveryPeriods(indexSeries("2021-01-01", 100, 101, 102)); len(got) != 0 {
+		t.Errorf("rising series: %+v, want no drawdowns", got)
+	}
+}
+
+func TestComputeRecoveryRatio(t *testing.T) {
+	tests := []struct {
+		name   string
+		closes []float64
+		want   float64
+	}{
+		{"all-time high", []float64{100, 80, 120}, 1},
+		{"rising", []float64{100, 101, 102}, 1},
+		{"single point", []float64{100}, 1},
+		{"at the trough", []float64{100, 120, 90}, 0},
+		{"partly recovered", []float64{100, 120, 80, 110}, 0.75},
+		{"smaller drawdown after recovering", []float64{100, 50, 130, 120}, 1},
+	}
+	for _, tt := range tests {
+		if got := computeRecoveryRatio(indexSeries("2021-01-01", tt.closes...)); !almostEqual(got, tt.want) {
+			t.Errorf("%s: computeRecoveryRatio(%v) = %v, want %v", tt.name, tt.closes, got, tt.want)
+		}
+	}
+}
+
+func TestComputeCalmar(t *testing.T) {
+	if got := computeCalmar(0.2, -0.1); !almostEqual(got, 2) {
+		t.Errorf("computeCalmar(20%%, -10%%) = %v, want 2", got)
+	}
+	// Same CAGR, deeper drawdown: lower ratio.
+	if shallow, deep := computeCalmar(0.2, -0.1), computeCalmar(0.2, -0.4); deep >= shallow {
+		t.Errorf("Calmar with -40%% drawdown = %v, want below %v", deep, shallow)
+	}
+	if got := computeCalmar(0.2, 0); got != maxCalmarRatio {
+		t.Errorf("computeCalmar without drawdown = %v, want %v", got, maxCalmarRatio)
+	}
+	if got := computeCalmar(0, 0); got != 0 {
+		t.Errorf("computeCalmar of a flat series = %v, want 0", got)
+	}
+
+	// Two series with the same start, end and dates but different paths.
+	path := func(trough float64) []IndexData {
+		return []IndexData{
+			{Date: "2019-01-01", AdjClose: 100},
+			{Date: "2019-07-01", AdjClose: trough},
+			{Date: "2020-01-01", AdjClose: 110},
+			{Date: "2021-01-01", AdjClose: 121},
+		}
+	}
+	shallow := computePortfolioStats(path(95), 0)
+	deep := computePortfolioStats(path(60), 0)
+	if !almostEqual(shallow.CAGRPct, deep.CAGRPct) || deep.CalmarRatio >= shallow.CalmarRatio {
+		t.Errorf("CalmarRatio = %v (deep) vs %v (shallow), want deep below shallow", deep.CalmarRatio, shallow.CalmarRatio)
+	}
+}
+
+func TestComputeSeasonality(t *testing.T) {
+	series := []IndexData{
+		{Date: "2019-12-15", AdjClose: 90},
+		{Date: "2019-12-31", AdjClose: 100},
+		{Date: "2020-01-15", AdjClose: 105},
+		{Date: "2020-01-31", AdjClose: 110},
+		{Date: "2020-12-31", AdjClose: 120},
+		{Date: "2021-01-31", AdjClose: 114},
+		{Date: "2021-12-31", AdjClose: 130},
+		{Date: "2022-01-31", AdjClose: 135.2},
+	}
+	// January returns are 10%, -5% and 4%.
+	got := computeSeasonality(series)
+	if !almostEqual(got["January"], 3) {
+		t.Errorf("January = %v, want 3", got["January"])
+	}
+	stdDevs := computeSeasonalityStdDev(series)
+	if !almostEqual(stdDevs["January"], math.Sqrt(57)) {
+		t.Errorf("January std dev = %v, want %v", stdDevs["January"], math.Sqrt(57))
+	}
+	// The first December has no previous month end to start from.
+	if !almostEqual(got["December"], (120.0/110-1+130.0/114-1)/2*100) {
+		t.Errorf("December = %v", got["December"])
+	}
+	if _, ok := got["June"]; ok {
+		t.Errorf("seasonality = %v, want no June", got)
+	}
+}
+
+func TestComputeStreaks(t *testing.T) {
+	rising := indexSeries("2021-01-01", 100, 101, 102, 103, 104)
+	want := Streaks{MaxConsecutiveGains: len(rising) - 1, CurrentStreak: len(rising) - 1, CurrentStreakDirection: "up"}
+	if got := computeStreaks(rising); got != want {
+		t.Errorf("computeStreaks(rising) = %+v, want %+v", got, want)
+	}
+
+	series := indexSeries("2021-01-01", 100, 99, 98, 97, 98, 99, 99, 98, 97)
+	want = Streaks{MaxConsecutiveGains: 2, MaxConsecutiveLosses: 3, CurrentStreak: 2, CurrentStreakDirection: "down"}
+	if got := computeStreaks(series); got != want {
+		t.Errorf("computeStreaks = %+v, want %+v", got, want)
+	}
+
+	if got := computeStreaks(series[:1]); got != (Streaks{CurrentStreakDirection: "flat"}) {
+		t.Errorf("computeStreaks(single point) = %+v", got)
+	}
+}
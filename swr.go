@@ -0,0 +1,119 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// backgroundRefreshes tracks when the data of every symbol was last fetched
+// by this instance and which symbols are being refreshed. The zero value is
+// ready to use.
+type backgroundRefreshes struct {
+	mu        sync.Mutex
+	fetchedAt map[string]time.Time
+	inFlight  map[string]bool
+}
+
+// fetched records that the data of symbol was fetched at t.
+func (b *backgroundRefreshes) fetched(symbol string, t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.fetchedAt == nil {
+		b.fetchedAt = make(map[string]time.Time)
+	}
+	b.fetchedAt[symbol] = t
+}
+
+// age returns how long ago the data of symbol was fetched, or 0 when it was
+// not fetched by this instance, e.g. when it was written before a restart.
+func (b *backgroundRefreshes) age(symbol string, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, ok := b.fetchedAt[symbol]
+	if !ok {
+		return 0
+	}
+	return now.Sub(t)
+}
+
+// start marks symbol as being refreshed and reports whether it was not
+// already.
+func (b *backgroundRefreshes) start(symbol string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.inFlight[symbol] {
+		return false
+	}
+	if b.inFlight == nil {
+		b.inFlight = make(map[string]bool)
+	}
+	b.inFlight[symbol] = true
+	return true
+}
+
+// finish marks the refresh of symbol as done.
+func (b *backgroundRefreshes) finish(symbol string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.inFlight, symbol)
+}
+
+// staleSymbolData returns the most recent cached data of symbol, today's or
+// the previous day's, without waiting for the EOD API. It refreshes the data
+// in the background when it is from the previous day or older than the
+// stale threshold, and then reports it as stale. ok is false when neither
+// day is cached.
+func (a *App) staleSymbolData(ctx context.Context, symbol, startDate string, now time.Time) (data []StockData, stale, ok bool) {
+	today := now.UTC().Format(time.DateOnly)
+	if data, err := a.readCachedSymbolData(ctx, symbol, today); err == nil {
+		a.promMetrics.cacheResult(symbol, true)
+		if a.refreshes.age(symbol, now) <= a.staleThreshold {
+			return data, false, true
+		}
+		if a.refreshes.start(symbol) {
+			go a.backgroundRefresh(context.WithoutCancel(ctx), symbol, startDate)
+		}
+		return data, true, true
+	}
+	yesterday := now.UTC().AddDate(0, 0, -1).Format(time.DateOnly)
+	data, err := a.readCachedSymbolData(ctx, symbol, yesterday)
+	if err != nil {
+		return nil, false, false
+	}
+	a.promMetrics.cacheResult(symbol, true)
+	if a.refreshes.start(symbol) {
+		go a.backgroundRefresh(context.WithoutCancel(ctx), symbol, startDate)
+	}
+	return data, true, true
+}
+
+// backgroundRefresh fetches today's data of symbol from the EOD API and
+// caches it. It is run in its own goroutine after a.refreshes.start.
+func (a *App) backgroundRefresh(ctx context.Context, symbol, from string) {
+	defer a.refreshes.finish(symbol)
+	today := time.Now().UTC().Format(time.DateOnly)
+	if _, err := a.fetchSymbolData(ctx, symbol, from, today); err != nil {
+		a.logRequest(ctx, logging.Entry{
+			Severity: logging.Warning,
+			Payload:  fmt.Sprintf("background refresh of %s: %v", symbol, err),
+		})
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandlerStaleWhileRevalidate(t *testing.T) {
+	voo := fixtureSeries("2019-01-02", true, 100, 101, 102)
+	btc := fixtureSeries("2019-01-02", false, 10, 11, 12, 13, 14)
+	fresh := map[string][]StockData{
+		"VOO.US":     fixtureSeries("2019-01-02", true, 100, 101, 102, 103),
+		"BTC-USD.CC": fixtureSeries("2019-01-02", false, 10, 11, 12, 13, 14, 15),
+	}
+	var calls atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		symbol := r.URL.Path[len("/eod/"):]
+		json.NewEncoder(w).Encode(fresh[symbol])
+	}))
+	t.Cleanup(srv.Close)
+
+	app := newTestApp(t)
+	app.eodBaseURL = srv.URL
+	app.staleThreshold = time.Hour
+	backend := &memoryCacheBackend{objects: map[string][]byte{}}
+	app.cacheBackend = backend
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format(time.DateOnly)
+	for symbol, data := range map[string][]StockData{"VOO.US": voo, "BTC-USD.CC": btc} {
+		body, err := json.Marshal(data)
+		if err != nil {
+			t.Fatalf("json.Marshal: %v", err)
+		}
+		backend.Write(symbol, yesterday, body)
+	}
+
+	// Both requests are served the previous day's data without waiting for
+	// the EOD API, which is called once per symbol.
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ9", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+		}
+		if got := rr.Header().Get("X-Cache"); got != "STALE" {
+			t.Errorf("X-Cache = %q, want STALE", got)
+		}
+	}
+	close(release)
+
+	today := time.Now().UTC().Format(time.DateOnly)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, errVOO := backend.Read("VOO.US", today)
+		_, errBTC := backend.Read("BTC-USD.CC", today)
+		if errVOO == nil && errBTC == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("background refresh did not cache today's data: %v, %v", errVOO, errBTC)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("EOD API calls = %d, want 2", got)
+	}
+
+	// Once refreshed, the data is fresh again.
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/QUARTZ9", nil))
+	if got := rr.Header().Get("X-Cache"); got != "" {
+		t.Errorf("X-Cache = %q after the refresh, want none", got)
+	}
+}
+
+func TestStaleSymbolDataThreshold(t *testing.T) {
+	var calls int
+	app := newTestApp(t)
+	app.eodBaseURL = newEODServer(t, fixtureSeries("2019-01-02", true, 100), &calls).URL
+	app.staleThreshold = time.Hour
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100))
+
+	now := time.Now()
+	app.refreshes.fetched("VOO.US", now.Add(-30*time.Minute))
+	if _, stale, ok := app.staleSymbolData(context.Background(), "VOO.US", fundInceptionDate, now); !ok || stale {
+		t.Errorf("staleSymbolData = stale %v, ok %v, want fresh data", stale, ok)
+	}
+
+	// Hold the refresh so that it is still in flight below.
+	app.refreshes.start("VOO.US")
+	app.refreshes.fetched("VOO.US", now.Add(-2*time.Hour))
+	if _, stale, ok := app.staleSymbolData(context.Background(), "VOO.US", fundInceptionDate, now); !ok || !stale {
+		t.Errorf("staleSymbolData = stale %v, ok %v, want stale data", stale, ok)
+	}
+	if calls != 0 {
+		t.Errorf("EOD API calls = %d, want none while a refresh is in flight", calls)
+	}
+
+	if _, _, ok := app.staleSymbolData(context.Background(), "BND.US", fundInceptionDate, now); ok {
+		t.Error("staleSymbolData(BND.US) ok = true, want false without cached data")
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ComponentConfig is a component of a fund in the symbols config file.
+type ComponentConfig struct {
+	EODSymbol string  `yaml:"eod_symbol"`
+	Weight    float64 `yaml:"weight"`
+}
+
+// SymbolConfig is a fund in the symbols config file, a YAML list of funds
+// as in symbols.yaml. As YAML is a superset of JSON, the file may also be
+// written as JSON.
+type SymbolConfig struct {
+	Symbol     string            `yaml:"symbol"`
+	Components []ComponentConfig `yaml:"components"`
+	StartDate  string            `yaml:"start_date"`
+}
+
+// fundDefinition converts the config to the definition of the fund.
+func (c SymbolConfig) fundDefinition() FundDefinition {
+	f := FundDefinition{Name: c.Symbol, StartDate: c.StartDate}
+	for _, component := range c.Components {
+		f.Components = append(f.Components, ComponentWeight{component.EODSymbol, component.Weight})
+	}
+	return f
+}
+
+// parseSymbolConfig parses and validates a symbols config file.
+func parseSymbolConfig(data []byte) ([]FundDefinition, error) {
+	var configs []SymbolConfig
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&configs); err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no funds defined")
+	}
+	funds := make([]FundDefinition, len(configs))
+	for i, c := range configs {
+		funds[i] = c.fundDefinition()
+		if len(funds[i].Components) == 0 {
+			return nil, fmt.Errorf("fund %s has no components", c.Symbol)
+		}
+	}
+	if _, err := validateFundDefinitions(funds, componentsOf(funds)); err != nil {
+		return nil, err
+	}
+	return funds, nil
+}
+
+// loadSymbolConfig reads the funds from the symbols config file at path.
+func loadSymbolConfig(path string) ([]FundDefinition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	funds, err := parseSymbolConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return funds, nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoadSymbolConfig(t *testing.T) {
+	// The shipped config defines the built-in funds.
+	funds, err := loadSymbolConfig("symbols.yaml")
+	if err != nil {
+		t.Fatalf("loadSymbolConfig: %v", err)
+	}
+	if !reflect.DeepEqual(funds, builtinFunds) {
+		t.Errorf("symbols.yaml = %+v, want %+v", funds, builtinFunds)
+	}
+
+	funds, err = parseSymbolConfig([]byte(`[{"symbol": "QUARTZ6", "start_date": "2020-01-02", "components": [
+		{"eod_symbol": "VOO.US", "weight": 0.6}, {"eod_symbol": "QQQ.US", "weight": 0.4}]}]`))
+	if err != nil {
+		t.Fatalf("parseSymbolConfig(JSON): %v", err)
+	}
+	want := []FundDefinition{{Name: "QUARTZ6", StartDate: "2020-01-02", Components: []ComponentWeight{{"VOO.US", 0.6}, {"QQQ.US", 0.4}}}}
+	if !reflect.DeepEqual(funds, want) {
+		t.Errorf("parseSymbolConfig(JSON) = %+v, want %+v", funds, want)
+	}
+}
+
+func TestParseSymbolConfigInvalid(t *testing.T) {
+	invalid := map[string]string{
+		"sum": `
+- symbol: QUARTZ6
+  components:
+    - {eod_symbol: VOO.US, weight: 0.6}
+    - {eod_symbol: BTC-USD.CC, weight: 0.3}`,
+		"empty":         `[]`,
+		"no components": `[{symbol: QUARTZ6}]`,
+		"start date":    `[{symbol: QUARTZ6, start_date: 2020-13-01, components: [{eod_symbol: VOO.US, weight: 1}]}]`,
+		"unknown field": `[{symbol: QUARTZ6, components: [{eod_symbol: VOO.US, weight: 1, ratio: 1}]}]`,
+		"duplicate": `[{symbol: A, components: [{eod_symbol: VOO.US, weight: 1}]},
+			{symbol: A, components: [{eod_symbol: VOO.US, weight: 1}]}]`,
+	}
+	for name, config := range invalid {
+		if _, err := parseSymbolConfig([]byte(config)); err == nil {
+			t.Errorf("%s: parseSymbolConfig succeeded, want error", name)
+		}
+	}
+}
+
+func TestSetFundDefinitions(t *testing.T) {
+	t.Cleanup(func() {
+		if err := setFundDefinitions(builtinFunds); err != nil {
+			t.Fatalf("setFundDefinitions(builtinFunds): %v", err)
+		}
+	})
+	err := setFundDefinitions([]FundDefinition{{Name: "QUARTZ6", Components: []ComponentWeight{{"VOO.US", 0.6}, {"QQQ.US", 0.4}}}})
+	if err != nil {
+		t.Fatalf("setFundDefinitions: %v", err)
+	}
+	if _, ok := lookupFund("QUARTZ6"); !ok {
+		t.Error("lookupFund(QUARTZ6) not found")
+	}
+	if _, ok := lookupFund("QUARTZ9"); ok {
+		t.Error("lookupFund(QUARTZ9) found after replacing the funds")
+	}
+	if want := []string{"VOO.US", "QQQ.US"}; !reflect.DeepEqual(fundComponents, want) {
+		t.Errorf("fundComponents = %v, want %v", fundComponents, want)
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// secretPattern matches credentials that could end up in a trace line, such
+// as the api_token query parameter of EODHD URLs.
+var secretPattern = regexp.MustCompile(`(api_token|apikey|api_key|token)=[^&\s]+`)
+
+// computationTrace collects the steps of an index computation for
+// ?debug=true. A nil trace is valid and records nothing.
+type computationTrace []string
+
+// add records a step. Credentials are redacted.
+func (t *computationTrace) add(format string, args ...any) {
+	if t == nil {
+		return
+	}
+	*t = append(*t, secretPattern.ReplaceAllString(fmt.Sprintf(format, args...), "$1=REDACTED"))
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestComputationTraceRedactsSecrets(t *testing.T) {
+	var trace computationTrace
+	trace.add("GET %s", "https://eodhd.com/api/eod/VOO.US?fmt=json&api_token=abc.123&from=2019-01-02")
+	if strings.Contains(trace[0], "abc.123") || !strings.Contains(trace[0], "api_token=REDACTED&from=2019-01-02") {
+		t.Errorf("trace = %q, want the API token redacted", trace[0])
+	}
+
+	var nilTrace *computationTrace
+	nilTrace.add("ignored")
+}
+
+func TestHandlerDebugTrace(t *testing.T) {
+	app := newTestApp(t)
+	app.adminToken = "secret"
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-03", true, 100, 101))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-03", false, 10, 11, 12, 13, 14))
+
+	get := func(authorization string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/QUARTZ9?debug=true", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		app.newRouter().ServeHTTP(rr, req)
+		return rr
+	}
+
+	for _, authorization := range []string{"", "Bearer wrong"} {
+		if rr := get(authorization); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: Code = %d, want %d", authorization, rr.Code, http.StatusUnauthorized)
+		}
+	}
+
+	rr := get("Bearer secret")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got IndexResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	trace := strings.Join(got.DebugTrace, "\n")
+	for _, want := range []string{
+		"raw VOO.US 2019-01-03 adjusted_close=100.0000",
+		"raw BTC-USD.CC 2019-01-07 adjusted_close=14.0000",
+		// 2019-01-05 is a Saturday, VOO is filled from Friday.
+		"fill component 0 2019-01-05 with last (1 days)",
+		"blend 2019-01-03: 0.9 x 100.0000 + 0.1 x 10.0000 = 91.0000, / 91.0000 * 100 = 100.0000",
+	} {
+		if !strings.Contains(trace, want) {
+			t.Errorf("debug_trace does not contain %q:\n%s", want, trace)
+		}
+	}
+}
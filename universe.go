@@ -0,0 +1,105 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// FundSummary holds the headline statistics of a fund.
+type FundSummary struct {
+	CAGRPct          float64 `json:"cagr_pct"`
+	VolatilityAnnPct float64 `json:"volatility_ann_pct"`
+	SharpeRatio      float64 `json:"sharpe_ratio"`
+}
+
+// UniverseResponse is the response of the fund universe endpoint.
+type UniverseResponse struct {
+	Series  map[string][]IndexData `json:"series"`
+	Summary map[string]FundSummary `json:"summary"`
+}
+
+// UniverseHandler returns every fund normalised to 100 on the same start
+// date, e.g. /universe?from=2020-01-01, along with a summary of each fund.
+func (a *App) UniverseHandler(w http.ResponseWriter, r *http.Request) {
+	from, err := optionalDateParam(r, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := a.computeUniverse(r.Context(), from)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error computing fund universe: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// computeUniverse computes the series of every fund concurrently. Every
+// series starts on the same date, the later of from and the first date all
+// funds have a value.
+func (a *App) computeUniverse(ctx context.Context, from string) (UniverseResponse, error) {
+	series := make([][]IndexData, len(fundSymbols))
+	errs := make([]error, len(fundSymbols))
+	var wg sync.WaitGroup
+	for i, symbol := range fundSymbols {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fund, _ := lookupFund(symbol)
+			series[i], errs[i] = a.computeIndexSeries(ctx, fund, "", indexOptions{})
+		}()
+	}
+	wg.Wait()
+
+	start := from
+	for i, s := range series {
+		if errs[i] != nil {
+			return UniverseResponse{}, fmt.Errorf("%s: %w", fundSymbols[i], errs[i])
+		}
+		if len(s) > 0 {
+			start = maxDateStr(start, s[0].Date)
+		}
+	}
+
+	response := UniverseResponse{
+		Series:  make(map[string][]IndexData, len(fundSymbols)),
+		Summary: make(map[string]FundSummary, len(fundSymbols)),
+	}
+	for i, symbol := range fundSymbols {
+		s := series[i]
+		if start != "" {
+			s = rebaseSeries(s, start)
+		}
+		if s == nil {
+			s = []IndexData{}
+		}
+		stats := computePortfolioStats(s, defaultRiskFreeRate)
+		response.Series[symbol] = s
+		response.Summary[symbol] = FundSummary{
+			CAGRPct:          stats.CAGRPct,
+			VolatilityAnnPct: stats.VolatilityAnnPct,
+			SharpeRatio:      stats.SharpeRatio,
+		}
+	}
+	return response, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUniverseHandler(t *testing.T) {
+	app := newTestApp(t)
+	writeFixture(t, app, "VOO.US", fixtureSeries("2019-01-02", true, 100, 101, 102, 103, 104))
+	writeFixture(t, app, "BTC-USD.CC", fixtureSeries("2019-01-02", false, 10, 11, 12, 13, 14, 15, 16))
+	writeFixture(t, app, "ETH-USD.CC", fixtureSeries("2019-01-02", false, 1, 1, 1, 1, 1, 1, 1))
+
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/universe?from=2019-01-04", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Code = %d, want %d: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var got UniverseResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	for _, symbol := range fundSymbols {
+		series := got.Series[symbol]
+		if len(series) != 5 || series[0].Date != "2019-01-04" || series[0].AdjClose != 100 {
+			t.Errorf("%s = %+v, want 5 points starting at 100 on 2019-01-04", symbol, series)
+		}
+		if _, ok := got.Summary[symbol]; !ok {
+			t.Errorf("summary is missing %s", symbol)
+		}
+	}
+	// BTC rises faster than VOO, so the fund holding more BTC grows more.
+	if got.Summary["QUARTZ5"].CAGRPct <= got.Summary["QUARTZ9"].CAGRPct {
+		t.Errorf("summary = %+v, want QUARTZ5 to outgrow QUARTZ9", got.Summary)
+	}
+}
+
+func TestUniverseHandlerInvalidFrom(t *testing.T) {
+	app := newTestApp(t)
+	rr := httptest.NewRecorder()
+	app.newRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/universe?from=2019-13-01", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Code = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}